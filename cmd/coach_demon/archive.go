@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"coach_demon/internal/archive"
+)
+
+// exportArchive writes the configured store to an archive file:
+//
+//	coach_demon export [-problems 1A,2B] [-gzip] FILE
+//
+// FILE is gzip-compressed when it ends in .gz or -gzip is given.
+func exportArchive(logger *zerolog.Logger, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	problems := flags.String("problems", "", "comma-separated problem IDs to export (default all)")
+	compress := flags.Bool("gzip", false, "gzip the archive")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: coach_demon export [-problems 1A,2B] [-gzip] FILE")
+	}
+	path := flags.Arg(0)
+
+	ctx := context.Background()
+	store, err := openStore(ctx, logger)
+	if err != nil {
+		return err
+	}
+	if closer, ok := store.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	stats, err := archive.Export(ctx, store, f, archive.Options{
+		ProblemIDs: splitList(*problems),
+		Gzip:       *compress || strings.HasSuffix(path, ".gz"),
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	logArchiveStats(logger, stats).Str("path", path).Msg("exported archive")
+	return nil
+}
+
+// importArchive loads an archive file into the configured store:
+//
+//	coach_demon import [-problems 1A,2B] FILE
+func importArchive(logger *zerolog.Logger, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	problems := flags.String("problems", "", "comma-separated problem IDs to import (default all)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: coach_demon import [-problems 1A,2B] FILE")
+	}
+	path := flags.Arg(0)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx := context.Background()
+	store, err := openStore(ctx, logger)
+	if err != nil {
+		return err
+	}
+	if closer, ok := store.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	stats, err := archive.Import(ctx, store, f, archive.Options{ProblemIDs: splitList(*problems)})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	logArchiveStats(logger, stats).Str("path", path).Msg("imported archive")
+	return nil
+}
+
+func logArchiveStats(logger *zerolog.Logger, stats archive.Stats) *zerolog.Event {
+	return logger.Info().
+		Int("statements", stats.Statements).
+		Int("snapshots", stats.Snapshots).
+		Int("feedbacks", stats.Feedbacks).
+		Int("sessions", stats.Sessions).
+		Int("hints", stats.Hints).
+		Int("summaries", stats.Summaries).
+		Int("skipped", stats.Skipped)
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
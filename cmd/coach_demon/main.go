@@ -1,8 +1,15 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -11,6 +18,9 @@ import (
 	"coach_demon/internal/app"
 	"coach_demon/internal/fetcher"
 	"coach_demon/internal/openai"
+	"coach_demon/internal/policy"
+	"coach_demon/internal/prompts"
+	"coach_demon/internal/retention"
 	"coach_demon/internal/server"
 	"coach_demon/internal/storage"
 )
@@ -37,20 +47,59 @@ func main() {
 	// Setup logger with some defaults (ISO timestamp)
 	logger := log.Logger
 
-	mStore, err := storage.NewMongoManager(viper.GetString("MONGODB_URI"), &logger)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import-mongo":
+			if err := importMongo(&logger); err != nil {
+				logger.Fatal().Err(err).Msg("import failed")
+			}
+			return
+		case "migrate":
+			if err := migrate(&logger, os.Args[2:]); err != nil {
+				logger.Fatal().Err(err).Msg("migration failed")
+			}
+			return
+		case "export":
+			if err := exportArchive(&logger, os.Args[2:]); err != nil {
+				logger.Fatal().Err(err).Msg("export failed")
+			}
+			return
+		case "import":
+			if err := importArchive(&logger, os.Args[2:]); err != nil {
+				logger.Fatal().Err(err).Msg("import failed")
+			}
+			return
+		case "retention":
+			if err := applyRetention(&logger, os.Args[2:]); err != nil {
+				logger.Fatal().Err(err).Msg("retention failed")
+			}
+			return
+		default:
+			logger.Fatal().Msgf("unknown command %q", os.Args[1])
+		}
+	}
+
+	store, err := openStore(context.Background(), &logger)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("storage setup failed")
 	}
+	store = storage.WithTimeouts(store, storage.Timeouts{
+		Read:  secondsOr("STORAGE_READ_TIMEOUT_SECONDS", 5*time.Second),
+		Write: secondsOr("STORAGE_WRITE_TIMEOUT_SECONDS", 10*time.Second),
+	})
 
-	aiCfg := openai.Config{
-		APIKey:       viper.GetString("OPENAI_API_KEY"),
-		Model:        viper.GetString("OPENAI_MODEL"),
-		SystemPrompt: viper.GetString("OPENAI_SYSTEM_PROMPT"),
+	aiClient, err := aiProvider(&http.Client{})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("AI provider setup failed")
 	}
-	httpClient := &http.Client{}
-	aiClient, err := openai.NewClient(aiCfg, httpClient)
+
+	promptLib, err := prompts.NewLibrary(viper.GetString("PROMPTS_DIR"))
 	if err != nil {
-		logger.Fatal().Err(err).Msg("openai client setup failed")
+		logger.Fatal().Err(err).Msg("loading prompts failed")
+	}
+	promptMode := viper.GetString("PROMPT_MODE")
+	if !promptLib.Current().HasMode(promptMode) {
+		logger.Fatal().Msgf("PROMPT_MODE %q not found, prompts have modes %v", promptMode, promptLib.Current().Modes())
 	}
 
 	fetchURL := viper.GetString("FETCHER_ENDPOINT")
@@ -60,11 +109,42 @@ func main() {
 	fetchTok := viper.GetString("FETCHER_TOKEN")
 	fetchSvc := fetcher.NewBrowserless(fetchURL, fetchTok)
 
+	maxAI := viper.GetInt("AI_MAX_CONCURRENT_REQUESTS")
+	if maxAI <= 0 {
+		maxAI = 4
+	}
+
+	idleTimeout := secondsOr("WS_IDLE_TIMEOUT_SECONDS", 30*time.Minute)
+	sessionTimeout := secondsOr("SESSION_IDLE_TIMEOUT_SECONDS", 30*time.Minute)
+
+	feedbackPolicy := policy.Default
+	if viper.IsSet("FEEDBACK_MIN_INTERVAL_SECONDS") {
+		feedbackPolicy.MinInterval = time.Duration(viper.GetFloat64("FEEDBACK_MIN_INTERVAL_SECONDS") * float64(time.Second))
+	}
+	if viper.IsSet("FEEDBACK_MIN_CHANGE") {
+		feedbackPolicy.MinChange = viper.GetFloat64("FEEDBACK_MIN_CHANGE")
+	}
+	if viper.IsSet("FEEDBACK_ON_THOUGHTS_CHANGE") {
+		feedbackPolicy.OnThoughtsChange = viper.GetBool("FEEDBACK_ON_THOUGHTS_CHANGE")
+	}
+
 	appCtx := &app.App{
-		Store:  mStore,
-		AI:     aiClient,
-		Fetch:  fetchSvc,
-		Logger: &logger,
+		Store:                store,
+		AI:                   aiClient,
+		Prompts:              promptLib,
+		PromptMode:           promptMode,
+		PromptReloadInterval: secondsOr("PROMPTS_RELOAD_SECONDS", 5*time.Second),
+		Fetch:                fetchSvc,
+		Logger:               &logger,
+		StreamFeedback:       viper.GetBool("OPENAI_STREAM"),
+		Feedback:             feedbackPolicy,
+		FeedbackHistory:      intOr("FEEDBACK_HISTORY_ENTRIES", 3),
+		PromptTokens:         promptTokens(),
+		MaxConcurrentAI:      maxAI,
+		WSIdleTimeout:        idleTimeout,
+		SessionIdleTimeout:   sessionTimeout,
+		Retention:            retentionPolicy(),
+		RetentionDryRun:      viper.GetBool("RETENTION_DRY_RUN"),
 	}
 
 	addr := ":" + viper.GetString("PORT")
@@ -73,7 +153,217 @@ func main() {
 	}
 	logger.Info().Str("addr", addr).Msg("🚀 Coach server starting")
 
+	go server.RunSessionReaper(context.Background(), appCtx)
+	go server.RunRetention(context.Background(), appCtx)
+	go server.RunPromptReload(context.Background(), appCtx)
+
 	if err := http.ListenAndServe(addr, server.New(appCtx)); err != nil {
 		logger.Fatal().Err(err).Msg("server error")
 	}
 }
+
+// aiProvider builds the coaching backend selected by AI_PROVIDER. The
+// OpenAI-compatible backend has its own model and key so that switching to a
+// self-hosted server never sends the OpenAI key there.
+func aiProvider(httpClient *http.Client) (openai.Provider, error) {
+	name := viper.GetString("AI_PROVIDER")
+	cfg := openai.Config{
+		APIKey:       viper.GetString("OPENAI_API_KEY"),
+		Model:        viper.GetString("OPENAI_MODEL"),
+		SystemPrompt: viper.GetString("OPENAI_SYSTEM_PROMPT"),
+		Temperature:  viper.GetFloat64("OPENAI_TEMPERATURE"),
+		Timeout:      secondsOr("OPENAI_TIMEOUT_SECONDS", 60*time.Second),
+	}
+	if name == openai.ProviderCompatible {
+		cfg.APIKey = viper.GetString("AI_API_KEY")
+		cfg.Model = viper.GetString("AI_MODEL")
+		cfg.BaseURL = viper.GetString("AI_BASE_URL")
+	}
+	return openai.NewProvider(name, cfg, httpClient)
+}
+
+// promptTokens is the prompt budget: AI_PROMPT_TOKENS, or else what fits the
+// context window of the configured model. The fake provider has no limit.
+func promptTokens() int {
+	if viper.IsSet("AI_PROMPT_TOKENS") {
+		return viper.GetInt("AI_PROMPT_TOKENS")
+	}
+	switch viper.GetString("AI_PROVIDER") {
+	case openai.ProviderFake:
+		return 0
+	case openai.ProviderCompatible:
+		return openai.PromptBudget(viper.GetString("AI_MODEL"))
+	}
+	return openai.PromptBudget(cmp.Or(viper.GetString("OPENAI_MODEL"), openai.DefaultModel))
+}
+
+// openStore builds the storage backend selected by STORAGE_DRIVER.
+func openStore(ctx context.Context, logger *zerolog.Logger) (storage.Storage, error) {
+	switch driver := viper.GetString("STORAGE_DRIVER"); driver {
+	case "", "mongo":
+		m, err := storage.NewMongoManager(ctx, viper.GetString("MONGODB_URI"), mongoDatabase(), logger)
+		if err != nil {
+			return nil, err
+		}
+		if viper.IsSet("MONGODB_AUTO_MIGRATE") && !viper.GetBool("MONGODB_AUTO_MIGRATE") {
+			return m, m.CheckSchema(ctx)
+		}
+		if _, err := m.Migrate(ctx); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case "bolt":
+		return storage.NewBoltStore(boltPath())
+	case "memory":
+		logger.Warn().Msg("using in-memory storage, nothing is persisted")
+		return storage.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+}
+
+// secondsOr reads a duration in seconds from key, or returns def when unset.
+func secondsOr(key string, def time.Duration) time.Duration {
+	if !viper.IsSet(key) {
+		return def
+	}
+	return time.Duration(viper.GetFloat64(key) * float64(time.Second))
+}
+
+// intOr reads an integer from key, or returns def when unset.
+func intOr(key string, def int) int {
+	if !viper.IsSet(key) {
+		return def
+	}
+	return viper.GetInt(key)
+}
+
+// retentionPolicy reads the RETENTION_* day counts; unset keeps everything.
+func retentionPolicy() retention.Policy {
+	return retention.Policy{
+		SnapshotsFor:     days("RETENTION_SNAPSHOT_DAYS"),
+		AnonymousCodeFor: days("RETENTION_ANONYMOUS_CODE_DAYS"),
+	}
+}
+
+// days reads a duration in days from key, zero when unset.
+func days(key string) time.Duration {
+	return time.Duration(viper.GetFloat64(key) * float64(24*time.Hour))
+}
+
+func boltPath() string {
+	if path := viper.GetString("BOLT_PATH"); path != "" {
+		return path
+	}
+	return "coach_demon.db"
+}
+
+func mongoDatabase() string {
+	if database := viper.GetString("MONGODB_DATABASE"); database != "" {
+		return database
+	}
+	return "coach_demon"
+}
+
+// importMongo copies the MongoDB database into a new bolt file, so an
+// existing install can switch to STORAGE_DRIVER=bolt.
+func importMongo(logger *zerolog.Logger) error {
+	path := boltPath()
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists, move it away to import again", path)
+	}
+
+	src, err := storage.NewMongoManager(context.Background(), viper.GetString("MONGODB_URI"), mongoDatabase(), logger)
+	if err != nil {
+		return err
+	}
+	if err := src.CheckSchema(context.Background()); err != nil {
+		return fmt.Errorf("%w (run `coach_demon migrate` first)", err)
+	}
+	dst, err := storage.NewBoltStore(path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	stats, err := src.CopyTo(context.Background(), dst)
+	if err != nil {
+		return err
+	}
+	logger.Info().
+		Str("path", path).
+		Int("statements", stats.Statements).
+		Int("sessions", stats.Sessions).
+		Int("snapshots", stats.Snapshots).
+		Int("feedbacks", stats.Feedbacks).
+		Int("hints", stats.Hints).
+		Int("summaries", stats.Summaries).
+		Msg("imported MongoDB database")
+	return nil
+}
+
+// migrate applies pending MongoDB schema migrations, or with "status" only
+// reports the schema version.
+func migrate(logger *zerolog.Logger, args []string) error {
+	ctx := context.Background()
+	m, err := storage.NewMongoManager(ctx, viper.GetString("MONGODB_URI"), mongoDatabase(), logger)
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 0 && args[0] == "status" {
+		version, err := m.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Info().Int("database", version).Int("binary", storage.SchemaVersion()).Msg("schema version")
+		return nil
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unknown migrate argument %q, want none or \"status\"", args[0])
+	}
+
+	applied, err := m.Migrate(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info().Ints("applied", applied).Int("version", storage.SchemaVersion()).Msg("schema up to date")
+	return nil
+}
+
+// applyRetention applies the retention policy once:
+//
+//	coach_demon retention [-dry-run]
+func applyRetention(logger *zerolog.Logger, args []string) error {
+	flags := flag.NewFlagSet("retention", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report what would change")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	policy := retentionPolicy()
+	if !policy.Enabled() {
+		return errors.New("no retention rule configured, set RETENTION_SNAPSHOT_DAYS or RETENTION_ANONYMOUS_CODE_DAYS")
+	}
+
+	ctx := context.Background()
+	store, err := openStore(ctx, logger)
+	if err != nil {
+		return err
+	}
+	if closer, ok := store.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	report, err := retention.Run(ctx, store, policy, time.Now().UTC(), *dryRun)
+	if err != nil {
+		return err
+	}
+	logger.Info().
+		Bool("dryRun", report.DryRun).
+		Int("snapshotsExamined", report.SnapshotsExamined).
+		Int("snapshotsDeleted", report.SnapshotsDeleted).
+		Int("anonymousSessions", report.AnonymousSessions).
+		Int("codeRedacted", report.CodeRedacted).
+		Msg("applied retention policy")
+	return nil
+}
@@ -10,7 +10,9 @@ require (
 	github.com/openai/openai-go v0.1.0-beta.10
 	github.com/rs/zerolog v1.34.0
 	github.com/spf13/viper v1.20.1
+	go.etcd.io/bbolt v1.4.0
 	go.mongodb.org/mongo-driver v1.17.3
+	golang.org/x/net v0.39.0
 )
 
 require (
@@ -3,13 +3,47 @@ package app
 import (
 	"coach_demon/internal/fetcher"
 	"coach_demon/internal/openai"
+	"coach_demon/internal/policy"
+	"coach_demon/internal/prompts"
+	"coach_demon/internal/retention"
 	"coach_demon/internal/storage"
 	"github.com/rs/zerolog"
+	"time"
 )
 
 type App struct {
 	Store  storage.Storage
-	AI     *openai.Client
+	AI     openai.Provider
 	Fetch  fetcher.Service
 	Logger *zerolog.Logger
+
+	// Prompts renders what is sent to the AI. PromptMode is the coaching
+	// mode of clients that do not pick one, and the prompt directory is
+	// checked for changes every PromptReloadInterval; 0 disables reloading.
+	Prompts              *prompts.Library
+	PromptMode           string
+	PromptReloadInterval time.Duration
+	// PromptTokens is the estimated size a prompt may take, from the model's
+	// context window; longer prompts are cut down. 0 is unlimited.
+	PromptTokens int
+
+	// StreamFeedback streams AI feedback to editors as it is generated.
+	StreamFeedback bool
+	// Feedback decides when a snapshot is worth asking the AI about.
+	Feedback policy.Config
+	// FeedbackHistory is how many earlier feedback entries of the session a
+	// feedback prompt repeats, along with a diff of the code since the
+	// newest; 0 leaves both out. Together they take at most a share of
+	// PromptTokens.
+	FeedbackHistory int
+	// MaxConcurrentAI bounds in-flight AI requests across all connections.
+	MaxConcurrentAI int
+	// WSIdleTimeout closes editor connections without traffic; 0 disables it.
+	WSIdleTimeout time.Duration
+	// SessionIdleTimeout ends coding sessions without snapshots; 0 disables it.
+	SessionIdleTimeout time.Duration
+	// Retention compacts old snapshots and expires anonymous code. With
+	// RetentionDryRun the job only logs what it would do.
+	Retention       retention.Policy
+	RetentionDryRun bool
 }
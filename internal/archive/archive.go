@@ -0,0 +1,429 @@
+// Package archive moves coaching history between installs and storage
+// backends. An archive is JSON Lines, optionally gzip-compressed: a header
+// line followed by one line per record,
+//
+//	{"kind":"header","data":{"format":"coach_demon","version":1,...}}
+//	{"kind":"statement","data":{"ProblemID":"1A","Statement":"..."}}
+//
+// Records keep their IDs, so importing an archive twice changes nothing.
+// Session tokens are not exported; imported sessions get new ones.
+package archive
+
+import (
+	"bufio"
+	"cmp"
+	"coach_demon/internal/storage"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Format and Version identify the archive layout. Version is bumped when a
+// change would make older binaries misread an archive.
+const (
+	Format  = "coach_demon"
+	Version = 1
+)
+
+// Record kinds. Export writes the header, statements, snapshots and
+// feedback, then the sessions, hints and summaries of each user's problems.
+const (
+	KindHeader    = "header"
+	KindStatement = "statement"
+	KindSnapshot  = "snapshot"
+	KindFeedback  = "feedback"
+	KindSession   = "session"
+	KindHint      = "hint"
+	KindSummary   = "summary"
+)
+
+var (
+	// ErrUnsupportedVersion is returned for archives written by a newer
+	// coach_demon.
+	ErrUnsupportedVersion = errors.New("unsupported archive version")
+	// ErrMalformed is returned for input that is not an archive.
+	ErrMalformed = errors.New("malformed archive")
+)
+
+// Options select what is exported or imported.
+type Options struct {
+	// ProblemIDs limits the archive to these problems; empty means all.
+	ProblemIDs []string
+	// UserIDs limits the archive to the records of these users, "" being
+	// the anonymous one; empty means all. Statements are shared and always
+	// included.
+	UserIDs []string
+	// Gzip compresses the exported archive. Import detects compression.
+	Gzip bool
+}
+
+func (o Options) includes(problemID string) bool {
+	return len(o.ProblemIDs) == 0 || slices.Contains(o.ProblemIDs, problemID)
+}
+
+func (o Options) includesUser(userID string) bool {
+	return len(o.UserIDs) == 0 || slices.Contains(o.UserIDs, userID)
+}
+
+// Stats counts the records written or imported per kind. Skipped counts
+// records an import found already present.
+type Stats struct {
+	Statements int `json:"statements"`
+	Snapshots  int `json:"snapshots"`
+	Feedbacks  int `json:"feedbacks"`
+	Sessions   int `json:"sessions"`
+	Hints      int `json:"hints"`
+	Summaries  int `json:"summaries"`
+	Skipped    int `json:"skipped"`
+}
+
+type header struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	ProblemIDs []string  `json:"problemIds,omitempty"`
+}
+
+type line struct {
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Export writes the statements, snapshots, feedback, sessions, hints and
+// summary history of the selected problems to w.
+func Export(ctx context.Context, s storage.Storage, w io.Writer, opts Options) (Stats, error) {
+	var stats Stats
+	var zw *gzip.Writer
+	if opts.Gzip {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	write := func(kind string, data any) error {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(line{Kind: kind, Data: raw})
+	}
+
+	err := write(KindHeader, header{Format: Format, Version: Version, ExportedAt: time.Now().UTC(), ProblemIDs: opts.ProblemIDs})
+	if err != nil {
+		return stats, err
+	}
+
+	// Every user with a record of a problem gets their sessions, hints and
+	// summaries of it exported, so collect them while walking the other
+	// kinds. Statements have no user; they stand for anonymous records.
+	type owner struct{ userID, problemID string }
+	owners := make(map[owner]bool)
+
+	statements, err := s.GetAllStatements(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read statements: %w", err)
+	}
+	for _, statement := range statements {
+		if !opts.includes(statement.ProblemID) {
+			continue
+		}
+		owners[owner{problemID: statement.ProblemID}] = true
+		if err := write(KindStatement, statement); err != nil {
+			return stats, err
+		}
+		stats.Statements++
+	}
+
+	err = eachPage(ctx, opts, s.ListSnapshots, func(snapshot storage.Snapshot) error {
+		owners[owner{snapshot.UserID, snapshot.ProblemID}] = true
+		stats.Snapshots++
+		return write(KindSnapshot, snapshot)
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to export snapshots: %w", err)
+	}
+
+	err = eachPage(ctx, opts, s.ListFeedback, func(entry storage.FeedbackEntry) error {
+		owners[owner{entry.UserID, entry.ProblemID}] = true
+		stats.Feedbacks++
+		return write(KindFeedback, entry)
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to export feedback: %w", err)
+	}
+
+	for _, problemID := range opts.ProblemIDs {
+		owners[owner{problemID: problemID}] = true
+	}
+	sorted := slices.SortedFunc(maps.Keys(owners), func(a, b owner) int {
+		return cmp.Or(strings.Compare(a.problemID, b.problemID), strings.Compare(a.userID, b.userID))
+	})
+	for _, o := range sorted {
+		if !opts.includesUser(o.userID) {
+			continue
+		}
+		sessions, err := s.GetSessionsByProblemID(ctx, o.userID, o.problemID)
+		if err != nil {
+			return stats, fmt.Errorf("failed to export sessions of %s: %w", o.problemID, err)
+		}
+		for _, session := range sessions {
+			if err := write(KindSession, session); err != nil {
+				return stats, err
+			}
+			stats.Sessions++
+		}
+		hints, err := s.GetHintsByProblemID(ctx, o.userID, o.problemID)
+		if err != nil {
+			return stats, fmt.Errorf("failed to export hints of %s: %w", o.problemID, err)
+		}
+		for _, hint := range hints {
+			if err := write(KindHint, hint); err != nil {
+				return stats, err
+			}
+			stats.Hints++
+		}
+		history, err := s.GetSummaryHistory(ctx, o.userID, o.problemID)
+		if err != nil {
+			return stats, fmt.Errorf("failed to export summaries of %s: %w", o.problemID, err)
+		}
+		// Oldest first, so an import that renumbers keeps the order.
+		slices.Reverse(history)
+		for _, summary := range history {
+			if err := write(KindSummary, summary); err != nil {
+				return stats, err
+			}
+			stats.Summaries++
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return stats, err
+	}
+	if zw != nil {
+		return stats, zw.Close()
+	}
+	return stats, nil
+}
+
+// eachPage walks a listing of every selected problem and user in ascending
+// order.
+func eachPage[T any](
+	ctx context.Context,
+	opts Options,
+	list func(context.Context, storage.ListQuery) (storage.Page[T], error),
+	fn func(T) error,
+) error {
+	users := []storage.ListQuery{{AllUsers: true}}
+	if len(opts.UserIDs) > 0 {
+		users = users[:0]
+		for _, userID := range opts.UserIDs {
+			users = append(users, storage.ListQuery{UserID: userID})
+		}
+	}
+	var scopes []storage.ListQuery
+	for _, q := range users {
+		if len(opts.ProblemIDs) == 0 {
+			scopes = append(scopes, q)
+		}
+		for _, problemID := range opts.ProblemIDs {
+			q.ProblemID = problemID
+			scopes = append(scopes, q)
+		}
+	}
+	for _, q := range scopes {
+		q.Limit = storage.MaxListLimit
+		for {
+			page, err := list(ctx, q)
+			if err != nil {
+				return err
+			}
+			for _, item := range page.Items {
+				if err := fn(item); err != nil {
+					return err
+				}
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+	return nil
+}
+
+// Import reads an archive from r into s. Records already present are
+// skipped. A snapshot seq or summary version taken by a different record
+// is renumbered, so archives from two machines merge.
+func Import(ctx context.Context, s storage.Storage, r io.Reader, opts Options) (Stats, error) {
+	var stats Stats
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return stats, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+
+	dec := json.NewDecoder(r)
+	var first line
+	if err := dec.Decode(&first); err != nil || first.Kind != KindHeader {
+		return stats, fmt.Errorf("%w: missing header", ErrMalformed)
+	}
+	var h header
+	if err := json.Unmarshal(first.Data, &h); err != nil || h.Format != Format {
+		return stats, fmt.Errorf("%w: not a %s archive", ErrMalformed, Format)
+	}
+	if h.Version > Version {
+		return stats, fmt.Errorf("%w: archive version %d, this binary reads up to %d", ErrUnsupportedVersion, h.Version, Version)
+	}
+
+	for n := 2; ; n++ {
+		var l line
+		err := dec.Decode(&l)
+		if errors.Is(err, io.EOF) {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("%w: record %d: %v", ErrMalformed, n, err)
+		}
+		if err := importRecord(ctx, s, l, opts, &stats); err != nil {
+			return stats, fmt.Errorf("record %d (%s): %w", n, l.Kind, err)
+		}
+	}
+}
+
+func importRecord(ctx context.Context, s storage.Storage, l line, opts Options, stats *Stats) error {
+	switch l.Kind {
+	case KindStatement:
+		statement, err := decode[storage.StatementEntry](l.Data)
+		if err != nil || !opts.includes(statement.ProblemID) {
+			return err
+		}
+		_, err = s.GetStatement(ctx, statement.ProblemID)
+		if err == nil {
+			stats.Skipped++
+			return nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		if err := s.SaveStatement(ctx, statement); err != nil {
+			return err
+		}
+		stats.Statements++
+
+	case KindSnapshot:
+		snapshot, err := decode[storage.Snapshot](l.Data)
+		if err != nil || !opts.includes(snapshot.ProblemID) || !opts.includesUser(snapshot.UserID) {
+			return err
+		}
+		_, err = s.SaveSnapshot(ctx, snapshot)
+		if errors.Is(err, storage.ErrDuplicate) {
+			_, gerr := s.GetSnapshot(ctx, snapshot.ID)
+			if gerr == nil {
+				stats.Skipped++
+				return nil
+			}
+			if !errors.Is(gerr, storage.ErrNotFound) {
+				return gerr
+			}
+			snapshot.Seq = 0
+			_, err = s.SaveSnapshot(ctx, snapshot)
+		}
+		if err != nil {
+			return err
+		}
+		stats.Snapshots++
+
+	case KindFeedback:
+		entry, err := decode[storage.FeedbackEntry](l.Data)
+		if err != nil || !opts.includes(entry.ProblemID) || !opts.includesUser(entry.UserID) {
+			return err
+		}
+		err = s.SaveFeedback(ctx, entry)
+		if errors.Is(err, storage.ErrDuplicate) {
+			stats.Skipped++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stats.Feedbacks++
+
+	case KindSession:
+		session, err := decode[storage.Session](l.Data)
+		if err != nil || !opts.includes(session.ProblemID) || !opts.includesUser(session.UserID) {
+			return err
+		}
+		_, err = s.CreateSession(ctx, session)
+		if errors.Is(err, storage.ErrDuplicate) {
+			stats.Skipped++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stats.Sessions++
+
+	case KindHint:
+		hint, err := decode[storage.HintEntry](l.Data)
+		if err != nil || !opts.includes(hint.ProblemID) || !opts.includesUser(hint.UserID) {
+			return err
+		}
+		err = s.SaveHint(ctx, hint)
+		if errors.Is(err, storage.ErrDuplicate) {
+			stats.Skipped++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stats.Hints++
+
+	case KindSummary:
+		summary, err := decode[storage.Summary](l.Data)
+		if err != nil || !opts.includes(summary.ProblemID) || !opts.includesUser(summary.UserID) {
+			return err
+		}
+		_, err = s.SaveSummary(ctx, summary)
+		if errors.Is(err, storage.ErrDuplicate) {
+			history, herr := s.GetSummaryHistory(ctx, summary.UserID, summary.ProblemID)
+			if herr != nil {
+				return herr
+			}
+			if slices.ContainsFunc(history, func(stored storage.Summary) bool { return stored.ID == summary.ID }) {
+				stats.Skipped++
+				return nil
+			}
+			summary.Version = 0
+			_, err = s.SaveSummary(ctx, summary)
+		}
+		if err != nil {
+			return err
+		}
+		stats.Summaries++
+
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrMalformed, l.Kind)
+	}
+	return nil
+}
+
+func decode[T any](data json.RawMessage) (T, error) {
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,141 @@
+package archive_test
+
+import (
+	"bytes"
+	"coach_demon/internal/archive"
+	"coach_demon/internal/storage"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var base = time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func seed(t *testing.T) storage.Storage {
+	t.Helper()
+	ctx := t.Context()
+	s := storage.NewMemoryStore()
+	for _, problemID := range []string{"1A", "2B"} {
+		must(t, s.SaveStatement(ctx, storage.StatementEntry{ProblemID: problemID, Statement: "statement " + problemID}))
+		session, err := s.CreateSession(ctx, storage.Session{ProblemID: problemID, StartedAt: base, LastSeenAt: base.Add(2 * time.Second)})
+		must(t, err)
+		for i := range 3 {
+			_, err := s.SaveSnapshot(ctx, storage.Snapshot{SessionID: session.ID, ProblemID: problemID, Timestamp: base.Add(time.Duration(i) * time.Second), Code: "code"})
+			must(t, err)
+			must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ID: storage.NewID(), SessionID: session.ID, ProblemID: problemID, Timestamp: base.Add(time.Duration(i) * time.Second)}))
+		}
+		must(t, s.SaveHint(ctx, storage.HintEntry{ID: storage.NewID(), SessionID: session.ID, ProblemID: problemID, Level: "nudge", Timestamp: base, Hint: "think about " + problemID}))
+		for range 2 {
+			_, err := s.SaveSummary(ctx, storage.Summary{ProblemID: problemID, Timestamp: base})
+			must(t, err)
+		}
+	}
+	return s
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, gzip := range []bool{false, true} {
+		var buf bytes.Buffer
+		src := seed(t)
+		exported, err := archive.Export(t.Context(), src, &buf, archive.Options{Gzip: gzip})
+		must(t, err)
+		want := archive.Stats{Statements: 2, Snapshots: 6, Feedbacks: 6, Sessions: 2, Hints: 2, Summaries: 4}
+		if exported != want {
+			t.Fatalf("Export (gzip %v) = %+v, want %+v", gzip, exported, want)
+		}
+
+		dst := storage.NewMemoryStore()
+		imported, err := archive.Import(t.Context(), dst, bytes.NewReader(buf.Bytes()), archive.Options{})
+		must(t, err)
+		if imported != want {
+			t.Fatalf("Import (gzip %v) = %+v, want %+v", gzip, imported, want)
+		}
+
+		again, err := archive.Import(t.Context(), dst, bytes.NewReader(buf.Bytes()), archive.Options{})
+		must(t, err)
+		if again != (archive.Stats{Skipped: 22}) {
+			t.Fatalf("second Import (gzip %v) = %+v, want everything skipped", gzip, again)
+		}
+
+		for _, problemID := range []string{"1A", "2B"} {
+			wantSessions, err := src.GetSessionsByProblemID(t.Context(), "", problemID)
+			must(t, err)
+			gotSessions, err := dst.GetSessionsByProblemID(t.Context(), "", problemID)
+			must(t, err)
+			if len(gotSessions) != 1 || gotSessions[0].ID != wantSessions[0].ID || !gotSessions[0].LastSeenAt.Equal(wantSessions[0].LastSeenAt) {
+				t.Fatalf("imported sessions of %s = %+v, want %+v", problemID, gotSessions, wantSessions)
+			}
+			if gotSessions[0].Token == "" || gotSessions[0].Token == wantSessions[0].Token {
+				t.Fatalf("imported session of %s has token %q, want a new one", problemID, gotSessions[0].Token)
+			}
+			wantHints, err := src.GetHintsByProblemID(t.Context(), "", problemID)
+			must(t, err)
+			gotHints, err := dst.GetHintsByProblemID(t.Context(), "", problemID)
+			must(t, err)
+			if len(gotHints) != 1 || gotHints[0].ID != wantHints[0].ID || gotHints[0].Hint != wantHints[0].Hint || gotHints[0].SessionID != gotSessions[0].ID {
+				t.Fatalf("imported hints of %s = %+v, want %+v", problemID, gotHints, wantHints)
+			}
+		}
+	}
+}
+
+func TestProblemFilter(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := archive.Export(t.Context(), seed(t), &buf, archive.Options{ProblemIDs: []string{"2B"}})
+	must(t, err)
+
+	dst := storage.NewMemoryStore()
+	imported, err := archive.Import(t.Context(), dst, &buf, archive.Options{})
+	must(t, err)
+	if want := (archive.Stats{Statements: 1, Snapshots: 3, Feedbacks: 3, Sessions: 1, Hints: 1, Summaries: 2}); imported != want {
+		t.Fatalf("Import = %+v, want %+v", imported, want)
+	}
+	if _, err := dst.GetStatement(t.Context(), "1A"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetStatement(1A) returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestMergeRenumbers(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := archive.Export(t.Context(), seed(t), &buf, archive.Options{ProblemIDs: []string{"1A"}})
+	must(t, err)
+
+	// A second install with its own history of 1A.
+	dst := seed(t)
+	imported, err := archive.Import(t.Context(), dst, &buf, archive.Options{})
+	must(t, err)
+	if want := (archive.Stats{Snapshots: 3, Feedbacks: 3, Sessions: 1, Hints: 1, Summaries: 2, Skipped: 1}); imported != want {
+		t.Fatalf("Import = %+v, want %+v", imported, want)
+	}
+	latest, err := dst.GetLatestSnapshot(t.Context(), "", "1A")
+	must(t, err)
+	if latest.Seq != 6 {
+		t.Fatalf("latest snapshot seq = %d, want 6", latest.Seq)
+	}
+	history, err := dst.GetSummaryHistory(t.Context(), "", "1A")
+	must(t, err)
+	if len(history) != 4 {
+		t.Fatalf("summary history has %d versions, want 4", len(history))
+	}
+}
+
+func TestRejectsNewerVersion(t *testing.T) {
+	input := `{"kind":"header","data":{"format":"coach_demon","version":99}}` + "\n"
+	_, err := archive.Import(t.Context(), storage.NewMemoryStore(), strings.NewReader(input), archive.Options{})
+	if !errors.Is(err, archive.ErrUnsupportedVersion) {
+		t.Fatalf("Import returned %v, want ErrUnsupportedVersion", err)
+	}
+
+	_, err = archive.Import(t.Context(), storage.NewMemoryStore(), strings.NewReader("{}\n"), archive.Options{})
+	if !errors.Is(err, archive.ErrMalformed) {
+		t.Fatalf("Import without a header returned %v, want ErrMalformed", err)
+	}
+}
@@ -0,0 +1,192 @@
+// Package diff compares code snapshots line by line.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Normalize splits text into lines with whitespace runs collapsed and blank
+// lines dropped, so reindenting or adding empty lines is not a change.
+func Normalize(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Ratio returns how much b differs from a after normalization, from 0 for
+// identical texts to 1 for texts without a common line.
+func Ratio(a, b string) float64 {
+	la, lb := Normalize(a), Normalize(b)
+	total := len(la) + len(lb)
+	if total == 0 {
+		return 0
+	}
+	common := lcs(la, lb)
+	return float64(total-2*common) / float64(total)
+}
+
+// lcs returns the length of the longest common subsequence of a and b.
+func lcs(a, b []string) int {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				cur[j] = prev[j-1] + 1
+			case prev[j] >= cur[j-1]:
+				cur[j] = prev[j]
+			default:
+				cur[j] = cur[j-1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// op is one line of an edit script: ' ' kept, '-' removed from a, '+' added
+// from b. ai and bi are the 0-based positions in a and b before the line.
+type op struct {
+	kind   byte
+	text   string
+	ai, bi int
+}
+
+// Unified returns the line diff from a to b in unified format, with context
+// unchanged lines around every change and without file headers. It is "" when
+// a and b have the same lines. Lines are compared exactly.
+func Unified(a, b string, context int) string {
+	ops := editScript(splitLines(a), splitLines(b))
+	var out strings.Builder
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start, end := max(0, i-context), i
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				break
+			}
+			end = next
+		}
+		stop := min(len(ops), end+context)
+		writeHunk(&out, ops[start:stop])
+		i = stop
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, hunk []op) {
+	var aCount, bCount int
+	for _, o := range hunk {
+		if o.kind != '+' {
+			aCount++
+		}
+		if o.kind != '-' {
+			bCount++
+		}
+	}
+	aStart, bStart := hunk[0].ai, hunk[0].bi
+	if aCount > 0 {
+		aStart++
+	}
+	if bCount > 0 {
+		bStart++
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+	for _, o := range hunk {
+		out.WriteByte(o.kind)
+		out.WriteString(o.text)
+		out.WriteByte('\n')
+	}
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// editScript returns a shortest edit script turning a into b. The common
+// prefix and suffix are split off first, as edits between two snapshots are
+// usually local.
+func editScript(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lengths[i][j] is the LCS length of ma[i:] and mb[j:].
+	lengths := make([][]int, len(ma)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]op, 0, len(a)+len(b)-len(ma)-len(mb))
+	ai, bi := 0, 0
+	emit := func(kind byte, text string) {
+		ops = append(ops, op{kind: kind, text: text, ai: ai, bi: bi})
+		if kind != '+' {
+			ai++
+		}
+		if kind != '-' {
+			bi++
+		}
+	}
+	for _, line := range a[:prefix] {
+		emit(' ', line)
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			emit(' ', ma[i])
+			i, j = i+1, j+1
+		case j == len(mb) || (i < len(ma) && lengths[i+1][j] >= lengths[i][j+1]):
+			emit('-', ma[i])
+			i++
+		default:
+			emit('+', mb[j])
+			j++
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		emit(' ', line)
+	}
+	return ops
+}
@@ -0,0 +1,44 @@
+package diff
+
+import "testing"
+
+func TestRatio(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 0},
+		{"int a;\nint b;", "int  a;\n\n  int b;\n", 0},
+		{"a\nb", "c\nd", 1},
+		{"a\nb\nc\nd", "a\nb\nc\ne", 0.25},
+	}
+	for _, tt := range tests {
+		if got := Ratio(tt.a, tt.b); got != tt.want {
+			t.Errorf("Ratio(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	const a = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"same", a, a, ""},
+		{"one change", a, "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n",
+			"@@ -4,3 +4,3 @@\n 4\n-5\n+five\n 6\n"},
+		{"nearby changes share a hunk", a, "one\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n",
+			"@@ -1,5 +1,5 @@\n-1\n+one\n 2\n 3\n-4\n+four\n 5\n"},
+		{"distant changes", a, "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			"@@ -1,2 +1,2 @@\n-1\n+one\n 2\n@@ -9,2 +9,2 @@\n 9\n-10\n+ten\n"},
+		{"append", a, a + "11\n", "@@ -10,1 +10,2 @@\n 10\n+11\n"},
+		{"from nothing", "", "x\ny", "@@ -0,0 +1,2 @@\n+x\n+y\n"},
+	}
+	for _, tt := range tests {
+		if got := Unified(tt.a, tt.b, 1); got != tt.want {
+			t.Errorf("%s: Unified = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,16 +3,19 @@ package fetcher
 import (
 	"coach_demon/pkg/codeforces"
 	"context"
+	"net/http"
 )
 
 // Browserless wraps the /content endpoint of browserless/chrome.
 type Browserless struct {
 	BaseURL string // http://fetcher:3000
 	Token   string // "cf-fun"
+	// HTTPClient sends the requests; nil uses http.DefaultClient.
+	HTTPClient *http.Client
 }
 
 func (b *Browserless) Fetch(ctx context.Context, id string) (string, error) {
-	return codeforces.FetchStatement(ctx, b.BaseURL, id)
+	return codeforces.FetchStatement(ctx, b.HTTPClient, b.BaseURL, id)
 }
 
 // Constructor, so callers never new() directly.
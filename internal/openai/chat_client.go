@@ -0,0 +1,150 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
+)
+
+// ChatClient talks to a server implementing the OpenAI chat completions API,
+// such as Ollama, llama.cpp server or vLLM. Few of them enforce JSON schemas,
+// so it asks for JSON mode and describes the schema in the system message.
+type ChatClient struct {
+	api          openai.Client
+	model        string
+	systemPrompt string
+	temperature  float64
+	timeout      time.Duration
+}
+
+// NewChatClient connects to the server at cfg.BaseURL, e.g.
+// "http://localhost:11434/v1". The API key is optional.
+func NewChatClient(cfg Config, client option.HTTPClient) (*ChatClient, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("chat completions base URL missing")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("chat completions model missing")
+	}
+	if cfg.Temperature <= 0 || cfg.Temperature > 1 {
+		cfg.Temperature = 0.2
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 60 * time.Second
+	}
+
+	// Never send an OPENAI_API_KEY from the environment to another server.
+	auth := option.WithHeaderDel("authorization")
+	if cfg.APIKey != "" {
+		auth = option.WithAPIKey(cfg.APIKey)
+	}
+	api := openai.NewClient(
+		option.WithBaseURL(cfg.BaseURL),
+		auth,
+		option.WithHTTPClient(client),
+	)
+
+	return &ChatClient{
+		api:          api,
+		model:        cfg.Model,
+		systemPrompt: cfg.SystemPrompt,
+		temperature:  cfg.Temperature,
+		timeout:      cfg.Timeout,
+	}, nil
+}
+
+func (c *ChatClient) GetFeedback(ctx context.Context, prompt Prompt) (Feedback, error) {
+	raw, err := c.complete(ctx, c.params(FeedbackResponseSchema, prompt))
+	if err != nil {
+		return Feedback{}, err
+	}
+	return parseFeedback(raw)
+}
+
+func (c *ChatClient) StreamFeedback(ctx context.Context, prompt Prompt, onDelta func(FeedbackDelta)) (Feedback, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	stream := c.api.Chat.Completions.NewStreaming(ctx, c.params(FeedbackResponseSchema, prompt))
+	defer stream.Close()
+
+	var fields fieldStreamer
+	var raw strings.Builder
+	for stream.Next() {
+		chunk := stream.Current()
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta.Content
+		raw.WriteString(delta)
+		for _, d := range fields.Write(delta) {
+			onDelta(d)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return Feedback{}, fmt.Errorf("failed to stream chat completions API: %w", err)
+	}
+
+	return parseFeedback(raw.String())
+}
+
+func (c *ChatClient) GetHint(ctx context.Context, level HintLevel, prompt Prompt) (Hint, error) {
+	spec, ok := hintSpecs[level]
+	if !ok {
+		return Hint{}, fmt.Errorf("unknown hint level %q", level)
+	}
+	raw, err := c.complete(ctx, c.params(spec.schema, prompt))
+	if err != nil {
+		return Hint{}, err
+	}
+	return parseHint(level, raw)
+}
+
+func (c *ChatClient) SummarizeFeedback(ctx context.Context, prompt Prompt) (Summary, error) {
+	raw, err := c.complete(ctx, c.params(SummarySchema, prompt))
+	if err != nil {
+		return Summary{}, err
+	}
+	return parseSummary(raw)
+}
+
+func (c *ChatClient) complete(ctx context.Context, params openai.ChatCompletionNewParams) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.api.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to call chat completions API: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("chat completions API returned no choices")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+func (c *ChatClient) params(schema map[string]any, prompt Prompt) openai.ChatCompletionNewParams {
+	return openai.ChatCompletionNewParams{
+		Model: c.model,
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(jsonModePrompt(prompt.system(c.systemPrompt), schema)),
+			openai.UserMessage(prompt.User),
+		},
+		Temperature: openai.Float(c.temperature),
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+		},
+	}
+}
+
+// jsonModePrompt appends the output schema to the system prompt; JSON mode
+// only guarantees valid JSON, not its shape.
+func jsonModePrompt(systemPrompt string, schema map[string]any) string {
+	raw, _ := json.Marshal(schema)
+	return strings.TrimSpace(systemPrompt + "\n\nAnswer with a single JSON object, and nothing else, matching this JSON schema:\n" + string(raw))
+}
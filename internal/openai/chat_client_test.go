@@ -0,0 +1,185 @@
+package openai_test
+
+import (
+	"coach_demon/internal/openai"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// chatRequest is the part of a chat completions request the server checks.
+type chatRequest struct {
+	Model          string `json:"model"`
+	Stream         bool   `json:"stream"`
+	ResponseFormat struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+}
+
+// chatServer answers every chat completion with content, streamed in two
+// chunks when asked to, and records the last request.
+func chatServer(t *testing.T, content string, last *chatRequest, auth *string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		*auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(last); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !last.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"id": "c1", "object": "chat.completion", "model": last.Model,
+				"choices": []map[string]any{{
+					"index": 0, "finish_reason": "stop",
+					"message": map[string]any{"role": "assistant", "content": content},
+				}},
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		half := len(content) / 2
+		for _, part := range []string{content[:half], content[half:]} {
+			chunk, _ := json.Marshal(map[string]any{
+				"id": "c1", "object": "chat.completion.chunk", "model": last.Model,
+				"choices": []map[string]any{{"index": 0, "delta": map[string]any{"content": part}}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/v1"
+}
+
+func TestChatClientFeedback(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-not-for-local-servers")
+	want := openai.Feedback{Feedback: "Sort first.", Proof: "Exchange argument.", OptimalMetaCognition: "Look for an order."}
+	raw, _ := json.Marshal(want)
+
+	var req chatRequest
+	var auth string
+	client, err := openai.NewChatClient(openai.Config{
+		BaseURL:      chatServer(t, string(raw), &req, &auth),
+		Model:        "qwen2.5-coder",
+		SystemPrompt: "You are a coach.",
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("NewChatClient: %v", err)
+	}
+
+	got, err := client.GetFeedback(t.Context(), openai.Prompt{User: "Problem statement:\nTheatre Square"})
+	if err != nil || got != want {
+		t.Fatalf("GetFeedback = %+v, %v; want %+v", got, err, want)
+	}
+	if req.Model != "qwen2.5-coder" || req.ResponseFormat.Type != "json_object" {
+		t.Errorf("request model %q, response format %q; want qwen2.5-coder in JSON mode", req.Model, req.ResponseFormat.Type)
+	}
+	if len(req.Messages) != 2 || !strings.Contains(req.Messages[0].Content, `"optima_meta_cognition"`) ||
+		!strings.Contains(req.Messages[1].Content, "Theatre Square") {
+		t.Errorf("messages = %+v; want the schema in the system message and the problem in the user message", req.Messages)
+	}
+	if auth != "" {
+		t.Errorf("Authorization = %q; want none without an API key", auth)
+	}
+
+	var streamed strings.Builder
+	got, err = client.StreamFeedback(t.Context(), openai.Prompt{User: "Theatre Square"}, func(d openai.FeedbackDelta) {
+		if d.Field == openai.FieldFeedback {
+			streamed.WriteString(d.Text)
+		}
+	})
+	if err != nil || got != want || streamed.String() != want.Feedback {
+		t.Fatalf("StreamFeedback = %+v, %v, streamed %q; want %+v", got, err, streamed.String(), want)
+	}
+}
+
+func TestChatClientHintAndSummary(t *testing.T) {
+	var req chatRequest
+	var auth string
+	url := chatServer(t, `{"hint":"Count tiles per side.","observation":"Sides are independent."}`, &req, &auth)
+	client, err := openai.NewChatClient(openai.Config{BaseURL: url, Model: "llama3", APIKey: "local"}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("NewChatClient: %v", err)
+	}
+
+	hint, err := client.GetHint(t.Context(), openai.HintObservation, openai.Prompt{System: "Be brief.", User: "Theatre Square"})
+	if err != nil || hint.Level != openai.HintObservation || hint.Observation != "Sides are independent." {
+		t.Fatalf("GetHint = %+v, %v", hint, err)
+	}
+	if auth != "Bearer local" {
+		t.Errorf("Authorization = %q; want the configured key", auth)
+	}
+	if !strings.HasPrefix(req.Messages[0].Content, "Be brief.\n") {
+		t.Errorf("system message = %q; want the prompt's system text", req.Messages[0].Content)
+	}
+
+	// Models ignoring JSON mode still yield their raw answer.
+	url = chatServer(t, "Sort the tiles.", &req, &auth)
+	client, err = openai.NewChatClient(openai.Config{BaseURL: url, Model: "llama3"}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("NewChatClient: %v", err)
+	}
+	summary, err := client.SummarizeFeedback(t.Context(), openai.Prompt{User: "Feedback #1:\na"})
+	if err == nil || summary.Feedback != "Sort the tiles." {
+		t.Fatalf("SummarizeFeedback = %+v, %v; want the raw answer and an error", summary, err)
+	}
+	if req.Messages[1].Content != "Feedback #1:\na" {
+		t.Errorf("user message = %q; want the prompt", req.Messages[1].Content)
+	}
+}
+
+func TestNewChatClientConfig(t *testing.T) {
+	if _, err := openai.NewChatClient(openai.Config{Model: "llama3"}, http.DefaultClient); err == nil {
+		t.Error("NewChatClient without base URL succeeded")
+	}
+	if _, err := openai.NewChatClient(openai.Config{BaseURL: "http://localhost:11434/v1"}, http.DefaultClient); err == nil {
+		t.Error("NewChatClient without model succeeded")
+	}
+	if _, err := openai.NewProvider("claude", openai.Config{}, http.DefaultClient); err == nil {
+		t.Error("NewProvider with an unknown name succeeded")
+	}
+}
+
+func TestFake(t *testing.T) {
+	provider, err := openai.NewProvider(openai.ProviderFake, openai.Config{}, nil)
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	prompt := openai.Prompt{User: "Theatre Square\nn m a\n"}
+	first, err := provider.GetFeedback(t.Context(), prompt)
+	if err != nil {
+		t.Fatalf("GetFeedback: %v", err)
+	}
+	var deltas []openai.FeedbackDelta
+	second, err := provider.StreamFeedback(t.Context(), prompt, func(d openai.FeedbackDelta) {
+		deltas = append(deltas, d)
+	})
+	if err != nil || second != first || len(deltas) != 3 || deltas[0].Text != first.Feedback {
+		t.Fatalf("StreamFeedback = %+v, %v, %+v; want %+v in three deltas", second, err, deltas, first)
+	}
+	if first.Feedback != "Feedback on a prompt of 2 lines." {
+		t.Errorf("Feedback = %q", first.Feedback)
+	}
+
+	for _, level := range openai.HintLevels {
+		hint, err := provider.GetHint(t.Context(), level, prompt)
+		if err != nil || hint.Level != level || hint.Hint == "" {
+			t.Errorf("GetHint(%s) = %+v, %v", level, hint, err)
+		}
+	}
+	if _, err := provider.GetHint(t.Context(), "solution", prompt); err == nil {
+		t.Error("GetHint with an unknown level succeeded")
+	}
+}
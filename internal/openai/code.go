@@ -0,0 +1,180 @@
+package openai
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// SourceFile is one file of the user's code.
+type SourceFile struct {
+	Path     string // may be empty for a single unnamed buffer
+	Language string // editor language identifier, e.g. "C++", "python", "JAVA"
+	Content  string
+}
+
+// Cursor is the caret position, 1-based.
+type Cursor struct {
+	Path   string
+	Line   int
+	Column int
+}
+
+// Code is the user's source code as sent by the editor.
+type Code struct {
+	Files  []SourceFile
+	Cursor *Cursor
+}
+
+// PlainCode wraps a single code string of unknown language.
+func PlainCode(code string) Code {
+	if code == "" {
+		return Code{}
+	}
+	return Code{Files: []SourceFile{{Content: code}}}
+}
+
+// fenceLanguages maps editor language identifiers and file extensions to
+// Markdown fence tags.
+var fenceLanguages = map[string]string{
+	"c": "c", "h": "c",
+	"c++": "cpp", "cpp": "cpp", "cc": "cpp", "cxx": "cpp", "hpp": "cpp", "hh": "cpp", "objectivec": "cpp",
+	"c#": "csharp", "csharp": "csharp", "cs": "csharp",
+	"java":   "java",
+	"kotlin": "kotlin", "kt": "kotlin", "kts": "kotlin",
+	"python": "python", "python3": "python", "py": "python", "pypy": "python",
+	"go": "go", "golang": "go",
+	"rust": "rust", "rs": "rust",
+	"javascript": "javascript", "js": "javascript",
+	"typescript": "typescript", "ts": "typescript",
+	"haskell": "haskell", "hs": "haskell",
+	"ocaml": "ocaml", "ml": "ocaml",
+	"scala": "scala",
+	"ruby":  "ruby", "rb": "ruby",
+	"pascal": "pascal", "pas": "pascal",
+	"d": "d",
+}
+
+// FenceLanguage returns the Markdown fence tag for a file, from its language
+// identifier or else its extension, or "" if unknown.
+func FenceLanguage(language, filePath string) string {
+	if tag, ok := fenceLanguages[strings.ToLower(strings.TrimSpace(language))]; ok {
+		return tag
+	}
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(filePath)), ".")
+	return fenceLanguages[ext]
+}
+
+// Render formats the code for a prompt: one fenced block per file with its
+// path and language, and the cursor position when known.
+func (c Code) Render() string {
+	if len(c.Files) == 0 {
+		return "(no code yet)"
+	}
+
+	var b strings.Builder
+	for i, f := range c.Files {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		lang := FenceLanguage(f.Language, f.Path)
+		if f.Path != "" || lang != "" {
+			b.WriteString("File: ")
+			b.WriteString(cmp.Or(f.Path, "(unnamed)"))
+			if lang != "" {
+				fmt.Fprintf(&b, " (%s)", lang)
+			}
+			if c.Cursor != nil && (c.Cursor.Path == f.Path || len(c.Files) == 1) {
+				fmt.Fprintf(&b, ", cursor at line %d, column %d", c.Cursor.Line, c.Cursor.Column)
+			}
+			b.WriteString("\n")
+		}
+
+		fence := "```"
+		for strings.Contains(f.Content, fence) {
+			fence += "`"
+		}
+		b.WriteString(fence + lang + "\n")
+		b.WriteString(strings.TrimRight(f.Content, "\n"))
+		b.WriteString("\n" + fence + "\n")
+	}
+	return b.String()
+}
+
+// Language returns the language identifier of the first file naming one.
+func (c Code) Language() string {
+	for _, f := range c.Files {
+		if f.Language != "" {
+			return f.Language
+		}
+	}
+	return ""
+}
+
+// Text returns the code as plain text, with a header line per file when
+// there are several.
+func (c Code) Text() string {
+	if len(c.Files) == 1 {
+		return c.Files[0].Content
+	}
+	var b strings.Builder
+	for _, f := range c.Files {
+		fmt.Fprintf(&b, "// file: %s\n%s\n", f.Path, f.Content)
+	}
+	return b.String()
+}
+
+// Excerpt returns the code cut to about lines lines in total. The file with
+// the cursor, or else the first file, keeps the lines around the cursor and
+// the other files their beginnings; every cut is marked in the code so the
+// model knows what it does not see.
+func (c Code) Excerpt(lines int) Code {
+	excerpt := Code{Files: slices.Clone(c.Files), Cursor: c.Cursor}
+	focus, cursor := 0, 0
+	for i, f := range c.Files {
+		if c.Cursor != nil && (c.Cursor.Path == f.Path || len(c.Files) == 1) {
+			focus, cursor = i, c.Cursor.Line
+			break
+		}
+	}
+	order := make([]int, 0, len(c.Files))
+	if len(c.Files) > 0 {
+		order = append(order, focus)
+	}
+	for i := range c.Files {
+		if i != focus {
+			order = append(order, i)
+		}
+	}
+
+	remaining := max(lines, 0)
+	for _, i := range order {
+		f := &excerpt.Files[i]
+		fileLines := strings.Split(strings.TrimRight(f.Content, "\n"), "\n")
+		if len(fileLines) <= remaining {
+			remaining -= len(fileLines)
+			continue
+		}
+		start := 0
+		if i == focus && cursor > 0 {
+			start = min(max(cursor-1-remaining/2, 0), len(fileLines)-remaining)
+		}
+		var kept []string
+		if start > 0 {
+			kept = append(kept, omitted(start))
+		}
+		kept = append(kept, fileLines[start:start+remaining]...)
+		if rest := len(fileLines) - start - remaining; rest > 0 {
+			kept = append(kept, omitted(rest))
+		}
+		f.Content = strings.Join(kept, "\n") + "\n"
+		remaining = 0
+	}
+	return excerpt
+}
+
+func omitted(lines int) string {
+	return fmt.Sprintf("[… %d lines omitted …]", lines)
+}
@@ -0,0 +1,54 @@
+package openai_test
+
+import (
+	"coach_demon/internal/openai"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestExcerpt(t *testing.T) {
+	code := openai.Code{
+		Files: []openai.SourceFile{
+			{Path: "template.h", Content: numberedLines(10)},
+			{Path: "main.cpp", Content: numberedLines(100)},
+		},
+		Cursor: &openai.Cursor{Path: "main.cpp", Line: 50, Column: 1},
+	}
+
+	if got := code.Excerpt(200); got.Text() != code.Text() {
+		t.Errorf("Excerpt of code within the limit changed it:\n%s", got.Text())
+	}
+
+	got := code.Excerpt(12)
+	main := "[… 43 lines omitted …]\n" + strings.TrimPrefix(numberedLines(55), numberedLines(43)) + "[… 45 lines omitted …]\n"
+	if got.Files[1].Content != main {
+		t.Errorf("cursor file excerpt =\n%s\nwant\n%s", got.Files[1].Content, main)
+	}
+	if want := "[… 10 lines omitted …]\n"; got.Files[0].Content != want {
+		t.Errorf("other file excerpt = %q, want %q", got.Files[0].Content, want)
+	}
+	if code.Files[1].Content != numberedLines(100) {
+		t.Error("Excerpt modified the code")
+	}
+}
+
+func TestPromptBudget(t *testing.T) {
+	for model, want := range map[string]int{
+		"gpt-4":             6144,
+		"gpt-4o-2024-08-06": 128000 - 16384,
+		"qwen2.5-coder:14b": openai.DefaultContextWindow * 3 / 4,
+	} {
+		if got := openai.PromptBudget(model); got != want {
+			t.Errorf("PromptBudget(%q) = %d, want %d", model, got, want)
+		}
+	}
+}
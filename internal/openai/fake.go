@@ -0,0 +1,68 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Fake is a Provider that answers without a model, for tests and offline
+// development. Its answers depend only on the prompt, so equal prompts get
+// equal answers.
+type Fake struct{}
+
+func (Fake) GetFeedback(_ context.Context, prompt Prompt) (Feedback, error) {
+	return Feedback{
+		Feedback:             fmt.Sprintf("Feedback on a prompt of %d lines.", countLines(prompt.User)),
+		Proof:                fmt.Sprintf("Proof for %q.", firstLine(prompt.User)),
+		OptimalMetaCognition: fmt.Sprintf("Reread %q before coding.", firstLine(prompt.User)),
+	}, nil
+}
+
+// StreamFeedback delivers each field of the GetFeedback answer as one delta.
+func (f Fake) StreamFeedback(ctx context.Context, prompt Prompt, onDelta func(FeedbackDelta)) (Feedback, error) {
+	fb, err := f.GetFeedback(ctx, prompt)
+	if err != nil {
+		return Feedback{}, err
+	}
+	onDelta(FeedbackDelta{Field: FieldFeedback, Text: fb.Feedback})
+	onDelta(FeedbackDelta{Field: FieldProof, Text: fb.Proof})
+	onDelta(FeedbackDelta{Field: FieldOptimalMetaCognition, Text: fb.OptimalMetaCognition})
+	return fb, nil
+}
+
+func (Fake) GetHint(_ context.Context, level HintLevel, prompt Prompt) (Hint, error) {
+	if _, ok := hintSpecs[level]; !ok {
+		return Hint{}, fmt.Errorf("unknown hint level %q", level)
+	}
+	hint := Hint{Level: level, Hint: fmt.Sprintf("A %s for %q.", level, firstLine(prompt.User))}
+	switch level {
+	case HintObservation:
+		hint.Observation = "Observation."
+	case HintOutline:
+		hint.Outline, hint.Complexity = "1. Outline.", "O(n)"
+	case HintProof:
+		hint.Outline, hint.Proof, hint.Complexity = "1. Outline.", "Proof.", "O(n)"
+	}
+	return hint, nil
+}
+
+func (Fake) SummarizeFeedback(_ context.Context, prompt Prompt) (Summary, error) {
+	return Summary{
+		Feedback:             fmt.Sprintf("Summary of a prompt of %d lines.", countLines(prompt.User)),
+		Proof:                fmt.Sprintf("Summary of %q.", firstLine(prompt.User)),
+		OptimalMetaCognition: "Summary of the optimal meta cognitions.",
+	}, nil
+}
+
+func countLines(text string) int {
+	if text == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
@@ -0,0 +1,142 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+)
+
+// HintLevel is how much help the user asks for, from least to most.
+type HintLevel string
+
+const (
+	HintNudge       HintLevel = "nudge"       // a question pointing in the right direction
+	HintObservation HintLevel = "observation" // the key observation of the problem
+	HintOutline     HintLevel = "outline"     // the algorithm, step by step
+	HintProof       HintLevel = "proof"       // the full solution with a proof of correctness
+)
+
+// HintLevels lists the levels in escalation order.
+var HintLevels = []HintLevel{HintNudge, HintObservation, HintOutline, HintProof}
+
+// ParseHintLevel validates a level name.
+func ParseHintLevel(s string) (HintLevel, error) {
+	for _, l := range HintLevels {
+		if string(l) == s {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unknown hint level %q, expected one of %v", s, HintLevels)
+}
+
+// Hint is a structured hint. Fields beyond Hint are only filled at the
+// levels that ask for them.
+type Hint struct {
+	Level       HintLevel `json:"-"`
+	Hint        string    `json:"hint"`
+	Observation string    `json:"observation,omitempty"`
+	Outline     string    `json:"outline,omitempty"`
+	Proof       string    `json:"proof,omitempty"`
+	Complexity  string    `json:"complexity,omitempty"`
+}
+
+type nudgeHint struct {
+	Hint string `json:"hint" jsonschema_description:"One short question or pointer that moves me forward without revealing the key idea"`
+}
+
+type observationHint struct {
+	Hint        string `json:"hint" jsonschema_description:"One sentence telling me what to look at"`
+	Observation string `json:"observation" jsonschema_description:"The key observation that unlocks the problem, without the algorithm"`
+}
+
+type outlineHint struct {
+	Hint       string `json:"hint" jsonschema_description:"One sentence summary of the approach"`
+	Outline    string `json:"outline" jsonschema_description:"The algorithm as numbered steps, without code"`
+	Complexity string `json:"complexity" jsonschema_description:"Time and memory complexity of the algorithm"`
+}
+
+type proofHint struct {
+	Hint       string `json:"hint" jsonschema_description:"One sentence summary of the solution"`
+	Outline    string `json:"outline" jsonschema_description:"The algorithm as numbered steps"`
+	Proof      string `json:"proof" jsonschema_description:"A complete proof that the algorithm is correct"`
+	Complexity string `json:"complexity" jsonschema_description:"Time and memory complexity of the algorithm"`
+}
+
+type hintSpec struct {
+	instruction string
+	schema      map[string]any
+}
+
+var hintSpecs = map[HintLevel]hintSpec{
+	HintNudge: {
+		instruction: "Give me the smallest possible nudge. Do not reveal the key observation, the algorithm or any code.",
+		schema:      GenerateSchema[nudgeHint](),
+	},
+	HintObservation: {
+		instruction: "Tell me the key observation I am missing. Do not describe the full algorithm or write code.",
+		schema:      GenerateSchema[observationHint](),
+	},
+	HintOutline: {
+		instruction: "Outline the algorithm step by step and state its complexity. Do not write code.",
+		schema:      GenerateSchema[outlineHint](),
+	},
+	HintProof: {
+		instruction: "Explain the full solution and prove it correct rigorously. Do not write code.",
+		schema:      GenerateSchema[proofHint](),
+	},
+}
+
+// HintInstruction tells the model what to reveal at level, "" for an
+// unknown level.
+func HintInstruction(level HintLevel) string {
+	return hintSpecs[level].instruction
+}
+
+// GetHint asks for help at the given level.
+func (c *Client) GetHint(ctx context.Context, level HintLevel, prompt Prompt) (Hint, error) {
+	spec, ok := hintSpecs[level]
+	if !ok {
+		return Hint{}, fmt.Errorf("unknown hint level %q", level)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.api.Responses.New(ctx, responses.ResponseNewParams{
+		Model:        c.model,
+		Instructions: openai.String(prompt.system(c.systemPrompt)),
+		Input: responses.ResponseNewParamsInputUnion{
+			OfString: openai.String(prompt.User),
+		},
+		Text: responses.ResponseTextConfigParam{
+			Format: responses.ResponseFormatTextConfigUnionParam{
+				OfJSONSchema: &responses.ResponseFormatTextJSONSchemaConfigParam{
+					Name:        "coach_hint_" + string(level),
+					Schema:      spec.schema,
+					Description: openai.String("Structured coach hint"),
+					Strict:      openai.Bool(true),
+					Type:        "json_schema",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return Hint{}, fmt.Errorf("failed to call OpenAI API for hint: %w", err)
+	}
+
+	return parseHint(level, resp.OutputText())
+}
+
+func parseHint(level HintLevel, raw string) (Hint, error) {
+	hint := Hint{Level: level}
+	err := json.Unmarshal([]byte(raw), &hint)
+	if err != nil {
+		hint.Hint = raw
+		return hint, fmt.Errorf("failed to unmarshal OpenAI JSON hint: %w", err)
+	}
+
+	return hint, nil
+}
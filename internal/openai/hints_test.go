@@ -0,0 +1,119 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseHintLevel(t *testing.T) {
+	for _, level := range HintLevels {
+		if got, err := ParseHintLevel(string(level)); err != nil || got != level {
+			t.Errorf("ParseHintLevel(%q) = %q, %v", level, got, err)
+		}
+	}
+	for _, name := range []string{"", "Nudge", "solution", "proof "} {
+		if got, err := ParseHintLevel(name); err == nil {
+			t.Errorf("ParseHintLevel(%q) = %q, want an error", name, got)
+		}
+	}
+}
+
+// hintAPI answers every Responses API call with output and keeps the last
+// request body.
+type hintAPI struct {
+	output  string
+	request map[string]any
+}
+
+func (a *hintAPI) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	a.request = nil
+	if err := json.Unmarshal(body, &a.request); err != nil {
+		return nil, err
+	}
+	text, _ := json.Marshal(a.output)
+	resp := `{"id":"resp_1","object":"response","created_at":0,"model":"o3","status":"completed","output":[` +
+		`{"type":"message","id":"msg_1","status":"completed","role":"assistant","content":[` +
+		`{"type":"output_text","annotations":[],"text":` + string(text) + `}]}]}`
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(resp)),
+		Request:    r,
+	}, nil
+}
+
+func TestGetHintEscalates(t *testing.T) {
+	tests := []struct {
+		level  HintLevel
+		fields []string // schema properties, in addition to hint
+		output string
+		want   Hint
+	}{
+		{
+			level:  HintNudge,
+			output: `{"hint":"What if n is 1?"}`,
+			want:   Hint{Level: HintNudge, Hint: "What if n is 1?"},
+		},
+		{
+			level:  HintObservation,
+			fields: []string{"observation"},
+			output: `{"hint":"Look at the rows.","observation":"Rows and columns are independent."}`,
+			want:   Hint{Level: HintObservation, Hint: "Look at the rows.", Observation: "Rows and columns are independent."},
+		},
+		{
+			level:  HintOutline,
+			fields: []string{"outline", "complexity"},
+			output: `{"hint":"Count per axis.","outline":"1. ceil(n/a)","complexity":"O(1)"}`,
+			want:   Hint{Level: HintOutline, Hint: "Count per axis.", Outline: "1. ceil(n/a)", Complexity: "O(1)"},
+		},
+		{
+			level:  HintProof,
+			fields: []string{"outline", "proof", "complexity"},
+			output: `{"hint":"Multiply.","outline":"1. ceil(n/a)","proof":"Each axis needs ceil.","complexity":"O(1)"}`,
+			want:   Hint{Level: HintProof, Hint: "Multiply.", Outline: "1. ceil(n/a)", Proof: "Each axis needs ceil.", Complexity: "O(1)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.level), func(t *testing.T) {
+			api := &hintAPI{output: tt.output}
+			c, err := NewClient(Config{APIKey: "test"}, &http.Client{Transport: api})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			prompt := Prompt{User: "Theatre Square\n\nprint(1)"}
+			got, err := c.GetHint(context.Background(), tt.level, prompt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("GetHint = %+v, want %+v", got, tt.want)
+			}
+
+			if input, _ := api.request["input"].(string); input != prompt.User {
+				t.Errorf("input %q, want the rendered prompt %q", input, prompt.User)
+			}
+			format, _ := api.request["text"].(map[string]any)["format"].(map[string]any)
+			if format["name"] != "coach_hint_"+string(tt.level) {
+				t.Errorf("schema name %v, want coach_hint_%s", format["name"], tt.level)
+			}
+			props, _ := format["schema"].(map[string]any)["properties"].(map[string]any)
+			if len(props) != len(tt.fields)+1 {
+				t.Errorf("schema properties %v, want hint and %v", props, tt.fields)
+			}
+			for _, field := range append(tt.fields, "hint") {
+				if _, ok := props[field]; !ok {
+					t.Errorf("schema lacks %q", field)
+				}
+			}
+		})
+	}
+}
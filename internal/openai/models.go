@@ -0,0 +1,45 @@
+package openai
+
+import "strings"
+
+// contextWindows is the context size in tokens of known models. Names match
+// by longest prefix, so dated snapshots such as "gpt-4o-2024-08-06" count.
+var contextWindows = map[string]int{
+	"gpt-3.5-turbo": 16385,
+	"gpt-4":         8192,
+	"gpt-4-32k":     32768,
+	"gpt-4-turbo":   128000,
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-5":         400000,
+	"o1":            200000,
+	"o1-mini":       128000,
+	"o3":            200000,
+	"o3-mini":       200000,
+	"o4-mini":       200000,
+}
+
+// DefaultContextWindow is assumed for unknown models, e.g. self-hosted ones.
+const DefaultContextWindow = 8192
+
+// maxAnswerTokens bounds the room kept free for the answer.
+const maxAnswerTokens = 16384
+
+// ContextWindow returns the context size of model in tokens.
+func ContextWindow(model string) int {
+	best, window := -1, DefaultContextWindow
+	for name, size := range contextWindows {
+		if strings.HasPrefix(model, name) && len(name) > best {
+			best, window = len(name), size
+		}
+	}
+	return window
+}
+
+// PromptBudget returns how many tokens a prompt to model may take: its
+// context window less room for the answer, a quarter of the window but at
+// most maxAnswerTokens.
+func PromptBudget(model string) int {
+	window := ContextWindow(model)
+	return window - min(window/4, maxAnswerTokens)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/openai/openai-go/responses"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/openai/openai-go"
@@ -16,12 +17,16 @@ import (
 // Config + Client wrapper
 // --------------------------------------------------------------------
 
+// DefaultModel is used by Client when Config names none.
+const DefaultModel = "o3"
+
 type Config struct {
 	APIKey       string        // OpenAI API key
 	Model        string        // e.g. "gpt-4o-mini"
 	SystemPrompt string        // role instruction
 	Temperature  float64       // 0.0 – 1.0
 	Timeout      time.Duration // per-request timeout
+	BaseURL      string        // chat completions server, used by ChatClient
 }
 
 type Client struct {
@@ -37,7 +42,7 @@ func NewClient(cfg Config, client option.HTTPClient) (*Client, error) {
 		return nil, fmt.Errorf("OpenAI API key missing")
 	}
 	if cfg.Model == "" {
-		cfg.Model = "o3"
+		cfg.Model = DefaultModel
 	}
 	if cfg.Temperature <= 0 || cfg.Temperature > 1 {
 		cfg.Temperature = 0.2
@@ -72,21 +77,75 @@ type Feedback struct {
 
 var FeedbackResponseSchema = GenerateSchema[Feedback]()
 
-func (c *Client) GetFeedback(code, thoughts, problem string) (Feedback, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+// FeedbackDelta is a piece of streamed feedback text. Field is the JSON name
+// of the Feedback field it belongs to.
+type FeedbackDelta struct {
+	Field string
+	Text  string
+}
+
+// Feedback field names as they appear in the structured output.
+const (
+	FieldFeedback             = "feedback"
+	FieldProof                = "proof"
+	FieldOptimalMetaCognition = "optima_meta_cognition"
+)
+
+func (c *Client) GetFeedback(ctx context.Context, prompt Prompt) (Feedback, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
-	// Construct the user message content
-	userMessageContent := fmt.Sprintf(
-		"Problem statement:\n%s\n\nMy code:\n%s\n\nMy thoughts:\n%s\n\n",
-		problem, code, thoughts,
-	)
+	resp, err := c.api.Responses.New(ctx, c.feedbackParams(prompt))
+	if err != nil {
+		return Feedback{}, fmt.Errorf("failed to call OpenAI API: %w", err)
+	}
 
-	resp, err := c.api.Responses.New(ctx, responses.ResponseNewParams{
+	log.Printf("%v", resp.OutputText())
+	return parseFeedback(resp.OutputText())
+}
+
+// StreamFeedback works like GetFeedback but streams the response, calling
+// onDelta with the decoded text of each field as it is generated. The
+// returned Feedback is parsed from the complete output.
+func (c *Client) StreamFeedback(ctx context.Context, prompt Prompt, onDelta func(FeedbackDelta)) (Feedback, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	stream := c.api.Responses.NewStreaming(ctx, c.feedbackParams(prompt))
+	defer stream.Close()
+
+	var fields fieldStreamer
+	var raw strings.Builder
+	for stream.Next() {
+		event := stream.Current()
+		switch event.Type {
+		case "response.output_text.delta":
+			raw.WriteString(event.Delta)
+			for _, d := range fields.Write(event.Delta) {
+				onDelta(d)
+			}
+		case "response.completed":
+			raw.Reset()
+			raw.WriteString(event.Response.OutputText())
+		case "response.failed", "response.incomplete":
+			return Feedback{}, fmt.Errorf("OpenAI stream ended with %s", event.Type)
+		case "error":
+			return Feedback{}, fmt.Errorf("OpenAI stream error %s: %s", event.Code, event.Message)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return Feedback{}, fmt.Errorf("failed to stream OpenAI API: %w", err)
+	}
+
+	return parseFeedback(raw.String())
+}
+
+func (c *Client) feedbackParams(prompt Prompt) responses.ResponseNewParams {
+	return responses.ResponseNewParams{
 		Model:        c.model, // helper
-		Instructions: openai.String(c.systemPrompt),
+		Instructions: openai.String(prompt.system(c.systemPrompt)),
 		Input: responses.ResponseNewParamsInputUnion{
-			OfString: openai.String(userMessageContent),
+			OfString: openai.String(prompt.User),
 		},
 		// Temperature: openai.Float(c.temperature), // helper
 
@@ -101,17 +160,12 @@ func (c *Client) GetFeedback(code, thoughts, problem string) (Feedback, error) {
 				},
 			},
 		},
-	})
-
-	if err != nil {
-		return Feedback{}, fmt.Errorf("failed to call OpenAI API: %w", err)
 	}
+}
 
-	log.Printf("%v", resp.OutputText())
-	raw := resp.OutputText()
+func parseFeedback(raw string) (Feedback, error) {
 	var fb Feedback
-
-	err = json.Unmarshal([]byte(raw), &fb)
+	err := json.Unmarshal([]byte(raw), &fb)
 	if err != nil {
 		fb.Feedback = raw // Assign raw content to the fallback field
 		return fb, fmt.Errorf("failed to unmarshall OpenAI JSON feedback: %w", err)
@@ -129,40 +183,16 @@ type Summary struct {
 
 var SummarySchema = GenerateSchema[Summary]()
 
-func (c *Client) SummarizeFeedback(statement string, feedbacks, proofs, optimalMetaCognitions []string) (Summary, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+func (c *Client) SummarizeFeedback(ctx context.Context, prompt Prompt) (Summary, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
-	// Compose the full history text
-	history := "Problem statement:\n" + statement + "\n\n"
-
-	if len(feedbacks) > 0 {
-		history += "Feedbacks:\n"
-		for i, feedback := range feedbacks {
-			history += fmt.Sprintf("Feedback #%d:\n%s\n\n", i+1, feedback)
-		}
-	}
-
-	if len(proofs) > 0 {
-		history += "Proofs:\n"
-		for i, proof := range proofs {
-			history += fmt.Sprintf("Proof #%d:\n%s\n\n", i+1, proof)
-		}
-	}
-
-	if len(optimalMetaCognitions) > 0 {
-		history += "Optimal Meta Cognitions:\n"
-		for i, oMC := range optimalMetaCognitions {
-			history += fmt.Sprintf("Optimal Meta Cognition #%d:\n%s\n\n", i+1, oMC)
-		}
-	}
-
 	// Send to OpenAI
 	resp, err := c.api.Responses.New(ctx, responses.ResponseNewParams{
 		Model:        c.model,
-		Instructions: openai.String(c.systemPrompt),
+		Instructions: openai.String(prompt.system(c.systemPrompt)),
 		Input: responses.ResponseNewParamsInputUnion{
-			OfString: openai.String(history),
+			OfString: openai.String(prompt.User),
 		},
 		Text: responses.ResponseTextConfigParam{
 			Format: responses.ResponseFormatTextConfigUnionParam{
@@ -181,10 +211,12 @@ func (c *Client) SummarizeFeedback(statement string, feedbacks, proofs, optimalM
 	}
 
 	log.Printf("%v", resp.OutputText())
-	raw := resp.OutputText()
-	var summary Summary
+	return parseSummary(resp.OutputText())
+}
 
-	err = json.Unmarshal([]byte(raw), &summary)
+func parseSummary(raw string) (Summary, error) {
+	var summary Summary
+	err := json.Unmarshal([]byte(raw), &summary)
 	if err != nil {
 		summary.Feedback = raw
 		return summary, fmt.Errorf("failed to unmarshal OpenAI JSON summary: %w", err)
@@ -0,0 +1,160 @@
+package openai
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// fieldStreamer incrementally scans a flat JSON object of string values, as
+// produced token by token by structured outputs, and reports the decoded
+// text of every value as soon as it arrives.
+type fieldStreamer struct {
+	state   streamState
+	key     strings.Builder
+	field   string
+	escape  string // pending escape sequence inside a value, without the backslash
+	escaped bool
+	high    rune   // high surrogate escape awaiting its low half, 0 if none
+	partial string // trailing bytes of an incomplete UTF-8 sequence
+}
+
+type streamState int
+
+const (
+	stateSeekKey streamState = iota
+	stateKey
+	stateSeekValue
+	stateValue
+)
+
+// Write consumes the next chunk of raw output and returns the decoded text
+// it added, grouped by field.
+func (f *fieldStreamer) Write(chunk string) []FeedbackDelta {
+	chunk = f.partial + chunk
+	f.partial = ""
+	for i := len(chunk) - 1; i >= 0 && i >= len(chunk)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(chunk[i]) {
+			if !utf8.FullRuneInString(chunk[i:]) {
+				chunk, f.partial = chunk[:i], chunk[i:]
+			}
+			break
+		}
+	}
+
+	var deltas []FeedbackDelta
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			deltas = append(deltas, FeedbackDelta{Field: f.field, Text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for _, r := range chunk {
+		switch f.state {
+		case stateSeekKey:
+			if r == '"' {
+				f.key.Reset()
+				f.state = stateKey
+			}
+		case stateKey:
+			switch {
+			case f.escaped:
+				f.key.WriteRune(r)
+				f.escaped = false
+			case r == '\\':
+				f.escaped = true
+			case r == '"':
+				f.field = f.key.String()
+				f.state = stateSeekValue
+			default:
+				f.key.WriteRune(r)
+			}
+		case stateSeekValue:
+			if r == '"' {
+				f.state = stateValue
+			}
+		case stateValue:
+			switch {
+			case f.escaped:
+				f.escape += string(r)
+				if decoded, done := decodeEscape(f.escape); done {
+					f.writeValue(&text, decoded)
+					f.escape = ""
+					f.escaped = false
+				}
+			case r == '\\':
+				f.escaped = true
+			case r == '"':
+				f.endSurrogate(&text)
+				flush()
+				f.state = stateSeekKey
+			default:
+				f.writeValue(&text, r)
+			}
+		}
+	}
+	if f.state == stateValue {
+		flush()
+	}
+	return deltas
+}
+
+// writeValue adds r to a value. JSON escapes characters outside the Basic
+// Multilingual Plane as two \u escapes, so a high surrogate is held until its
+// low half arrives, possibly in a later chunk.
+func (f *fieldStreamer) writeValue(text *strings.Builder, r rune) {
+	if f.high != 0 {
+		high := f.high
+		f.high = 0
+		if pair := utf16.DecodeRune(high, r); pair != utf8.RuneError {
+			text.WriteRune(pair)
+			return
+		}
+		text.WriteRune(utf8.RuneError)
+	}
+	if utf16.IsSurrogate(r) && r < 0xDC00 {
+		f.high = r
+		return
+	}
+	text.WriteRune(r) // a lone low surrogate becomes U+FFFD
+}
+
+// endSurrogate writes a high surrogate left without its low half.
+func (f *fieldStreamer) endSurrogate(text *strings.Builder) {
+	if f.high != 0 {
+		f.high = 0
+		text.WriteRune(utf8.RuneError)
+	}
+}
+
+// decodeEscape decodes a JSON escape sequence without its backslash and
+// reports whether it is complete. Invalid \u escapes decode to U+FFFD.
+func decodeEscape(seq string) (rune, bool) {
+	if seq[0] != 'u' {
+		switch seq[0] {
+		case 'n':
+			return '\n', true
+		case 't':
+			return '\t', true
+		case 'r':
+			return '\r', true
+		case 'b':
+			return '\b', true
+		case 'f':
+			return '\f', true
+		default: // '"', '\\', '/'
+			return rune(seq[0]), true
+		}
+	}
+	if len(seq) < 5 {
+		return 0, false
+	}
+	code, err := strconv.ParseUint(seq[1:5], 16, 32)
+	if err != nil {
+		return utf8.RuneError, true
+	}
+	return rune(code), true
+}
@@ -0,0 +1,75 @@
+package openai
+
+import (
+	"encoding/json"
+	"maps"
+	"testing"
+)
+
+// streamFields feeds chunks to a fieldStreamer and joins the text it
+// reports per field.
+func streamFields(chunks ...string) map[string]string {
+	var f fieldStreamer
+	got := map[string]string{}
+	for _, chunk := range chunks {
+		for _, d := range f.Write(chunk) {
+			got[d.Field] += d.Text
+		}
+	}
+	return got
+}
+
+func TestFieldStreamerSplits(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"plain", `{"feedback":"use ceil","proof":"a/n rounded up"}`},
+		{"escaped quotes and backslashes", `{"feedback":"print \"\\n\" not \\\"","proof":"\\\\"}`},
+		{"control escapes", `{"feedback":"a\nb\tc\r\/d\b\f"}`},
+		{"unicode escapes", `{"feedback":"\u00e9t\u00E9 \u2264 n"}`},
+		{"multibyte UTF-8", `{"feedback":"été ≤ n, 😀"}`},
+		{"surrogate pair", `{"feedback":"ok \uD83D\uDE00!","proof":"\ud83d\ude00"}`},
+		{"escaped key", `{"feed\"back":"x"}`},
+	}
+	for _, tt := range tests {
+		var want map[string]string
+		if err := json.Unmarshal([]byte(tt.in), &want); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := streamFields(tt.in); !maps.Equal(got, want) {
+			t.Errorf("%s: whole = %q, want %q", tt.name, got, want)
+		}
+		for i := 1; i < len(tt.in); i++ {
+			if got := streamFields(tt.in[:i], tt.in[i:]); !maps.Equal(got, want) {
+				t.Errorf("%s: split at %d (%q|%q) = %q, want %q", tt.name, i, tt.in[:i], tt.in[i:], got, want)
+			}
+		}
+		bytes := make([]string, len(tt.in))
+		for i := range len(tt.in) {
+			bytes[i] = tt.in[i : i+1]
+		}
+		if got := streamFields(bytes...); !maps.Equal(got, want) {
+			t.Errorf("%s: byte by byte = %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestFieldStreamerLoneSurrogates(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"feedback":"a\uD83Db"}`, "a\uFFFDb"},
+		{`{"feedback":"a\uD83D"}`, "a\uFFFD"},
+		{`{"feedback":"a\uD83D\n"}`, "a\uFFFD\n"},
+		{`{"feedback":"a\uD83D\uD83D\uDE00"}`, "a\uFFFD😀"},
+		{`{"feedback":"a\uDE00b"}`, "a\uFFFDb"},
+	}
+	for _, tt := range tests {
+		for i := 1; i <= len(tt.in); i++ {
+			if got := streamFields(tt.in[:i], tt.in[i:])[FieldFeedback]; got != tt.want {
+				t.Errorf("%s split at %d = %q, want %q", tt.in, i, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openai/openai-go/option"
+)
+
+// Provider is a coaching backend. Client talks to the OpenAI Responses API,
+// ChatClient to any OpenAI-compatible chat completions server, and Fake
+// answers without a model.
+type Provider interface {
+	GetFeedback(ctx context.Context, prompt Prompt) (Feedback, error)
+	// StreamFeedback works like GetFeedback, calling onDelta with the text
+	// of each field as it is generated.
+	StreamFeedback(ctx context.Context, prompt Prompt, onDelta func(FeedbackDelta)) (Feedback, error)
+	GetHint(ctx context.Context, level HintLevel, prompt Prompt) (Hint, error)
+	SummarizeFeedback(ctx context.Context, prompt Prompt) (Summary, error)
+}
+
+// Prompt is what a request asks the model. System replaces the configured
+// system prompt when set; User is the user message.
+type Prompt struct {
+	System string
+	User   string
+}
+
+// system returns the system prompt of p, falling back to fallback.
+func (p Prompt) system(fallback string) string {
+	if p.System != "" {
+		return p.System
+	}
+	return fallback
+}
+
+// Provider names accepted by NewProvider.
+const (
+	ProviderOpenAI     = "openai"
+	ProviderCompatible = "openai-compatible"
+	ProviderFake       = "fake"
+)
+
+// NewProvider builds the provider with the given name; "" selects OpenAI.
+func NewProvider(name string, cfg Config, client option.HTTPClient) (Provider, error) {
+	switch name {
+	case "", ProviderOpenAI:
+		c, err := NewClient(cfg, client)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case ProviderCompatible:
+		c, err := NewChatClient(cfg, client)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case ProviderFake:
+		return Fake{}, nil
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q, expected %q, %q or %q", name, ProviderOpenAI, ProviderCompatible, ProviderFake)
+	}
+}
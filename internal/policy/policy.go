@@ -0,0 +1,110 @@
+// Package policy decides when an editor snapshot is worth new AI feedback.
+package policy
+
+import (
+	"coach_demon/internal/diff"
+	"strings"
+	"time"
+)
+
+// minIntervalFloor is the shortest interval a client override may request.
+const minIntervalFloor = 5 * time.Second
+
+// Reasons reported in a Decision.
+const (
+	ReasonFirst           = "first"
+	ReasonTooSoon         = "too_soon"
+	ReasonUnchanged       = "unchanged"
+	ReasonCodeChanged     = "code_changed"
+	ReasonThoughtsChanged = "thoughts_changed"
+)
+
+// Config controls the feedback cadence.
+type Config struct {
+	// MinInterval is the minimum time between two analyses of a problem.
+	MinInterval time.Duration
+	// MinChange is the normalized code difference, from 0 to 1, against the
+	// last analyzed snapshot below which a snapshot is ignored.
+	MinChange float64
+	// OnThoughtsChange analyzes any snapshot whose thoughts changed, even if
+	// the code change is below MinChange.
+	OnThoughtsChange bool
+}
+
+// Default is used when nothing is configured.
+var Default = Config{
+	MinInterval:      time.Minute,
+	MinChange:        0.05,
+	OnThoughtsChange: true,
+}
+
+// Override is a per-client adjustment; nil fields keep the server value.
+type Override struct {
+	MinInterval      *time.Duration
+	MinChange        *float64
+	OnThoughtsChange *bool
+}
+
+// WithOverride returns c adjusted by o. MinInterval is never lowered below
+// minIntervalFloor and MinChange is clamped to [0, 1].
+func (c Config) WithOverride(o Override) Config {
+	if o.MinInterval != nil {
+		c.MinInterval = max(*o.MinInterval, minIntervalFloor)
+	}
+	if o.MinChange != nil {
+		c.MinChange = min(max(*o.MinChange, 0), 1)
+	}
+	if o.OnThoughtsChange != nil {
+		c.OnThoughtsChange = *o.OnThoughtsChange
+	}
+	return c
+}
+
+// Snapshot is the part of an editor snapshot the policy looks at.
+type Snapshot struct {
+	Code     string
+	Thoughts string
+}
+
+// Decision is the outcome of Decide.
+type Decision struct {
+	Analyze bool
+	Reason  string
+	// RetryAt is when a ReasonTooSoon snapshot may be analyzed.
+	RetryAt time.Time
+}
+
+// Decide reports whether cur deserves feedback. last is the most recently
+// analyzed snapshot, nil if there is none, and lastAt when it was analyzed.
+// A significant change within MinInterval of lastAt is too soon.
+func (c Config) Decide(last *Snapshot, lastAt time.Time, cur Snapshot, now time.Time) Decision {
+	if last == nil {
+		return Decision{Analyze: true, Reason: ReasonFirst}
+	}
+	d := c.change(*last, cur)
+	if d.Analyze && now.Sub(lastAt) < c.MinInterval {
+		return Decision{Reason: ReasonTooSoon, RetryAt: lastAt.Add(c.MinInterval)}
+	}
+	return d
+}
+
+// Significant reports whether cur differs enough from prev to be analyzed on
+// its own, ignoring the interval.
+func (c Config) Significant(prev, cur Snapshot) bool {
+	return c.change(prev, cur).Analyze
+}
+
+func (c Config) change(prev, cur Snapshot) Decision {
+	if c.OnThoughtsChange && normalizeThoughts(prev.Thoughts) != normalizeThoughts(cur.Thoughts) {
+		return Decision{Analyze: true, Reason: ReasonThoughtsChanged}
+	}
+	ratio := diff.Ratio(prev.Code, cur.Code)
+	if ratio > 0 && ratio >= c.MinChange {
+		return Decision{Analyze: true, Reason: ReasonCodeChanged}
+	}
+	return Decision{Reason: ReasonUnchanged}
+}
+
+func normalizeThoughts(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
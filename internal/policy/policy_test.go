@@ -0,0 +1,161 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecide(t *testing.T) {
+	cfg := Config{MinInterval: time.Minute, MinChange: 0.25, OnThoughtsChange: true}
+	lastAt := time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)
+	four := "a := read()\nb := read()\nc := a + b\nprint(c)"
+	five := four + "\nexit()"
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		last    *Snapshot
+		cur     Snapshot
+		elapsed time.Duration
+		want    Decision
+	}{
+		{
+			name: "first snapshot",
+			cur:  Snapshot{Code: four},
+			want: Decision{Analyze: true, Reason: ReasonFirst},
+		},
+		{
+			name:    "change just inside the interval",
+			last:    &Snapshot{Code: four},
+			cur:     Snapshot{Code: "x := 1"},
+			elapsed: time.Minute - time.Nanosecond,
+			want:    Decision{Reason: ReasonTooSoon, RetryAt: lastAt.Add(time.Minute)},
+		},
+		{
+			name:    "change at the interval",
+			last:    &Snapshot{Code: four},
+			cur:     Snapshot{Code: "x := 1"},
+			elapsed: time.Minute,
+			want:    Decision{Analyze: true, Reason: ReasonCodeChanged},
+		},
+		{
+			name:    "no change inside the interval",
+			last:    &Snapshot{Code: four},
+			cur:     Snapshot{Code: four},
+			elapsed: time.Second,
+			want:    Decision{Reason: ReasonUnchanged},
+		},
+		{
+			name:    "ratio at the threshold",
+			last:    &Snapshot{Code: four},
+			cur:     Snapshot{Code: "a := read()\nb := read()\nc := a * b\nprint(c)"},
+			elapsed: time.Hour,
+			want:    Decision{Analyze: true, Reason: ReasonCodeChanged},
+		},
+		{
+			name:    "ratio below the threshold",
+			last:    &Snapshot{Code: five},
+			cur:     Snapshot{Code: "a := read()\nb := read()\nc := a * b\nprint(c)\nexit()"},
+			elapsed: time.Hour,
+			want:    Decision{Reason: ReasonUnchanged},
+		},
+		{
+			name:    "reindented code",
+			last:    &Snapshot{Code: four},
+			cur:     Snapshot{Code: "  a := read()\n\nb  := read()\n\tc := a + b\nprint(c)  "},
+			elapsed: time.Hour,
+			want:    Decision{Reason: ReasonUnchanged},
+		},
+		{
+			name:    "thoughts reformatted",
+			last:    &Snapshot{Code: four, Thoughts: "sum the two numbers"},
+			cur:     Snapshot{Code: four, Thoughts: "  sum the\ntwo  numbers\n"},
+			elapsed: time.Hour,
+			want:    Decision{Reason: ReasonUnchanged},
+		},
+		{
+			name:    "thoughts changed",
+			last:    &Snapshot{Code: four, Thoughts: "sum the two numbers"},
+			cur:     Snapshot{Code: four, Thoughts: "sum may overflow"},
+			elapsed: time.Hour,
+			want:    Decision{Analyze: true, Reason: ReasonThoughtsChanged},
+		},
+		{
+			name:    "thoughts changed too soon",
+			last:    &Snapshot{Code: four, Thoughts: "sum the two numbers"},
+			cur:     Snapshot{Code: four, Thoughts: "sum may overflow"},
+			elapsed: time.Second,
+			want:    Decision{Reason: ReasonTooSoon, RetryAt: lastAt.Add(time.Minute)},
+		},
+		{
+			name:    "thoughts changed without OnThoughtsChange",
+			cfg:     Config{MinInterval: time.Minute, MinChange: 0.25},
+			last:    &Snapshot{Code: four, Thoughts: "sum the two numbers"},
+			cur:     Snapshot{Code: four, Thoughts: "sum may overflow"},
+			elapsed: time.Hour,
+			want:    Decision{Reason: ReasonUnchanged},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg
+			if tt.cfg != (Config{}) {
+				c = tt.cfg
+			}
+			got := c.Decide(tt.last, lastAt, tt.cur, lastAt.Add(tt.elapsed))
+			if got != tt.want {
+				t.Errorf("Decide = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignificant(t *testing.T) {
+	cfg := Config{MinInterval: time.Hour, MinChange: 0.5, OnThoughtsChange: true}
+	tests := []struct {
+		name      string
+		prev, cur Snapshot
+		want      bool
+	}{
+		{"identical", Snapshot{Code: "a\nb"}, Snapshot{Code: "a\nb"}, false},
+		{"half the lines", Snapshot{Code: "a\nb"}, Snapshot{Code: "a\nc"}, true},
+		{"a quarter of the lines", Snapshot{Code: "a\nb\nc\nd"}, Snapshot{Code: "a\nb\nc\ne"}, false},
+		{"thoughts", Snapshot{Code: "a", Thoughts: "x"}, Snapshot{Code: "a", Thoughts: "y"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.Significant(tt.prev, tt.cur); got != tt.want {
+				t.Errorf("Significant = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithOverride(t *testing.T) {
+	duration := func(d time.Duration) *time.Duration { return &d }
+	ratio := func(f float64) *float64 { return &f }
+	no := false
+
+	tests := []struct {
+		name     string
+		override Override
+		want     Config
+	}{
+		{"nothing", Override{}, Default},
+		{"longer interval", Override{MinInterval: duration(2 * time.Minute)}, Config{2 * time.Minute, 0.05, true}},
+		{"interval at the floor", Override{MinInterval: duration(5 * time.Second)}, Config{5 * time.Second, 0.05, true}},
+		{"interval below the floor", Override{MinInterval: duration(time.Second)}, Config{5 * time.Second, 0.05, true}},
+		{"negative interval", Override{MinInterval: duration(-time.Minute)}, Config{5 * time.Second, 0.05, true}},
+		{"change", Override{MinChange: ratio(0.3)}, Config{time.Minute, 0.3, true}},
+		{"negative change", Override{MinChange: ratio(-1)}, Config{time.Minute, 0, true}},
+		{"change above 1", Override{MinChange: ratio(2)}, Config{time.Minute, 1, true}},
+		{"thoughts", Override{OnThoughtsChange: &no}, Config{time.Minute, 0.05, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Default.WithOverride(tt.override); got != tt.want {
+				t.Errorf("WithOverride = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package prompts
+
+import (
+	"slices"
+	"strings"
+
+	"coach_demon/internal/openai"
+)
+
+// Floors under which a prompt over its budget is not shortened further.
+const (
+	minCodeLines       = 40
+	minStatementTokens = 1024
+)
+
+func promptTokens(p openai.Prompt) int {
+	return EstimateTokens(p.System) + EstimateTokens(p.User)
+}
+
+// SetCode fills Code and Language from code and keeps it, so that a prompt
+// over its budget can show an excerpt instead.
+func (d *Data) SetCode(code openai.Code) {
+	d.Code, d.Language = code.Render(), code.Language()
+	d.code, d.codeLines = &code, 0
+}
+
+// Estimate returns the estimated tokens of each field of d that templates
+// render, by name.
+func (d Data) Estimate() map[string]int {
+	history := 0
+	for _, h := range d.History {
+		history += EstimateTokens(h.Feedback)
+	}
+	feedbacks := 0
+	for _, list := range [][]string{d.Feedbacks, d.Proofs, d.OptimalMetaCognitions} {
+		for _, s := range list {
+			feedbacks += EstimateTokens(s)
+		}
+	}
+	return map[string]int{
+		"statement":        EstimateTokens(d.Statement),
+		"code":             EstimateTokens(d.Code),
+		"thoughts":         EstimateTokens(d.Thoughts),
+		"previousFeedback": EstimateTokens(d.PreviousFeedback),
+		"history":          history,
+		"diff":             EstimateTokens(d.Diff),
+		"feedbacks":        feedbacks,
+	}
+}
+
+// shrink shortens d by about over tokens, taking from what the model needs
+// least: older history first, then the diff, the code away from the cursor,
+// the end of the statement and finally the latest feedback. The thoughts are
+// kept whole. It reports false when nothing is left to shorten.
+func (d *Data) shrink(over int) bool {
+	switch {
+	case len(d.History) > 1:
+		k := dropCount(over, len(d.History)-1, func(i int) int { return EstimateTokens(d.History[i].Feedback) })
+		d.History = d.History[k:]
+	case max(len(d.Feedbacks), len(d.Proofs), len(d.OptimalMetaCognitions)) > 1:
+		lists := []*[]string{&d.Feedbacks, &d.Proofs, &d.OptimalMetaCognitions}
+		longest := max(len(d.Feedbacks), len(d.Proofs), len(d.OptimalMetaCognitions))
+		k := dropCount(over, longest-1, func(i int) int {
+			tokens := 0
+			for _, list := range lists {
+				if i < len(*list) {
+					tokens += EstimateTokens((*list)[i])
+				}
+			}
+			return tokens
+		})
+		for _, list := range lists {
+			*list = (*list)[min(k, max(len(*list)-1, 0)):]
+		}
+	case d.Diff != "":
+		d.Diff = shorten(d.Diff, over, 0)
+	case d.code != nil && d.lines() > minCodeLines:
+		lines, tokens := d.lines(), max(EstimateTokens(d.Code), 1)
+		d.codeLines = min(max(lines*(tokens-over)/tokens, minCodeLines), lines-1)
+		d.Code = d.code.Excerpt(d.codeLines).Render()
+	case EstimateTokens(d.Statement) > minStatementTokens:
+		d.Statement = shorten(d.Statement, over, minStatementTokens)
+	case d.PreviousFeedback != "":
+		d.PreviousFeedback = shorten(d.PreviousFeedback, over, 0)
+	case len(d.History) == 1:
+		newest := shorten(d.History[0].Feedback, over, 0)
+		if newest == "" {
+			d.History = nil
+			break
+		}
+		d.History = slices.Clone(d.History)
+		d.History[0].Feedback = newest
+	default:
+		return false
+	}
+	return true
+}
+
+// lines is the number of code lines the prompt shows.
+func (d *Data) lines() int {
+	if d.codeLines > 0 {
+		return d.codeLines
+	}
+	return strings.Count(strings.TrimRight(d.code.Text(), "\n"), "\n") + 1
+}
+
+// dropCount returns how many of the first n entries to drop to save over
+// tokens, at least one.
+func dropCount(over, n int, tokens func(i int) int) int {
+	k, saved := 0, 0
+	for k < n && (k == 0 || saved < over) {
+		saved += tokens(k)
+		k++
+	}
+	return k
+}
+
+// shorten cuts s by about over tokens, but not below floor tokens. The
+// result is always shorter than s.
+func shorten(s string, over, floor int) string {
+	tokens := max(EstimateTokens(s), 1)
+	target := max(tokens-over, floor)
+	if target <= 0 {
+		return ""
+	}
+	return truncate(s, min(len(s)*target/tokens, len(s)-1))
+}
@@ -0,0 +1,85 @@
+package prompts
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// PastFeedback is feedback given earlier in the same coding session.
+type PastFeedback struct {
+	Timestamp time.Time
+	Feedback  string
+}
+
+// truncated marks text cut to fit a budget.
+const truncated = "[…]"
+
+// EstimateTokens approximates the tokens s takes: four bytes of ASCII or one
+// other character per token. Tokenizers do at least that well on code and
+// English, so the estimate errs on the safe side.
+func EstimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// FitContext trims the feedback history, oldest first, and the code diff
+// so that together they take an estimated budget tokens at most; a budget
+// <= 0 keeps everything. The newest feedback comes first, then the diff,
+// then older feedback while it fits whole, so the model always learns what
+// it said last and what changed since.
+func FitContext(history []PastFeedback, diff string, budget int) ([]PastFeedback, string) {
+	if budget <= 0 {
+		return history, diff
+	}
+	if len(history) == 0 {
+		return nil, fitTokens(diff, budget)
+	}
+	newest := history[len(history)-1]
+	newest.Feedback = fitTokens(newest.Feedback, budget)
+	remaining := budget - EstimateTokens(newest.Feedback)
+	diff = fitTokens(diff, remaining)
+	remaining -= EstimateTokens(diff)
+
+	first := len(history) - 1
+	for first > 0 && EstimateTokens(history[first-1].Feedback) <= remaining {
+		first--
+		remaining -= EstimateTokens(history[first].Feedback)
+	}
+	fitted := append(history[first:len(history)-1:len(history)-1], newest)
+	return fitted, diff
+}
+
+// fitTokens cuts s to an estimated budget tokens at most.
+func fitTokens(s string, budget int) string {
+	for s != "" && EstimateTokens(s) > budget {
+		s = shorten(s, EstimateTokens(s)-budget, 0)
+	}
+	return s
+}
+
+// truncate cuts s to at most n bytes including the marker, at the last line
+// break if there is one, otherwise at a rune boundary.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n <= len(truncated) {
+		return ""
+	}
+	cut := s[:n-len(truncated)]
+	if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+		return cut[:i+1] + truncated
+	}
+	for len(cut) > 0 && !utf8.ValidString(cut) {
+		cut = cut[:len(cut)-1]
+	}
+	return cut + truncated
+}
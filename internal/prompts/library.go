@@ -0,0 +1,100 @@
+package prompts
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Library holds the current Set of a prompt directory and reloads it when
+// the files change. A directory that no longer loads keeps the last good Set.
+type Library struct {
+	dir     string
+	current atomic.Pointer[Set]
+
+	mu    sync.Mutex
+	stamp string // fingerprint of the files the current Set was loaded from
+}
+
+// NewLibrary loads dir, or only the built-in templates when dir is "".
+func NewLibrary(dir string) (*Library, error) {
+	l := &Library{dir: dir}
+	stamp, err := l.fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	set, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	l.current.Store(set)
+	l.stamp = stamp
+	return l, nil
+}
+
+// Dir returns the prompt directory, "" for the built-in templates.
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// Current returns the Set in use.
+func (l *Library) Current() *Set {
+	return l.current.Load()
+}
+
+// Reload loads the directory again if any file changed since the last load,
+// reporting whether the Set was replaced. A failed load is reported once per
+// change.
+func (l *Library) Reload() (bool, error) {
+	if l.dir == "" {
+		return false, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stamp, err := l.fingerprint()
+	if err != nil {
+		return false, err
+	}
+	if stamp == l.stamp {
+		return false, nil
+	}
+	l.stamp = stamp
+	set, err := Load(l.dir)
+	if err != nil {
+		return false, err
+	}
+	l.current.Store(set)
+	return true, nil
+}
+
+// fingerprint summarizes the names, sizes and modification times of the
+// files in the directory.
+func (l *Library) fingerprint() (string, error) {
+	if l.dir == "" {
+		return "", nil
+	}
+	var stamp strings.Builder
+	err := filepath.WalkDir(l.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // removed while walking, the next reload sees it
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&stamp, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("reading prompt directory %s: %w", l.dir, err)
+	}
+	return stamp.String(), nil
+}
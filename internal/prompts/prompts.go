@@ -0,0 +1,298 @@
+// Package prompts renders the messages sent to the AI from text/template
+// files, so coaches can change them without rebuilding the coach.
+//
+// A prompt directory holds one subdirectory per coaching mode, each with up
+// to one template per kind: <dir>/<mode>/<kind>.tmpl. A mode falls back to
+// the "default" mode for the kinds it leaves out, and the default mode falls
+// back to the templates built into the binary.
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"coach_demon/internal/openai"
+	"coach_demon/pkg/codeforces"
+)
+
+// Template kinds.
+const (
+	// KindSystem replaces the configured system prompt. It is optional.
+	KindSystem   = "system"
+	KindFeedback = "feedback"
+	KindHint     = "hint"
+	KindSummary  = "summary"
+)
+
+var kinds = []string{KindSystem, KindFeedback, KindHint, KindSummary}
+
+// DefaultMode is the mode used when none is selected.
+const DefaultMode = "default"
+
+// ErrUnknownMode is returned for a mode without a directory.
+var ErrUnknownMode = errors.New("unknown coaching mode")
+
+//go:embed defaults
+var builtin embed.FS
+
+// Problem describes the problem a prompt is about.
+type Problem struct {
+	ID      string // e.g. "1A"
+	Contest string // e.g. "1"
+	Index   string // e.g. "A"
+	URL     string
+}
+
+// Data holds the variables available to templates. Fields that do not apply
+// to a kind are empty.
+type Data struct {
+	Mode      string
+	Problem   Problem
+	Statement string
+	// Code is the user's source as fenced Markdown blocks; Language is the
+	// language of its first file that names one. See SetCode.
+	Code     string
+	Language string
+	Thoughts string
+	// PreviousFeedback is the latest feedback on the problem before this
+	// request, "" for the first.
+	PreviousFeedback string
+
+	// Feedback prompts only: the earlier feedback of the coding session,
+	// oldest first, and a unified diff of the code since the newest of it.
+	// Both are trimmed to the context budget and empty on a session's first
+	// feedback.
+	History []PastFeedback
+	Diff    string
+
+	// Hint prompts only.
+	Level       string
+	Instruction string
+
+	// Summary prompts only: the feedback history, oldest first, and how many
+	// hints of each level the user took.
+	Feedbacks             []string
+	Proofs                []string
+	OptimalMetaCognitions []string
+	HintsUsed             map[string]int
+
+	// MaxTokens bounds the estimated size of the rendered prompt, 0 for no
+	// bound. A prompt over it is rendered again with shorter fields.
+	MaxTokens int
+
+	// code is the source behind Code when set with SetCode, and codeLines
+	// the lines of it the prompt shows, 0 for all.
+	code      *openai.Code
+	codeLines int
+}
+
+// NewProblem describes the problem with the given ID. IDs that are not
+// Codeforces problem IDs only fill ID.
+func NewProblem(id string) Problem {
+	contest, index, err := codeforces.ParseID(id)
+	if err != nil {
+		return Problem{ID: id}
+	}
+	return Problem{ID: id, Contest: contest, Index: index, URL: codeforces.ProblemURL(contest, index)}
+}
+
+var funcs = template.FuncMap{
+	"inc":  func(i int) int { return i + 1 },
+	"join": strings.Join,
+	"trim": strings.TrimSpace,
+}
+
+// Set is a loaded and validated prompt directory.
+type Set struct {
+	// templates maps mode and kind to its template, fallbacks resolved.
+	templates map[string]map[string]*template.Template
+}
+
+// Load reads the prompt directory dir, or only the built-in templates when
+// dir is "", and checks that every template renders.
+func Load(dir string) (*Set, error) {
+	builtinDir, err := fs.Sub(builtin, "defaults")
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := parseModes(builtinDir, "built-in")
+	if err != nil {
+		return nil, err
+	}
+	modes := defaults
+	if dir != "" {
+		if modes, err = parseModes(os.DirFS(dir), dir); err != nil {
+			return nil, err
+		}
+	}
+
+	set := &Set{templates: make(map[string]map[string]*template.Template)}
+	for mode := range modes {
+		set.templates[mode] = make(map[string]*template.Template)
+	}
+	set.templates[DefaultMode] = make(map[string]*template.Template)
+	for mode, templates := range set.templates {
+		for _, kind := range kinds {
+			for _, t := range []*template.Template{modes[mode][kind], modes[DefaultMode][kind], defaults[DefaultMode][kind]} {
+				if t != nil {
+					templates[kind] = t
+					break
+				}
+			}
+		}
+	}
+	if err := set.validate(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// parseModes parses the templates of every mode directory in fsys. Other
+// files at the top level are ignored; unknown files in a mode are errors.
+func parseModes(fsys fs.FS, name string) (map[string]map[string]*template.Template, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("reading prompt directory %s: %w", name, err)
+	}
+	modes := make(map[string]map[string]*template.Template)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		mode := entry.Name()
+		files, err := fs.ReadDir(fsys, mode)
+		if err != nil {
+			return nil, fmt.Errorf("reading prompt directory %s: %w", name, err)
+		}
+		modes[mode] = make(map[string]*template.Template)
+		for _, file := range files {
+			kind, ok := strings.CutSuffix(file.Name(), ".tmpl")
+			if file.IsDir() || !ok || !slices.Contains(kinds, kind) {
+				return nil, fmt.Errorf("prompt directory %s: unexpected %s in mode %s, want %s.tmpl files", name, file.Name(), mode, strings.Join(kinds, ".tmpl, "))
+			}
+			text, err := fs.ReadFile(fsys, path.Join(mode, file.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("reading prompt %s: %w", path.Join(name, mode, file.Name()), err)
+			}
+			t, err := template.New(path.Join(mode, file.Name())).Funcs(funcs).Option("missingkey=error").Parse(string(text))
+			if err != nil {
+				return nil, fmt.Errorf("parsing prompt: %w", err)
+			}
+			modes[mode][kind] = t
+		}
+	}
+	return modes, nil
+}
+
+// validate renders every template with sample data, which catches unknown
+// variables that parsing cannot.
+func (s *Set) validate() error {
+	sample := Data{
+		Mode:                  DefaultMode,
+		Problem:               Problem{ID: "1A", Contest: "1", Index: "A", URL: codeforces.ProblemURL("1", "A")},
+		Statement:             "statement",
+		Code:                  "```cpp\nint main() {}\n```\n",
+		Language:              "C++",
+		Thoughts:              "thoughts",
+		PreviousFeedback:      "feedback",
+		History:               []PastFeedback{{Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Feedback: "feedback"}},
+		Diff:                  "@@ -1,1 +1,1 @@\n-int main() {}\n+int main() { return 0; }\n",
+		Feedbacks:             []string{"feedback"},
+		Proofs:                []string{"proof"},
+		OptimalMetaCognitions: []string{"optimal meta cognition"},
+		HintsUsed:             map[string]int{string(openai.HintNudge): 1},
+	}
+	for _, mode := range s.Modes() {
+		for kind, t := range s.templates[mode] {
+			data := sample
+			data.Mode = mode
+			if kind == KindHint {
+				data.Level, data.Instruction = string(openai.HintNudge), openai.HintInstruction(openai.HintNudge)
+			}
+			if err := t.Execute(&bytes.Buffer{}, data); err != nil {
+				return fmt.Errorf("checking prompt: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Modes lists the available modes, sorted.
+func (s *Set) Modes() []string {
+	return slices.Sorted(maps.Keys(s.templates))
+}
+
+// HasMode reports whether mode can be selected; "" is the default mode.
+func (s *Set) HasMode(mode string) bool {
+	_, ok := s.templates[modeOrDefault(mode)]
+	return ok
+}
+
+// Feedback renders the prompt asking for feedback on a snapshot.
+func (s *Set) Feedback(mode string, data Data) (openai.Prompt, error) {
+	return s.render(mode, KindFeedback, data)
+}
+
+// Hint renders the prompt asking for a hint at level.
+func (s *Set) Hint(mode string, level openai.HintLevel, data Data) (openai.Prompt, error) {
+	data.Level, data.Instruction = string(level), openai.HintInstruction(level)
+	return s.render(mode, KindHint, data)
+}
+
+// Summary renders the prompt asking to summarize the feedback history.
+func (s *Set) Summary(mode string, data Data) (openai.Prompt, error) {
+	return s.render(mode, KindSummary, data)
+}
+
+func (s *Set) render(mode, kind string, data Data) (openai.Prompt, error) {
+	mode = modeOrDefault(mode)
+	templates, ok := s.templates[mode]
+	if !ok {
+		return openai.Prompt{}, fmt.Errorf("%w %q", ErrUnknownMode, mode)
+	}
+	data.Mode = mode
+
+	prompt, err := execute(templates, kind, data)
+	for err == nil && data.MaxTokens > 0 {
+		over := promptTokens(prompt) - data.MaxTokens
+		if over <= 0 || !data.shrink(over) {
+			break
+		}
+		prompt, err = execute(templates, kind, data)
+	}
+	return prompt, err
+}
+
+func execute(templates map[string]*template.Template, kind string, data Data) (openai.Prompt, error) {
+	var prompt openai.Prompt
+	if t, ok := templates[KindSystem]; ok {
+		var system strings.Builder
+		if err := t.Execute(&system, data); err != nil {
+			return openai.Prompt{}, fmt.Errorf("rendering prompt: %w", err)
+		}
+		prompt.System = system.String()
+	}
+	var user strings.Builder
+	if err := templates[kind].Execute(&user, data); err != nil {
+		return openai.Prompt{}, fmt.Errorf("rendering prompt: %w", err)
+	}
+	prompt.User = user.String()
+	return prompt, nil
+}
+
+func modeOrDefault(mode string) string {
+	if mode == "" {
+		return DefaultMode
+	}
+	return mode
+}
@@ -0,0 +1,257 @@
+package prompts_test
+
+import (
+	"coach_demon/internal/openai"
+	"coach_demon/internal/prompts"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writePrompt(t *testing.T, dir, mode, kind, text string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, mode), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, mode, kind+".tmpl"), []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuiltinPrompts(t *testing.T) {
+	set, err := prompts.Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	data := prompts.Data{Statement: "Theatre Square", Code: "```\nint a;\n```\n", Thoughts: "ceil"}
+
+	feedback, err := set.Feedback("", data)
+	if want := "Problem statement:\nTheatre Square\n\nMy code:\n```\nint a;\n```\n\nMy thoughts:\nceil\n\n"; err != nil || feedback.User != want || feedback.System != "" {
+		t.Errorf("Feedback = %+v, %v; want user %q", feedback, err, want)
+	}
+
+	session := data
+	session.History = []prompts.PastFeedback{{Feedback: "int overflows"}, {Feedback: "loop bound is off\n"}}
+	session.Diff = "@@ -1,1 +1,1 @@\n-int a;\n+long long a;\n"
+	feedback, err = set.Feedback("", session)
+	if want := "Problem statement:\nTheatre Square\n\nMy code:\n```\nint a;\n```\n\nMy thoughts:\nceil\n\n" +
+		"Your earlier feedback in this session, oldest first:\n\nFeedback #1:\nint overflows\n\nFeedback #2:\nloop bound is off\n\n" +
+		"Changes to my code since your last feedback:\n```diff\n@@ -1,1 +1,1 @@\n-int a;\n+long long a;\n```\n\n" +
+		"Build on your earlier feedback: say what I fixed and what is still wrong, and do not repeat advice I have already followed.\n"; err != nil || feedback.User != want {
+		t.Errorf("Feedback with history = %q, %v; want %q", feedback.User, err, want)
+	}
+
+	hint, err := set.Hint("", openai.HintNudge, data)
+	if err != nil || !strings.HasSuffix(hint.User, "ceil\n\nI am asking for a hint at level \"nudge\". "+openai.HintInstruction(openai.HintNudge)+"\n") {
+		t.Errorf("Hint = %+v, %v", hint, err)
+	}
+
+	data.Feedbacks, data.Proofs = []string{"f1", "f2"}, []string{"p1"}
+	summary, err := set.Summary("", data)
+	want := "Problem statement:\nTheatre Square\n\nFeedbacks:\nFeedback #1:\nf1\n\nFeedback #2:\nf2\n\nProofs:\nProof #1:\np1\n\n"
+	if err != nil || summary.User != want {
+		t.Errorf("Summary = %q, %v; want %q", summary.User, err, want)
+	}
+
+	if _, err := set.Feedback("socratic", data); !errors.Is(err, prompts.ErrUnknownMode) {
+		t.Errorf("Feedback in an unknown mode: %v, want ErrUnknownMode", err)
+	}
+}
+
+func TestPromptDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writePrompt(t, dir, "default", "system", "You coach {{.Problem.ID}}.")
+	writePrompt(t, dir, "socratic", "feedback", "{{with .PreviousFeedback}}Last time: {{.}}\n{{end}}Ask me about {{.Language}}.")
+
+	set, err := prompts.Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := set.Modes(); len(got) != 2 || got[0] != "default" || got[1] != "socratic" {
+		t.Errorf("Modes = %v", got)
+	}
+
+	data := prompts.Data{Problem: prompts.NewProblem("1A"), Language: "C++", PreviousFeedback: "use ceil"}
+	prompt, err := set.Feedback("socratic", data)
+	if err != nil || prompt.System != "You coach 1A." || prompt.User != "Last time: use ceil\nAsk me about C++." {
+		t.Errorf("socratic Feedback = %+v, %v", prompt, err)
+	}
+	// Kinds a mode leaves out come from the default mode, then the built-ins.
+	prompt, err = set.Hint("socratic", openai.HintNudge, data)
+	if err != nil || prompt.System != "You coach 1A." || !strings.HasPrefix(prompt.User, "Problem statement:") {
+		t.Errorf("socratic Hint = %+v, %v", prompt, err)
+	}
+}
+
+func TestSocraticPrompt(t *testing.T) {
+	set, err := prompts.Load(filepath.Join("..", "..", "prompts"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	data := prompts.Data{Statement: "Theatre Square", Code: "```\nint a;\n```\n", Thoughts: "ceil", PreviousFeedback: "int overflows"}
+
+	feedback, err := set.Feedback("socratic", data)
+	if err != nil || !strings.Contains(feedback.User, "Your previous feedback:\nint overflows\n") {
+		t.Errorf("Feedback without history = %q, %v", feedback.User, err)
+	}
+
+	data.History = []prompts.PastFeedback{{Feedback: "int overflows"}, {Feedback: "loop bound is off\n"}}
+	feedback, err = set.Feedback("socratic", data)
+	if want := "Your earlier feedback, oldest first:\n\nint overflows\n\nloop bound is off\n"; err != nil || !strings.Contains(feedback.User, want) {
+		t.Errorf("Feedback with history = %q, %v; want it to contain %q", feedback.User, err, want)
+	}
+	if strings.Count(feedback.User, "Your earlier feedback") != 1 || strings.Contains(feedback.User, "Your previous feedback") {
+		t.Errorf("Feedback with history = %q; want the history header once and no previous feedback", feedback.User)
+	}
+}
+
+func TestFitContext(t *testing.T) {
+	history := []prompts.PastFeedback{{Feedback: "aaaaaaaaaa"}, {Feedback: "bbbbbbbbbb"}, {Feedback: "cccccccccc"}}
+	diff := "@@ -1,1 +1,1 @@\n-x\n+y\n"
+	feedbackTokens, diffTokens := prompts.EstimateTokens("cccccccccc"), prompts.EstimateTokens(diff)
+	tokens := func(history []prompts.PastFeedback, diff string) int {
+		n := prompts.EstimateTokens(diff)
+		for _, h := range history {
+			n += prompts.EstimateTokens(h.Feedback)
+		}
+		return n
+	}
+
+	got, gotDiff := prompts.FitContext(history, diff, 0)
+	if len(got) != 3 || gotDiff != diff {
+		t.Errorf("unlimited FitContext = %v, %q", got, gotDiff)
+	}
+
+	// The newest feedback and the diff come before older feedback.
+	got, gotDiff = prompts.FitContext(history, diff, 2*feedbackTokens+diffTokens+feedbackTokens-1)
+	if len(got) != 2 || got[0].Feedback != "bbbbbbbbbb" || got[1].Feedback != "cccccccccc" || gotDiff != diff {
+		t.Errorf("FitContext = %v, %q; want the last two and the diff", got, gotDiff)
+	}
+
+	budget := feedbackTokens + diffTokens - 1
+	got, gotDiff = prompts.FitContext(history, diff, budget)
+	if len(got) != 1 || got[0].Feedback != "cccccccccc" || !strings.HasSuffix(gotDiff, "[…]") || tokens(got, gotDiff) > budget {
+		t.Errorf("tight FitContext = %v, %q; want the newest and a truncated diff within %d tokens", got, gotDiff, budget)
+	}
+
+	got, gotDiff = prompts.FitContext(history, diff, 2)
+	if len(got) != 1 || !strings.HasPrefix(got[0].Feedback, "c") || !strings.HasSuffix(got[0].Feedback, "[…]") || gotDiff != "" || tokens(got, gotDiff) > 2 {
+		t.Errorf("tiny FitContext = %v, %q; want the newest truncated", got, gotDiff)
+	}
+	if history[2].Feedback != "cccccccccc" {
+		t.Errorf("FitContext modified its argument: %v", history)
+	}
+}
+
+func TestTokenBudget(t *testing.T) {
+	if got := prompts.EstimateTokens("int main() {}"); got != 4 {
+		t.Errorf("EstimateTokens = %d, want 4", got)
+	}
+
+	set, err := prompts.Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var source strings.Builder
+	for i := 1; i <= 300; i++ {
+		fmt.Fprintf(&source, "long long value%d = compute(%d); // step %d\n", i, i, i)
+	}
+	data := prompts.Data{
+		Statement: strings.Repeat("The statement goes on and on. ", 400),
+		Thoughts:  "binary search on the answer",
+		History: []prompts.PastFeedback{
+			{Feedback: strings.Repeat("old advice ", 200)},
+			{Feedback: strings.Repeat("older advice ", 200)},
+			{Feedback: "the loop bound is off by one"},
+		},
+		Diff: strings.Repeat("+changed line\n", 100),
+	}
+	data.SetCode(openai.Code{
+		Files:  []openai.SourceFile{{Path: "main.cpp", Content: source.String()}},
+		Cursor: &openai.Cursor{Path: "main.cpp", Line: 150, Column: 1},
+	})
+
+	unbounded, err := set.Feedback("", data)
+	if err != nil {
+		t.Fatalf("Feedback: %v", err)
+	}
+	data.MaxTokens = 2000
+	bounded, err := set.Feedback("", data)
+	if err != nil {
+		t.Fatalf("Feedback with a budget: %v", err)
+	}
+	if got := prompts.EstimateTokens(bounded.User); got > data.MaxTokens || got >= prompts.EstimateTokens(unbounded.User) {
+		t.Errorf("prompt of %d tokens, want at most %d", got, data.MaxTokens)
+	}
+	for _, want := range []string{"binary search on the answer", "the loop bound is off by one", "value150 =", "lines omitted"} {
+		if !strings.Contains(bounded.User, want) {
+			t.Errorf("bounded prompt lacks %q:\n%s", want, bounded.User)
+		}
+	}
+	if strings.Contains(bounded.User, "older advice") {
+		t.Error("bounded prompt kept old history")
+	}
+
+	data.MaxTokens = 10
+	if tiny, err := set.Feedback("", data); err != nil || !strings.Contains(tiny.User, "binary search on the answer") {
+		t.Errorf("Feedback with an impossible budget = %q, %v; want it shortened as far as possible", tiny.User, err)
+	}
+}
+
+func TestPromptValidation(t *testing.T) {
+	for name, write := range map[string]func(dir string){
+		"syntax":         func(dir string) { writePrompt(t, dir, "default", "feedback", "{{.Code") },
+		"unknown field":  func(dir string) { writePrompt(t, dir, "strict", "hint", "{{.Statment}}") },
+		"unknown kind":   func(dir string) { writePrompt(t, dir, "default", "feedbak", "hi") },
+		"unknown helper": func(dir string) { writePrompt(t, dir, "default", "summary", "{{upper .Statement}}") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			write(dir)
+			if _, err := prompts.Load(dir); err == nil {
+				t.Error("Load succeeded")
+			}
+		})
+	}
+}
+
+func TestLibraryReload(t *testing.T) {
+	dir := t.TempDir()
+	writePrompt(t, dir, "default", "feedback", "one")
+	lib, err := prompts.NewLibrary(dir)
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	if reloaded, err := lib.Reload(); reloaded || err != nil {
+		t.Fatalf("Reload without changes = %v, %v", reloaded, err)
+	}
+
+	// Make sure the modification time moves even on coarse file systems.
+	touch := func(path string) {
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePrompt(t, dir, "default", "feedback", "two")
+	touch(filepath.Join(dir, "default", "feedback.tmpl"))
+	if reloaded, err := lib.Reload(); !reloaded || err != nil {
+		t.Fatalf("Reload after a change = %v, %v", reloaded, err)
+	}
+	if prompt, _ := lib.Current().Feedback("", prompts.Data{}); prompt.User != "two" {
+		t.Errorf("Feedback after reload = %q, want two", prompt.User)
+	}
+
+	writePrompt(t, dir, "default", "feedback", "{{.Nope}}")
+	touch(filepath.Join(dir, "default", "feedback.tmpl"))
+	if _, err := lib.Reload(); err == nil {
+		t.Fatal("Reload of a broken prompt succeeded")
+	}
+	if prompt, _ := lib.Current().Feedback("", prompts.Data{}); prompt.User != "two" {
+		t.Errorf("Feedback after a failed reload = %q, want the previous two", prompt.User)
+	}
+}
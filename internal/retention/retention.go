@@ -0,0 +1,255 @@
+// Package retention bounds how much editor history is kept. Old snapshots
+// are compacted to the ones that matter for review, and the code of
+// anonymous sessions expires.
+package retention
+
+import (
+	"coach_demon/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// deleteBatch bounds the IDs passed to one DeleteSnapshots call.
+const deleteBatch = 500
+
+// Policy says how long history is kept. A zero duration disables that rule.
+type Policy struct {
+	// SnapshotsFor keeps every snapshot this long. Older snapshots are
+	// deleted unless feedback was generated from them or they are the last
+	// snapshot of their session.
+	SnapshotsFor time.Duration
+	// AnonymousCodeFor keeps the code of sessions without a user this long;
+	// after that it is cleared from snapshots, feedback and hints.
+	AnonymousCodeFor time.Duration
+}
+
+// Enabled reports whether any rule is on.
+func (p Policy) Enabled() bool {
+	return p.SnapshotsFor > 0 || p.AnonymousCodeFor > 0
+}
+
+// Report is what a run did, or in a dry run would have done.
+type Report struct {
+	DryRun bool `json:"dryRun"`
+	// SnapshotsExamined counts the snapshots older than SnapshotsFor.
+	SnapshotsExamined int `json:"snapshotsExamined"`
+	SnapshotsDeleted  int `json:"snapshotsDeleted"`
+	// AnonymousSessions counts the sessions whose old code expired;
+	// anonymous records made outside any session count as one.
+	AnonymousSessions int `json:"anonymousSessions"`
+	// CodeRedacted counts the records whose code was cleared. A dry run
+	// counts snapshots and feedback only.
+	CodeRedacted int `json:"codeRedacted"`
+}
+
+// Run applies p to s as of now. With dryRun nothing is changed.
+func Run(ctx context.Context, s storage.Storage, p Policy, now time.Time, dryRun bool) (Report, error) {
+	report := Report{DryRun: dryRun}
+	if p.SnapshotsFor > 0 {
+		if err := compactSnapshots(ctx, s, now.Add(-p.SnapshotsFor), dryRun, &report); err != nil {
+			return report, fmt.Errorf("snapshot compaction: %w", err)
+		}
+	}
+	if p.AnonymousCodeFor > 0 {
+		if err := expireAnonymousCode(ctx, s, now.Add(-p.AnonymousCodeFor), dryRun, &report); err != nil {
+			return report, fmt.Errorf("anonymous code expiry: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// compactSnapshots deletes the snapshots taken before cutoff that no
+// feedback refers to and that are not the last of their session. Problems
+// are compacted one at a time, so only one problem's old snapshots are held
+// in memory.
+func compactSnapshots(ctx context.Context, s storage.Storage, cutoff time.Time, dryRun bool, report *Report) error {
+	problems := make(map[string]bool)
+	err := walk(ctx, s.ListSnapshots, storage.ListQuery{AllUsers: true, Until: cutoff}, func(snapshot storage.Snapshot) {
+		problems[snapshot.ProblemID] = true
+	})
+	if err != nil {
+		return err
+	}
+	for _, problemID := range slices.Sorted(maps.Keys(problems)) {
+		if err := compactProblem(ctx, s, problemID, cutoff, dryRun, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactProblem compacts the snapshots of one problem taken before cutoff.
+func compactProblem(ctx context.Context, s storage.Storage, problemID string, cutoff time.Time, dryRun bool, report *Report) error {
+	var old []storage.Snapshot
+	err := walk(ctx, s.ListSnapshots, storage.ListQuery{AllUsers: true, ProblemID: problemID, Until: cutoff}, func(snapshot storage.Snapshot) {
+		// Only what compaction needs; snapshots can be large.
+		old = append(old, storage.Snapshot{
+			ID:        snapshot.ID,
+			UserID:    snapshot.UserID,
+			SessionID: snapshot.SessionID,
+			Timestamp: snapshot.Timestamp,
+		})
+	})
+	if err != nil || len(old) == 0 {
+		return err
+	}
+	report.SnapshotsExamined += len(old)
+
+	// Feedback comes after the snapshot it was generated from, so none
+	// older than the oldest snapshot can refer to one.
+	referenced := make(map[string]bool)
+	err = walk(ctx, s.ListFeedback, storage.ListQuery{AllUsers: true, ProblemID: problemID, Since: old[0].Timestamp}, func(entry storage.FeedbackEntry) {
+		if entry.SnapshotID != "" {
+			referenced[entry.SnapshotID] = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// The last old snapshot of a session is its final one unless the
+	// session went on after cutoff. Snapshots from before sessions existed
+	// are grouped per user, and their last old one is always kept.
+	type group struct{ sessionID, userID string }
+	last := make(map[group]string)
+	for _, snapshot := range old {
+		g := group{sessionID: snapshot.SessionID}
+		if snapshot.SessionID == "" {
+			g.userID = snapshot.UserID
+		}
+		last[g] = snapshot.ID
+	}
+	final := make(map[string]bool)
+	for g, id := range last {
+		if g.sessionID != "" {
+			later, err := s.ListSnapshots(ctx, storage.ListQuery{AllUsers: true, SessionID: g.sessionID, Since: cutoff, Limit: 1})
+			if err != nil {
+				return err
+			}
+			if len(later.Items) > 0 {
+				continue
+			}
+		}
+		final[id] = true
+	}
+
+	var doomed []string
+	for _, snapshot := range old {
+		if !referenced[snapshot.ID] && !final[snapshot.ID] {
+			doomed = append(doomed, snapshot.ID)
+		}
+	}
+	if dryRun {
+		report.SnapshotsDeleted += len(doomed)
+		return nil
+	}
+	for start := 0; start < len(doomed); start += deleteBatch {
+		n, err := s.DeleteSnapshots(ctx, doomed[start:min(start+deleteBatch, len(doomed))])
+		report.SnapshotsDeleted += n
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expireAnonymousCode clears the code recorded before cutoff in sessions
+// without a user, and by anonymous editors outside any session.
+func expireAnonymousCode(ctx context.Context, s storage.Storage, cutoff time.Time, dryRun bool, report *Report) error {
+	withCode := make(map[string]int) // session ID → records with code
+	err := walk(ctx, s.ListSnapshots, storage.ListQuery{AllUsers: true, Until: cutoff}, func(snapshot storage.Snapshot) {
+		if hasCode(snapshot) && (snapshot.SessionID != "" || snapshot.UserID == "") {
+			withCode[snapshot.SessionID]++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	err = walk(ctx, s.ListFeedback, storage.ListQuery{AllUsers: true, Until: cutoff}, func(entry storage.FeedbackEntry) {
+		if entry.Code != "" && (entry.SessionID != "" || entry.UserID == "") {
+			withCode[entry.SessionID]++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	// Hints are not listed, so the records made outside any session are
+	// always redacted even when no snapshot or feedback among them has code.
+	if _, ok := withCode[""]; !ok && !dryRun {
+		withCode[""] = 0
+	}
+
+	for sessionID, count := range withCode {
+		anonymous, err := isAnonymous(ctx, s, sessionID)
+		if err != nil {
+			return err
+		}
+		if !anonymous {
+			continue
+		}
+		if dryRun {
+			report.AnonymousSessions++
+			report.CodeRedacted += count
+			continue
+		}
+		n, err := s.RedactSessionCode(ctx, sessionID, cutoff)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			report.AnonymousSessions++
+			report.CodeRedacted += n
+		}
+	}
+	return nil
+}
+
+// isAnonymous reports whether a session has no user. Records outside any
+// session, or of a session that no longer exists, have none either.
+func isAnonymous(ctx context.Context, s storage.Storage, sessionID string) (bool, error) {
+	if sessionID == "" {
+		return true, nil
+	}
+	session, err := s.GetSession(ctx, sessionID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return session.UserID == "", nil
+}
+
+func hasCode(snapshot storage.Snapshot) bool {
+	if snapshot.Code != "" {
+		return true
+	}
+	for _, file := range snapshot.Files {
+		if file.Content != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls fn for every record of a listing, oldest first.
+func walk[T any](ctx context.Context, list func(context.Context, storage.ListQuery) (storage.Page[T], error), q storage.ListQuery, fn func(T)) error {
+	q.Limit = storage.MaxListLimit
+	for {
+		page, err := list(ctx, q)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			fn(item)
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
@@ -0,0 +1,186 @@
+package retention_test
+
+import (
+	"coach_demon/internal/retention"
+	"coach_demon/internal/storage"
+	"slices"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func snapshot(t *testing.T, s storage.Storage, sessionID string, age time.Duration) string {
+	t.Helper()
+	entry, err := s.SaveSnapshot(t.Context(), storage.Snapshot{
+		ProblemID: "1A",
+		SessionID: sessionID,
+		Timestamp: now.Add(-age),
+		Code:      "code",
+	})
+	must(t, err)
+	return entry.ID
+}
+
+func remaining(t *testing.T, s storage.Storage) []string {
+	t.Helper()
+	all, err := s.GetSnapshotsByProblemID(t.Context(), "", "1A")
+	must(t, err)
+	var ids []string
+	for _, entry := range all {
+		ids = append(ids, entry.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestCompactSnapshots(t *testing.T) {
+	ctx := t.Context()
+	s := storage.NewMemoryStore()
+	day := 24 * time.Hour
+
+	// An old session: three snapshots, the middle one with feedback.
+	snapshot(t, s, "old", 10*day)
+	oldFeedback := snapshot(t, s, "old", 10*day-time.Minute)
+	oldFinal := snapshot(t, s, "old", 10*day-2*time.Minute)
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ProblemID: "1A", SessionID: "old", SnapshotID: oldFeedback, Timestamp: now.Add(-9 * day)}))
+
+	// A session that started before the cutoff and went on after it.
+	snapshot(t, s, "spanning", 8*day)
+	spanningRecent := snapshot(t, s, "spanning", day)
+
+	// Recent snapshots are all kept.
+	recent := snapshot(t, s, "recent", time.Hour)
+	recentToo := snapshot(t, s, "recent", time.Minute)
+
+	policy := retention.Policy{SnapshotsFor: 7 * day}
+
+	report, err := retention.Run(ctx, s, policy, now, true)
+	must(t, err)
+	if report.SnapshotsExamined != 4 || report.SnapshotsDeleted != 2 {
+		t.Fatalf("dry run report = %+v, want 4 examined and 2 to delete", report)
+	}
+	if got := remaining(t, s); len(got) != 7 {
+		t.Fatalf("dry run deleted snapshots, %d left", len(got))
+	}
+
+	report, err = retention.Run(ctx, s, policy, now, false)
+	must(t, err)
+	if report.SnapshotsDeleted != 2 {
+		t.Fatalf("report = %+v, want 2 deleted", report)
+	}
+	want := []string{oldFeedback, oldFinal, spanningRecent, recent, recentToo}
+	slices.Sort(want)
+	if got := remaining(t, s); !slices.Equal(got, want) {
+		t.Fatalf("remaining snapshots = %v, want %v", got, want)
+	}
+}
+
+func TestCompactSnapshotsPerProblem(t *testing.T) {
+	ctx := t.Context()
+	s := storage.NewMemoryStore()
+	day := 24 * time.Hour
+
+	// More old snapshots than fit in one page of a listing.
+	var last string
+	for i := range storage.MaxListLimit + 10 {
+		last = snapshot(t, s, "long", 10*day-time.Duration(i)*time.Second)
+	}
+
+	// Another problem, partly from before sessions existed.
+	kept := make(map[string]string) // session ID → last snapshot ID
+	for i, sessionID := range []string{"", "", "other", "other"} {
+		entry, err := s.SaveSnapshot(ctx, storage.Snapshot{ProblemID: "2B", SessionID: sessionID, Timestamp: now.Add(-9*day + time.Duration(i)*time.Second), Code: "code"})
+		must(t, err)
+		kept[sessionID] = entry.ID
+	}
+
+	report, err := retention.Run(ctx, s, retention.Policy{SnapshotsFor: 7 * day}, now, false)
+	must(t, err)
+	if want := (retention.Report{SnapshotsExamined: storage.MaxListLimit + 14, SnapshotsDeleted: storage.MaxListLimit + 11}); report != want {
+		t.Fatalf("report = %+v, want %+v", report, want)
+	}
+	if got := remaining(t, s); !slices.Equal(got, []string{last}) {
+		t.Fatalf("snapshots of 1A left = %v, want only the last one", got)
+	}
+	other, err := s.GetSnapshotsByProblemID(ctx, "", "2B")
+	must(t, err)
+	if len(other) != 2 || other[0].ID != kept[""] || other[1].ID != kept["other"] {
+		t.Fatalf("snapshots of 2B left = %+v, want the last without a session and the last of the session", other)
+	}
+}
+
+func TestCompactSnapshotsPerUser(t *testing.T) {
+	ctx := t.Context()
+	s := storage.NewMemoryStore()
+	day := 24 * time.Hour
+
+	// Two users on the same problem, from before sessions existed.
+	var ids []string
+	for i, userID := range []string{"alice", "bob", "alice", "bob"} {
+		entry, err := s.SaveSnapshot(ctx, storage.Snapshot{
+			UserID:    userID,
+			ProblemID: "1A",
+			Timestamp: now.Add(-10*day + time.Duration(i)*time.Minute),
+			Code:      "code",
+		})
+		must(t, err)
+		ids = append(ids, entry.ID)
+	}
+
+	report, err := retention.Run(ctx, s, retention.Policy{SnapshotsFor: 7 * day}, now, false)
+	must(t, err)
+	if report.SnapshotsExamined != 4 || report.SnapshotsDeleted != 2 {
+		t.Fatalf("report = %+v, want 4 examined and 2 deleted", report)
+	}
+	// Each user keeps their last snapshot.
+	for i, wantKept := range []bool{false, false, true, true} {
+		_, err := s.GetSnapshot(ctx, ids[i])
+		if kept := err == nil; kept != wantKept {
+			t.Fatalf("snapshot %d kept: %v (%v), want %v", i, kept, err, wantKept)
+		}
+	}
+}
+
+func TestExpireAnonymousCode(t *testing.T) {
+	ctx := t.Context()
+	s := storage.NewMemoryStore()
+
+	anon, err := s.CreateSession(ctx, storage.Session{ProblemID: "1A"})
+	must(t, err)
+	alice, err := s.CreateSession(ctx, storage.Session{ProblemID: "1A", UserID: "alice"})
+	must(t, err)
+
+	anonOld := snapshot(t, s, anon.ID, 48*time.Hour)
+	anonRecent := snapshot(t, s, anon.ID, time.Minute)
+	aliceOld := snapshot(t, s, alice.ID, 48*time.Hour)
+	must(t, s.SaveHint(ctx, storage.HintEntry{ProblemID: "1A", SessionID: anon.ID, Timestamp: now.Add(-48 * time.Hour), Code: "code"}))
+
+	policy := retention.Policy{AnonymousCodeFor: 24 * time.Hour}
+	report, err := retention.Run(ctx, s, policy, now, true)
+	must(t, err)
+	if report.AnonymousSessions != 1 || report.CodeRedacted != 1 {
+		t.Fatalf("dry run report = %+v, want 1 session and 1 record", report)
+	}
+
+	report, err = retention.Run(ctx, s, policy, now, false)
+	must(t, err)
+	if report.AnonymousSessions != 1 || report.CodeRedacted != 2 {
+		t.Fatalf("report = %+v, want 1 session and 2 records", report)
+	}
+
+	for id, wantCode := range map[string]bool{anonOld: false, anonRecent: true, aliceOld: true} {
+		got, err := s.GetSnapshot(ctx, id)
+		must(t, err)
+		if (got.Code != "") != wantCode {
+			t.Fatalf("snapshot %s has code %q, want code kept: %v", id, got.Code, wantCode)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Package search matches free-text queries against stored text the way
+// MongoDB text search does: words are matched case-insensitively on their
+// stem, "quoted phrases" must all appear and -words must not.
+package search
+
+import (
+	"cmp"
+	"html"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed search string.
+type Query struct {
+	// Terms match when any of them appears.
+	Terms []string
+	// Phrases must all appear, each as a run of consecutive words.
+	Phrases [][]string
+	// Exclude rules out texts containing any of these words.
+	Exclude []string
+}
+
+// Parse splits q into terms, "phrases" and -excluded words, all stemmed.
+// Common English words are dropped, as MongoDB does.
+func Parse(q string) Query {
+	var query Query
+	for len(q) > 0 {
+		q = strings.TrimLeftFunc(q, unicode.IsSpace)
+		switch {
+		case q == "":
+		case q[0] == '"':
+			end := strings.IndexByte(q[1:], '"')
+			phrase := q[1:]
+			if end >= 0 {
+				phrase, q = q[1:end+1], q[end+2:]
+			} else {
+				q = ""
+			}
+			if words := stems(phrase, false); len(words) > 0 {
+				query.Phrases = append(query.Phrases, words)
+			}
+		default:
+			word := q
+			if end := strings.IndexFunc(q, unicode.IsSpace); end >= 0 {
+				word, q = q[:end], q[end:]
+			} else {
+				q = ""
+			}
+			if strings.HasPrefix(word, "-") {
+				query.Exclude = append(query.Exclude, stems(word[1:], true)...)
+			} else {
+				query.Terms = append(query.Terms, stems(word, true)...)
+			}
+		}
+	}
+	return query
+}
+
+// Empty reports whether the query has nothing to match.
+func (q Query) Empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0
+}
+
+// Score rates a record whose searchable text is split over fields: 0 when
+// it does not match, otherwise higher for more matches in shorter text.
+func (q Query) Score(fields ...string) float64 {
+	if q.Empty() {
+		return 0
+	}
+	var score float64
+	phrasesFound := make([]bool, len(q.Phrases))
+	for _, field := range fields {
+		words := tokenize(field)
+		if len(words) == 0 {
+			continue
+		}
+		matches := 0
+		for _, w := range words {
+			if slices.Contains(q.Exclude, w.stem) {
+				return 0
+			}
+			if slices.Contains(q.Terms, w.stem) {
+				matches++
+			}
+		}
+		for i, phrase := range q.Phrases {
+			if n := len(phraseSpans(words, phrase)); n > 0 {
+				phrasesFound[i] = true
+				matches += n * len(phrase)
+			}
+		}
+		score += float64(matches) / (1 + math.Log(float64(len(words))))
+	}
+	for _, found := range phrasesFound {
+		if !found {
+			return 0
+		}
+	}
+	if len(q.Terms) == 0 || score > 0 {
+		return score
+	}
+	return 0
+}
+
+// Highlight returns a snippet of about width characters around the first
+// match in text, HTML-escaped, with every match wrapped in <mark>. ok is
+// false when text has no match.
+func (q Query) Highlight(text string, width int) (snippet string, ok bool) {
+	words := tokenize(text)
+	var spans [][2]int // byte ranges of text
+	for _, w := range words {
+		if slices.Contains(q.Terms, w.stem) {
+			spans = append(spans, [2]int{w.start, w.end})
+		}
+	}
+	for _, phrase := range q.Phrases {
+		for _, span := range phraseSpans(words, phrase) {
+			spans = append(spans, [2]int{words[span[0]].start, words[span[1]-1].end})
+		}
+	}
+	if len(spans) == 0 {
+		return "", false
+	}
+	spans = mergeSpans(spans)
+
+	// Center the window on the first match, on word boundaries.
+	from := max(0, spans[0][0]-width/3)
+	to := min(len(text), from+width)
+	from = wordStart(text, from)
+	to = wordEnd(text, to)
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	at := from
+	for _, span := range spans {
+		if span[0] < from || span[1] > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[at:span[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[span[0]:span[1]]))
+		b.WriteString("</mark>")
+		at = span[1]
+	}
+	b.WriteString(html.EscapeString(text[at:to]))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return strings.Join(strings.Fields(b.String()), " "), true
+}
+
+type word struct {
+	stem       string
+	start, end int
+}
+
+// tokenize splits text into words of letters and digits.
+func tokenize(text string) []word {
+	var words []word
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			words = append(words, word{stem: stem(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{stem: stem(text[start:]), start: start, end: len(text)})
+	}
+	return words
+}
+
+// stems returns the stems of the words of s, without stop words when drop
+// is set.
+func stems(s string, drop bool) []string {
+	var out []string
+	for _, w := range tokenize(s) {
+		if drop && stopWords[w.stem] {
+			continue
+		}
+		out = append(out, w.stem)
+	}
+	return out
+}
+
+// stem lower-cases w and strips common English inflections, so that
+// "exchange", "exchanges" and "exchanging" compare equal.
+func stem(w string) string {
+	w = strings.ToLower(w)
+	strip := func(suffix string) bool {
+		if strings.HasSuffix(w, suffix) && len(w)-len(suffix) >= 3 {
+			w = w[:len(w)-len(suffix)]
+			return true
+		}
+		return false
+	}
+	if !strings.HasSuffix(w, "ss") {
+		strip("s")
+	}
+	_ = strip("ing") || strip("ed")
+	strip("e")
+	return w
+}
+
+// phraseSpans returns the word index ranges [start, end) where phrase occurs.
+func phraseSpans(words []word, phrase []string) [][2]int {
+	var spans [][2]int
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		match := true
+		for j, s := range phrase {
+			if words[i+j].stem != s {
+				match = false
+				break
+			}
+		}
+		if match {
+			spans = append(spans, [2]int{i, i + len(phrase)})
+		}
+	}
+	return spans
+}
+
+// mergeSpans sorts spans and joins overlapping ones.
+func mergeSpans(spans [][2]int) [][2]int {
+	slices.SortFunc(spans, func(a, b [2]int) int { return cmp.Compare(a[0], b[0]) })
+	merged := spans[:1]
+	for _, span := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if span[0] <= last[1] {
+			last[1] = max(last[1], span[1])
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+func wordStart(text string, i int) int {
+	for i > 0 && !unicode.IsSpace(rune(text[i-1])) {
+		i--
+	}
+	return i
+}
+
+func wordEnd(text string, i int) int {
+	for i < len(text) && !unicode.IsSpace(rune(text[i])) {
+		i++
+	}
+	return i
+}
+
+// stopWords are ignored in queries, a subset of MongoDB's English list.
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an and are as at be but by for from how i if in into is it
+		its of on or so such that the their then there these this to was were what when where which
+		while who will with you your`) {
+		stopWords[stem(w)] = true
+	}
+}
@@ -0,0 +1,58 @@
+package search
+
+import "testing"
+
+func TestScore(t *testing.T) {
+	const feedback = "Use an exchange argument: swapping two adjacent jobs never helps."
+	tests := []struct {
+		query string
+		match bool
+	}{
+		{"exchange", true},
+		{"Exchanges", true},
+		{"exchanging", true},
+		{"greedy exchange", true},
+		{"greedy", false},
+		{`"exchange argument"`, true},
+		{`"argument exchange"`, false},
+		{`"exchange argument" greedy`, true},
+		{"exchange -swapping", false},
+		{"the", false},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.query).Score("", feedback) > 0; got != tt.match {
+			t.Errorf("Parse(%q).Score matched = %v, want %v", tt.query, got, tt.match)
+		}
+	}
+}
+
+func TestScorePrefersDenserMatches(t *testing.T) {
+	q := Parse("segment tree")
+	short := q.Score("Build a segment tree.")
+	long := q.Score("Build a segment tree, then answer the queries in any order you like, offline or online.")
+	if short <= long {
+		t.Fatalf("score of the short text %v <= long text %v", short, long)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	q := Parse(`"exchange argument" <b>`)
+	snippet, ok := q.Highlight("Try an <b>exchange argument</b> here.", 80)
+	if !ok {
+		t.Fatal("Highlight found no match")
+	}
+	want := "Try an &lt;<mark>b</mark>&gt;<mark>exchange argument</mark>&lt;/<mark>b</mark>&gt; here."
+	if snippet != want {
+		t.Fatalf("Highlight = %q, want %q", snippet, want)
+	}
+
+	text := "one two three four five six seven eight nine ten eleven twelve needle thirteen fourteen"
+	snippet, _ = Parse("needle").Highlight(text, 30)
+	if snippet != "…eleven twelve <mark>needle</mark> thirteen fourteen" {
+		t.Fatalf("Highlight with a window = %q", snippet)
+	}
+
+	if _, ok := Parse("absent").Highlight(text, 30); ok {
+		t.Fatal("Highlight matched an absent word")
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"coach_demon/internal/archive"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// getExport streams an archive of the user's records of the selected
+// problems, all by default. ?problems=1A,2B filters and ?gzip=true
+// compresses it.
+func getExport(ctx *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts := archive.Options{
+			ProblemIDs: problemList(r),
+			UserIDs:    []string{getUserID(r.Context())},
+			Gzip:       r.URL.Query().Get("gzip") == "true",
+		}
+
+		name := "coach_demon-" + time.Now().UTC().Format("20060102-150405") + ".jsonl"
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		if opts.Gzip {
+			name += ".gz"
+			w.Header().Set("Content-Type", "application/gzip")
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+		// Headers are sent with the first record, so a failure halfway can
+		// only cut the archive short; Import rejects the truncated line.
+		stats, err := archive.Export(r.Context(), ctx.Store, w, opts)
+		if err != nil {
+			ctx.Logger.Error().Msgf("failed to export archive: %v", err)
+			return
+		}
+		ctx.Logger.Info().Interface("stats", stats).Msg("exported archive")
+	}
+}
+
+// postImport loads the user's records from an archive in the request body,
+// optionally limited to ?problems=1A,2B, and answers with what was imported.
+func postImport(ctx *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts := archive.Options{
+			ProblemIDs: problemList(r),
+			UserIDs:    []string{getUserID(r.Context())},
+		}
+		stats, err := archive.Import(r.Context(), ctx.Store, r.Body, opts)
+		switch {
+		case errors.Is(err, archive.ErrMalformed), errors.Is(err, archive.ErrUnsupportedVersion):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			ctx.Logger.Error().Msgf("failed to import archive after %+v: %v", stats, err)
+			http.Error(w, "internal error importing archive", storageStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats); err != nil {
+			ctx.Logger.Error().Msgf("failed to encode import stats: %v", err)
+			http.Error(w, "internal error encoding import stats", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func problemList(r *http.Request) []string {
+	return strings.FieldsFunc(r.URL.Query().Get("problems"), func(c rune) bool { return c == ',' || c == ' ' })
+}
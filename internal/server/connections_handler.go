@@ -0,0 +1,25 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"encoding/json"
+	"net/http"
+)
+
+type connectionsResponse struct {
+	Count       int              `json:"count"`
+	Connections []ConnectionInfo `json:"connections"`
+}
+
+func getConnections(ctx *app.App, reg *connRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conns := reg.List(getUserID(r.Context()))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(connectionsResponse{Count: len(conns), Connections: conns}); err != nil {
+			ctx.Logger.Error().Msgf("failed to encode connections: %v", err)
+			http.Error(w, "internal error encoding connections", http.StatusInternalServerError)
+			return
+		}
+	}
+}
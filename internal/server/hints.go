@@ -0,0 +1,104 @@
+package server
+
+import (
+	"cmp"
+	"coach_demon/internal/app"
+	"coach_demon/internal/openai"
+	"coach_demon/internal/prompts"
+	"coach_demon/internal/storage"
+	"coach_demon/pkg/codeforces"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errBadHintLevel = errors.New("bad hint level")
+
+// hintRequest is a hint asked for over the WebSocket or REST.
+type hintRequest struct {
+	UserID    string
+	ProblemID string
+	SessionID string
+	Level     string
+	Mode      string // coaching mode, "" for the server's default
+	Code      openai.Code
+	Thoughts  string
+}
+
+// requestHint asks the AI for a hint at the requested level and stores it.
+// Without code and thoughts the user's latest snapshot of the problem is used.
+func requestHint(ctx context.Context, a *app.App, aiLimit limiter, req hintRequest) (*storage.HintEntry, error) {
+	level, err := openai.ParseHintLevel(req.Level)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadHintLevel, err)
+	}
+	if _, _, err := codeforces.ParseID(req.ProblemID); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", errUnknownProblem, req.ProblemID, err)
+	}
+
+	statement, err := loadStatement(ctx, a, req.ProblemID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Code.Files) == 0 && req.Thoughts == "" {
+		latest, err := a.Store.GetLatestSnapshot(ctx, req.UserID, req.ProblemID)
+		switch {
+		case err == nil:
+			req.Code, req.Thoughts = snapshotCode(*latest), latest.Thoughts
+		case !errors.Is(err, storage.ErrNotFound):
+			return nil, err
+		}
+	}
+
+	data := prompts.Data{
+		Problem:   prompts.NewProblem(req.ProblemID),
+		Statement: promptStatement(a, req.ProblemID, statement.Statement),
+		Thoughts:  req.Thoughts,
+		MaxTokens: a.PromptTokens,
+	}
+	data.SetCode(req.Code)
+	previous, err := a.Store.GetLatestFeedback(ctx, req.UserID, req.ProblemID)
+	switch {
+	case err == nil:
+		data.PreviousFeedback = previous.Feedback
+	case !errors.Is(err, storage.ErrNotFound):
+		return nil, err
+	}
+	prompt, err := a.Prompts.Current().Hint(cmp.Or(req.Mode, a.PromptMode), level, data)
+	if err != nil {
+		return nil, err
+	}
+	logPrompt(a, prompts.KindHint, req.ProblemID, data, prompt)
+
+	if err := aiLimit.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	a.Logger.Info().Str("level", string(level)).Msgf("asking OpenAI for a hint for %s", req.ProblemID)
+	hint, err := a.AI.GetHint(ctx, level, prompt)
+	aiLimit.Release()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hint: %w", err)
+	}
+
+	entry := storage.HintEntry{
+		ID:          storage.NewID(),
+		UserID:      req.UserID,
+		SessionID:   req.SessionID,
+		ProblemID:   req.ProblemID,
+		Level:       string(level),
+		Timestamp:   time.Now().UTC(),
+		Code:        req.Code.Text(),
+		Thoughts:    req.Thoughts,
+		Hint:        hint.Hint,
+		Observation: hint.Observation,
+		Outline:     hint.Outline,
+		Proof:       hint.Proof,
+		Complexity:  hint.Complexity,
+	}
+	if err := a.Store.SaveHint(ctx, entry); err != nil {
+		a.Logger.Warn().Err(err).Msg("saving hint failed")
+	}
+	return &entry, nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"coach_demon/internal/prompts"
+	"coach_demon/internal/storage"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type hintRequestBody struct {
+	HintRequestMessage
+	SessionID string `json:"sessionId,omitempty"`
+}
+
+func postHint(ctx *app.App, aiLimit limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		problemID := chi.URLParam(r, "problemId")
+		userID := getUserID(r.Context())
+
+		var body hintRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if body.SessionID != "" {
+			session, err := ctx.Store.GetSession(r.Context(), body.SessionID)
+			if errors.Is(err, storage.ErrNotFound) || (err == nil && session.UserID != userID) {
+				http.Error(w, "no session found for this ID", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				ctx.Logger.Error().Msgf("failed to get session %s: %v", body.SessionID, err)
+				http.Error(w, "internal error fetching session", storageStatus(err))
+				return
+			}
+		}
+
+		entry, err := requestHint(r.Context(), ctx, aiLimit, hintRequest{
+			UserID:    userID,
+			ProblemID: problemID,
+			SessionID: body.SessionID,
+			Level:     body.Level,
+			Mode:      body.Mode,
+			Code:      body.code(),
+			Thoughts:  body.Thoughts,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, errBadHintLevel), errors.Is(err, prompts.ErrUnknownMode):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, errUnknownProblem):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, errFetchFailed):
+				ctx.Logger.Error().Msgf("failed to fetch statement for %s: %v", problemID, err)
+				http.Error(w, "could not fetch problem statement", http.StatusBadGateway)
+			default:
+				ctx.Logger.Error().Msgf("failed to get hint for %s: %v", problemID, err)
+				http.Error(w, "internal error getting hint", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(newHintMessage(*entry)); err != nil {
+			ctx.Logger.Error().Msgf("failed to encode hint: %v", err)
+			http.Error(w, "internal error encoding hint", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func getHints(ctx *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		problemID := chi.URLParam(r, "problemId")
+
+		entries, err := ctx.Store.GetHintsByProblemID(r.Context(), getUserID(r.Context()), problemID)
+		if err != nil {
+			ctx.Logger.Error().Msgf("failed to get hints for %s: %v", problemID, err)
+			http.Error(w, "internal error fetching hints", storageStatus(err))
+			return
+		}
+
+		hints := make([]HintMessage, 0, len(entries))
+		for _, entry := range entries {
+			hints = append(hints, newHintMessage(entry))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(hints); err != nil {
+			ctx.Logger.Error().Msgf("failed to encode hints: %v", err)
+			http.Error(w, "internal error encoding hints", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"coach_demon/internal/openai"
+	"coach_demon/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestHint(t *testing.T) {
+	store := newTestStore(t, map[string]string{"1A": "Theatre Square"})
+	for _, code := range []string{"v1", "v2"} {
+		if _, err := store.SaveSnapshot(context.Background(), storage.Snapshot{ProblemID: "1A", Code: code, Thoughts: "ceil " + code}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		req          hintRequest
+		wantErr      error
+		wantCode     string
+		wantThoughts string
+	}{
+		{
+			name:    "unknown level",
+			req:     hintRequest{ProblemID: "1A", Level: "solution"},
+			wantErr: errBadHintLevel,
+		},
+		{
+			name:    "missing level",
+			req:     hintRequest{ProblemID: "1A"},
+			wantErr: errBadHintLevel,
+		},
+		{
+			name:    "bad problem",
+			req:     hintRequest{ProblemID: "A1", Level: "nudge"},
+			wantErr: errUnknownProblem,
+		},
+		{
+			name:         "latest snapshot",
+			req:          hintRequest{ProblemID: "1A", Level: "nudge"},
+			wantCode:     "v2",
+			wantThoughts: "ceil v2",
+		},
+		{
+			name:         "own code",
+			req:          hintRequest{ProblemID: "1A", Level: "outline", Code: openai.PlainCode("v3")},
+			wantCode:     "v3",
+			wantThoughts: "",
+		},
+		{
+			name:         "own thoughts",
+			req:          hintRequest{ProblemID: "1A", Level: "proof", Thoughts: "binary search?"},
+			wantCode:     "",
+			wantThoughts: "binary search?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &responsesAPI{output: `{"hint":"What if n is 1?"}`}
+			a := testApp(t, store, testAI(t, api))
+
+			entry, err := requestHint(context.Background(), a, newLimiter(1), tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if len(api.requests) != 0 {
+					t.Errorf("AI asked despite the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Level != tt.req.Level || entry.Code != tt.wantCode || entry.Thoughts != tt.wantThoughts || entry.Hint != "What if n is 1?" {
+				t.Errorf("hint = %+v, want %s on code %q and thoughts %q", entry, tt.req.Level, tt.wantCode, tt.wantThoughts)
+			}
+			if len(api.requests) != 1 || !strings.Contains(api.requests[0], "coach_hint_"+tt.req.Level) {
+				t.Errorf("AI requests %q, want one %s hint", api.requests, tt.req.Level)
+			}
+		})
+	}
+}
+
+func TestHintRequestsAreAnsweredOneAtATime(t *testing.T) {
+	api := &responsesAPI{
+		output:  `{"hint":"What if n is 1?"}`,
+		calls:   make(chan string, 10),
+		release: make(chan struct{}),
+	}
+	store := newTestStore(t, map[string]string{"1A": "Theatre Square"})
+	conn := dialWS(t, testApp(t, store, testAI(t, api)))
+	writeFrame(t, conn, `{"type":"hello","payload":{"versions":[1]}}`)
+	readFrame(t, conn)
+
+	writeFrame(t, conn, `{"type":"hint_request","id":"h1","payload":{"problemId":"1A","level":"nudge","code":"x"}}`)
+	select {
+	case <-api.calls:
+	case <-time.After(2 * time.Second):
+		t.Fatal("first hint request did not reach the AI")
+	}
+	writeFrame(t, conn, `{"type":"hint_request","id":"h2","payload":{"problemId":"1A","level":"proof","code":"x"}}`)
+	f := readFrame(t, conn)
+	var msg ErrorMessage
+	if err := json.Unmarshal(f.Payload, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != TypeError || f.ReplyTo != "h2" || msg.Code != ErrCodeBusy {
+		t.Fatalf("second request got %s %+v (replyTo %q), want a busy error", f.Type, msg, f.ReplyTo)
+	}
+
+	close(api.release)
+	if f := readUntil(t, conn, TypeHint); f.ReplyTo != "h1" {
+		t.Errorf("hint answers %q, want h1", f.ReplyTo)
+	}
+	writeFrame(t, conn, `{"type":"hint_request","id":"h3","payload":{"problemId":"1A","level":"outline","code":"x"}}`)
+	<-api.calls
+	if f := readUntil(t, conn, TypeHint); f.ReplyTo != "h3" {
+		t.Errorf("hint answers %q, want h3", f.ReplyTo)
+	}
+}
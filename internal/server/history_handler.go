@@ -0,0 +1,191 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"coach_demon/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// listResponse is a page of a feedback or snapshot listing. Items holds the
+// records, reduced to the requested fields.
+type listResponse struct {
+	Items      []map[string]json.RawMessage `json:"items"`
+	NextCursor string                       `json:"nextCursor,omitempty"`
+}
+
+func getProblemFeedback(ctx *app.App) http.HandlerFunc {
+	return listHandler(ctx, "feedback", ctx.Store.ListFeedback, func(r *http.Request, q *storage.ListQuery) {
+		q.ProblemID = chi.URLParam(r, "problemId")
+	})
+}
+
+func getSessionFeedback(ctx *app.App) http.HandlerFunc {
+	return listHandler(ctx, "feedback", ctx.Store.ListFeedback, func(r *http.Request, q *storage.ListQuery) {
+		q.SessionID = chi.URLParam(r, "sessionId")
+	})
+}
+
+func getProblemSnapshots(ctx *app.App) http.HandlerFunc {
+	return listHandler(ctx, "snapshots", ctx.Store.ListSnapshots, func(r *http.Request, q *storage.ListQuery) {
+		q.ProblemID = chi.URLParam(r, "problemId")
+	})
+}
+
+func getSessionSnapshots(ctx *app.App) http.HandlerFunc {
+	return listHandler(ctx, "snapshots", ctx.Store.ListSnapshots, func(r *http.Request, q *storage.ListQuery) {
+		q.SessionID = chi.URLParam(r, "sessionId")
+	})
+}
+
+// listHandler serves a paginated listing. scope fills in the problem or
+// session from the path; the rest of the query comes from the URL query.
+func listHandler[T any](
+	ctx *app.App,
+	what string,
+	list func(context.Context, storage.ListQuery) (storage.Page[T], error),
+	scope func(*http.Request, *storage.ListQuery),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseListQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		scope(r, &q)
+		fields, err := parseFields[T](r.URL.Query().Get("fields"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := list(r.Context(), q)
+		if errors.Is(err, storage.ErrBadCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			ctx.Logger.Error().Msgf("failed to list %s: %v", what, err)
+			http.Error(w, "internal error listing "+what, storageStatus(err))
+			return
+		}
+
+		resp := listResponse{Items: make([]map[string]json.RawMessage, 0, len(page.Items)), NextCursor: page.NextCursor}
+		for _, item := range page.Items {
+			projected, err := project(item, fields)
+			if err != nil {
+				ctx.Logger.Error().Msgf("failed to encode %s: %v", what, err)
+				http.Error(w, "internal error encoding "+what, http.StatusInternalServerError)
+				return
+			}
+			resp.Items = append(resp.Items, projected)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			ctx.Logger.Error().Msgf("failed to encode %s: %v", what, err)
+			http.Error(w, "internal error encoding "+what, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// parseListQuery reads limit, cursor, since, until (RFC 3339) and order
+// (asc or desc, the default) from the URL query, and lists the records of
+// the request's user.
+func parseListQuery(r *http.Request) (storage.ListQuery, error) {
+	query := r.URL.Query()
+	q := storage.ListQuery{UserID: getUserID(r.Context()), Cursor: query.Get("cursor"), Descending: true}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > storage.MaxListLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", storage.MaxListLimit)
+		}
+		q.Limit = n
+	}
+	for param, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return q, fmt.Errorf("%s must be an RFC 3339 time", param)
+		}
+		*dst = t
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		q.Descending = false
+	default:
+		return q, errors.New("order must be asc or desc")
+	}
+	return q, nil
+}
+
+// parseFields splits a comma-separated list of JSON field names of T, matched
+// case-insensitively. An empty list keeps every field.
+func parseFields[T any](list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var zero T
+	known, err := toFields(zero)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		field, ok := "", false
+		for key := range known {
+			if strings.EqualFold(key, name) {
+				field, ok = key, true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// project encodes item keeping only fields, or everything when fields is empty.
+func project(item any, fields []string) (map[string]json.RawMessage, error) {
+	all, err := toFields(item)
+	if err != nil || len(fields) == 0 {
+		return all, err
+	}
+	projected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected, nil
+}
+
+func toFields(item any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,27 @@
+package server
+
+import "context"
+
+// limiter bounds how many AI requests run at once across all connections.
+type limiter chan struct{}
+
+func newLimiter(n int) limiter {
+	if n <= 0 {
+		n = 1
+	}
+	return make(limiter, n)
+}
+
+// Acquire blocks until a slot is free or ctx is done.
+func (l limiter) Acquire(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l limiter) Release() {
+	<-l
+}
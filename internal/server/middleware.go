@@ -23,7 +23,7 @@ func CORS(h http.Handler) http.Handler {
 		if origin != "" {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 			w.Header().Set("Vary", "Origin")
-			w.Header().Set("Access-Control-Allow-Headers", "Authorization,Content-Type")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization,Content-Type,"+UserHeader)
 			w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
 		}
 		if r.Method == http.MethodOptions {
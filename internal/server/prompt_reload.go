@@ -0,0 +1,34 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"context"
+	"time"
+)
+
+// RunPromptReload checks the prompt directory for changes every
+// ctx.PromptReloadInterval until runCtx is done. Prompts that fail to load
+// are logged and the previous ones stay in use.
+func RunPromptReload(runCtx context.Context, ctx *app.App) {
+	if ctx.Prompts.Dir() == "" || ctx.PromptReloadInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(ctx.PromptReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-runCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := ctx.Prompts.Reload()
+		if err != nil {
+			ctx.Logger.Warn().Err(err).Msg("reloading prompts failed, keeping the previous ones")
+		} else if reloaded {
+			ctx.Logger.Info().Strs("modes", ctx.Prompts.Current().Modes()).Msg("reloaded prompts")
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"coach_demon/internal/openai"
+	"coach_demon/internal/prompts"
+	"coach_demon/pkg/codeforces"
+)
+
+// promptStatement condenses a stored statement for a prompt. Statements are
+// stored as fetched, so the conversion improves without refetching them.
+func promptStatement(a *app.App, problemID, statement string) string {
+	markdown, err := codeforces.StatementMarkdown(statement)
+	if err != nil {
+		a.Logger.Warn().Err(err).Str("problemId", problemID).Msg("condensing statement failed, prompting with it as stored")
+		return statement
+	}
+	return markdown
+}
+
+// logPrompt reports the estimated size of a prompt and of each part of data
+// before it was fitted to the budget, and warns when the prompt could not be
+// shortened enough.
+func logPrompt(a *app.App, kind, problemID string, data prompts.Data, prompt openai.Prompt) {
+	tokens := prompts.EstimateTokens(prompt.System) + prompts.EstimateTokens(prompt.User)
+	event := a.Logger.Debug()
+	if data.MaxTokens > 0 && tokens > data.MaxTokens {
+		event = a.Logger.Warn()
+	}
+	event.Str("problemId", problemID).Str("kind", kind).Int("tokens", tokens).Int("budget", data.MaxTokens).
+		Interface("sections", data.Estimate()).Msg("prompt size")
+}
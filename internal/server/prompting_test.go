@@ -0,0 +1,93 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"coach_demon/internal/openai"
+	"coach_demon/internal/prompts"
+	"coach_demon/internal/storage"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// capturingAI is the Fake provider recording the summary prompts it gets.
+type capturingAI struct {
+	openai.Fake
+	prompts []openai.Prompt
+}
+
+func (c *capturingAI) SummarizeFeedback(ctx context.Context, prompt openai.Prompt) (openai.Summary, error) {
+	c.prompts = append(c.prompts, prompt)
+	return c.Fake.SummarizeFeedback(ctx, prompt)
+}
+
+func TestPromptFitsTokenBudget(t *testing.T) {
+	const statementEnd = "The statement ends here."
+	statement := strings.Repeat("Every square of the plaza must be covered by flagstones. ", 1000) + statementEnd
+
+	summaryPrompt := func(t *testing.T, budget int) string {
+		t.Helper()
+		ctx := t.Context()
+		store := storage.NewMemoryStore()
+		if err := store.SaveStatement(ctx, storage.StatementEntry{ProblemID: "1A", Statement: statement}); err != nil {
+			t.Fatal(err)
+		}
+		for i := range 10 {
+			err := store.SaveFeedback(ctx, storage.FeedbackEntry{
+				ID:        storage.NewID(),
+				ProblemID: "1A",
+				Feedback:  fmt.Sprintf("feedback %d: ", i) + strings.Repeat("round the side up, ", 200),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		library, err := prompts.NewLibrary("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := zerolog.Nop()
+		ai := &capturingAI{}
+		srv := httptest.NewServer(New(&app.App{
+			Store:           store,
+			AI:              ai,
+			Logger:          &logger,
+			Prompts:         library,
+			PromptTokens:    budget,
+			MaxConcurrentAI: 1,
+		}))
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL + "/summary/1A")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || len(ai.prompts) != 1 {
+			t.Fatalf("GET /summary/1A = %d with %d prompts, want 200 and one prompt", resp.StatusCode, len(ai.prompts))
+		}
+		return ai.prompts[0].System + ai.prompts[0].User
+	}
+
+	whole := summaryPrompt(t, 0)
+	if !strings.Contains(whole, statementEnd) || !strings.Contains(whole, "feedback 0:") {
+		t.Fatal("prompt without a budget is missing parts of the statement or feedback")
+	}
+
+	const budget = 3000
+	fitted := summaryPrompt(t, budget)
+	if tokens := prompts.EstimateTokens(fitted); tokens > budget {
+		t.Fatalf("prompt takes %d tokens, want at most %d", tokens, budget)
+	}
+	if strings.Contains(fitted, statementEnd) || strings.Contains(fitted, "feedback 0:") {
+		t.Fatal("prompt over the budget kept the end of the statement and the oldest feedback")
+	}
+	if !strings.Contains(fitted, "feedback 9:") {
+		t.Fatal("prompt over the budget dropped the latest feedback")
+	}
+}
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"coach_demon/internal/openai"
+	"coach_demon/internal/policy"
+	"coach_demon/internal/storage"
+	"encoding/json"
+	"time"
+)
+
+// Protocol versions spoken on /ws.
+//
+// Version 0 is the original protocol: the editor sends bare EditorMessage
+// frames without a handshake and only receives "feedback" frames back.
+// Version 1 wraps every frame in a typed envelope and starts with a hello.
+const (
+	ProtocolV0 = 0
+	ProtocolV1 = 1
+
+	// protocolUnknown marks a connection that has not negotiated yet.
+	protocolUnknown = -1
+)
+
+// supportedVersions lists the enveloped protocol versions, newest first.
+var supportedVersions = []int{ProtocolV1}
+
+// Message types carried in the envelope "type" field.
+const (
+	TypeHello         = "hello"
+	TypeSnapshot      = "snapshot"
+	TypeHintRequest   = "hint_request"
+	TypeEndSession    = "end_session"
+	TypeFeedback      = "feedback"
+	TypeFeedbackDelta = "feedback_delta"
+	TypeHint          = "hint"
+	TypeSession       = "session"
+	TypeError         = "error"
+	TypeAck           = "ack"
+	TypePing          = "ping"
+)
+
+// Error codes sent in "error" frames.
+const (
+	ErrCodeBadJSON            = "bad_json"
+	ErrCodeBadMessage         = "bad_message"
+	ErrCodeUnknownType        = "unknown_type"
+	ErrCodeHandshakeRequired  = "handshake_required"
+	ErrCodeUnsupportedVersion = "unsupported_version"
+	ErrCodeUnknownProblem     = "unknown_problem"
+	ErrCodeFetchFailed        = "fetch_failed"
+	ErrCodeUnknownSession     = "unknown_session"
+	ErrCodeBusy               = "busy"
+	ErrCodeInternal           = "internal"
+)
+
+// ClientMessage is the envelope of every frame sent by a v1 editor.
+type ClientMessage struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"` // echoed back as replyTo
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ServerMessage is a typed frame pushed from the server to the editor.
+type ServerMessage struct {
+	Type    string `json:"type"`
+	ReplyTo string `json:"replyTo,omitempty"`
+	Payload any    `json:"payload,omitempty"`
+}
+
+// EditorMessage is the payload of a "snapshot" frame, and the whole frame
+// for protocol v0 clients.
+//
+// Single-buffer editors send Code and optionally Language; multi-file
+// editors send Files instead, and may add the Cursor position.
+type EditorMessage struct {
+	ProblemID string       `json:"problemId"`
+	Code      string       `json:"code"`
+	Language  string       `json:"language,omitempty"`
+	Files     []EditorFile `json:"files,omitempty"`
+	Cursor    *Cursor      `json:"cursor,omitempty"`
+	Thoughts  string       `json:"thoughts"`
+	// SessionToken resumes a session after a reconnect. It is only read on
+	// the first snapshot of a problem on a connection.
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+// EditorFile is one source file of a snapshot. Language is the editor's
+// language identifier, e.g. "C++", "python" or "JAVA".
+type EditorFile struct {
+	Path     string `json:"path"`
+	Language string `json:"language,omitempty"`
+	Content  string `json:"content"`
+}
+
+// Cursor is the caret position, 1-based.
+type Cursor struct {
+	Path   string `json:"path,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// code returns the snapshot's source in the form the AI client renders.
+func (m EditorMessage) code() openai.Code {
+	var code openai.Code
+	if len(m.Files) == 0 {
+		code = openai.PlainCode(m.Code)
+		if len(code.Files) > 0 {
+			code.Files[0].Language = m.Language
+		}
+	}
+	for _, f := range m.Files {
+		code.Files = append(code.Files, openai.SourceFile{Path: f.Path, Language: f.Language, Content: f.Content})
+	}
+	if m.Cursor != nil {
+		code.Cursor = &openai.Cursor{Path: m.Cursor.Path, Line: m.Cursor.Line, Column: m.Cursor.Column}
+	}
+	return code
+}
+
+// snapshot converts the message into its stored form.
+func (m EditorMessage) snapshot() storage.Snapshot {
+	snapshot := storage.Snapshot{
+		ProblemID: m.ProblemID,
+		Code:      m.Code,
+		Language:  m.Language,
+		Thoughts:  m.Thoughts,
+	}
+	for _, f := range m.Files {
+		snapshot.Files = append(snapshot.Files, storage.SnapshotFile{Path: f.Path, Language: f.Language, Content: f.Content})
+	}
+	if m.Cursor != nil {
+		snapshot.Cursor = &storage.Cursor{Path: m.Cursor.Path, Line: m.Cursor.Line, Column: m.Cursor.Column}
+	}
+	return snapshot
+}
+
+// snapshotCode converts a stored snapshot back into AI client form.
+func snapshotCode(s storage.Snapshot) openai.Code {
+	m := EditorMessage{Code: s.Code, Language: s.Language}
+	for _, f := range s.Files {
+		m.Files = append(m.Files, EditorFile{Path: f.Path, Language: f.Language, Content: f.Content})
+	}
+	if s.Cursor != nil {
+		m.Cursor = &Cursor{Path: s.Cursor.Path, Line: s.Cursor.Line, Column: s.Cursor.Column}
+	}
+	return m.code()
+}
+
+// HelloMessage opens a v1 session. Versions lists every protocol version the
+// client understands.
+type HelloMessage struct {
+	Versions      []int  `json:"versions"`
+	Client        string `json:"client,omitempty"`
+	ClientVersion string `json:"clientVersion,omitempty"`
+	User          string `json:"user,omitempty"`
+	// Mode selects the coaching mode, i.e. the prompts used for this client.
+	Mode string `json:"mode,omitempty"`
+	// FeedbackPolicy overrides the server's feedback cadence for this client.
+	FeedbackPolicy *FeedbackPolicy `json:"feedbackPolicy,omitempty"`
+}
+
+// FeedbackPolicy is a per-client override of the feedback cadence; omitted
+// fields keep the server defaults.
+type FeedbackPolicy struct {
+	MinIntervalSeconds *float64 `json:"minIntervalSeconds,omitempty"`
+	MinChange          *float64 `json:"minChange,omitempty"`
+	OnThoughtsChange   *bool    `json:"onThoughtsChange,omitempty"`
+}
+
+func (p FeedbackPolicy) override() policy.Override {
+	o := policy.Override{
+		MinChange:        p.MinChange,
+		OnThoughtsChange: p.OnThoughtsChange,
+	}
+	if p.MinIntervalSeconds != nil {
+		d := time.Duration(*p.MinIntervalSeconds * float64(time.Second))
+		o.MinInterval = &d
+	}
+	return o
+}
+
+// HelloReply confirms the negotiated protocol version and the coaching mode
+// in effect, listing the available ones.
+type HelloReply struct {
+	Version        int                 `json:"version"`
+	Versions       []int               `json:"versions"`
+	Mode           string              `json:"mode"`
+	Modes          []string            `json:"modes"`
+	FeedbackPolicy FeedbackPolicyReply `json:"feedbackPolicy"`
+}
+
+// FeedbackPolicyReply reports the cadence in effect after overrides.
+type FeedbackPolicyReply struct {
+	MinIntervalSeconds float64 `json:"minIntervalSeconds"`
+	MinChange          float64 `json:"minChange"`
+	OnThoughtsChange   bool    `json:"onThoughtsChange"`
+}
+
+// AckMessage is the payload of an "ack" frame answering a snapshot.
+type AckMessage struct {
+	SessionID  string `json:"sessionId,omitempty"`
+	SnapshotID string `json:"snapshotId,omitempty"`
+	Seq        int64  `json:"seq,omitempty"`
+}
+
+// SessionMessage is the payload of a "session" frame, sent when a snapshot
+// starts or resumes a coding session. Token must be kept to resume it.
+type SessionMessage struct {
+	SessionID string    `json:"sessionId"`
+	Token     string    `json:"token"`
+	ProblemID string    `json:"problemId"`
+	StartedAt time.Time `json:"startedAt"`
+	Resumed   bool      `json:"resumed"`
+}
+
+// EndSessionMessage is the payload of an "end_session" frame.
+type EndSessionMessage struct {
+	SessionID string `json:"sessionId"`
+}
+
+// HintRequestMessage is the payload of a "hint_request" frame. Level is one
+// of "nudge", "observation", "outline" or "proof". Without code and thoughts
+// the latest snapshot of the problem is used.
+type HintRequestMessage struct {
+	ProblemID string       `json:"problemId"`
+	Level     string       `json:"level"`
+	Mode      string       `json:"mode,omitempty"` // coaching mode, defaults to the connection's
+	Code      string       `json:"code,omitempty"`
+	Language  string       `json:"language,omitempty"`
+	Files     []EditorFile `json:"files,omitempty"`
+	Cursor    *Cursor      `json:"cursor,omitempty"`
+	Thoughts  string       `json:"thoughts,omitempty"`
+}
+
+func (m HintRequestMessage) code() openai.Code {
+	return EditorMessage{Code: m.Code, Language: m.Language, Files: m.Files, Cursor: m.Cursor}.code()
+}
+
+// HintMessage is the payload of a "hint" frame and the REST hint resource.
+type HintMessage struct {
+	ID          string    `json:"id"`
+	SessionID   string    `json:"sessionId,omitempty"`
+	ProblemID   string    `json:"problemId"`
+	Level       string    `json:"level"`
+	Timestamp   time.Time `json:"timestamp"`
+	Hint        string    `json:"hint"`
+	Observation string    `json:"observation,omitempty"`
+	Outline     string    `json:"outline,omitempty"`
+	Proof       string    `json:"proof,omitempty"`
+	Complexity  string    `json:"complexity,omitempty"`
+}
+
+func newHintMessage(entry storage.HintEntry) HintMessage {
+	return HintMessage{
+		ID:          entry.ID,
+		SessionID:   entry.SessionID,
+		ProblemID:   entry.ProblemID,
+		Level:       entry.Level,
+		Timestamp:   entry.Timestamp,
+		Hint:        entry.Hint,
+		Observation: entry.Observation,
+		Outline:     entry.Outline,
+		Proof:       entry.Proof,
+		Complexity:  entry.Complexity,
+	}
+}
+
+// FeedbackMessage is the payload of a "feedback" frame.
+type FeedbackMessage struct {
+	ID                   string    `json:"id"`
+	SnapshotID           string    `json:"snapshotId,omitempty"`
+	ProblemID            string    `json:"problemId"`
+	Timestamp            time.Time `json:"timestamp"`
+	Feedback             string    `json:"feedback"`
+	Proof                string    `json:"proof"`
+	OptimalMetaCognition string    `json:"optimalMetaCognition"`
+}
+
+// FeedbackDeltaMessage is the payload of a "feedback_delta" frame. While the
+// AI is still answering, each delta appends Delta to Field of the feedback
+// FeedbackID; the final "feedback" frame with the same ID replaces them.
+type FeedbackDeltaMessage struct {
+	FeedbackID string `json:"feedbackId"`
+	SnapshotID string `json:"snapshotId,omitempty"`
+	ProblemID  string `json:"problemId"`
+	Field      string `json:"field"` // "feedback", "proof" or "optimalMetaCognition"
+	Delta      string `json:"delta"`
+}
+
+// ErrorMessage is the payload of an "error" frame.
+type ErrorMessage struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	ProblemID string `json:"problemId,omitempty"`
+}
+
+// deltaFields maps structured output fields to FeedbackMessage JSON names.
+var deltaFields = map[string]string{
+	openai.FieldFeedback:             "feedback",
+	openai.FieldProof:                "proof",
+	openai.FieldOptimalMetaCognition: "optimalMetaCognition",
+}
+
+// negotiateVersion picks the newest version both sides support.
+func negotiateVersion(client []int) (int, bool) {
+	for _, v := range supportedVersions {
+		for _, c := range client {
+			if c == v {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
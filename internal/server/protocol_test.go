@@ -0,0 +1,27 @@
+package server
+
+import "testing"
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		client []int
+		want   int
+		ok     bool
+	}{
+		{"v1 only", []int{ProtocolV1}, ProtocolV1, true},
+		{"older and newer", []int{ProtocolV0, ProtocolV1, 7}, ProtocolV1, true},
+		{"order does not matter", []int{7, ProtocolV1}, ProtocolV1, true},
+		{"v0 is not negotiable", []int{ProtocolV0}, 0, false},
+		{"only unknown versions", []int{7}, 0, false},
+		{"no versions", nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := negotiateVersion(tt.client)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("negotiateVersion(%v) = %d, %v; want %d, %v", tt.client, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"coach_demon/internal/retention"
+	"context"
+	"time"
+)
+
+// retentionInterval is how often the retention policy is applied.
+const retentionInterval = time.Hour
+
+// RunRetention applies ctx.Retention every retentionInterval until runCtx
+// is done, or only reports what it would delete with ctx.RetentionDryRun.
+func RunRetention(runCtx context.Context, ctx *app.App) {
+	if !ctx.Retention.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		report, err := retention.Run(runCtx, ctx.Store, ctx.Retention, time.Now().UTC(), ctx.RetentionDryRun)
+		if err != nil {
+			ctx.Logger.Warn().Err(err).Msg("applying retention policy failed")
+		} else {
+			ctx.Logger.Info().Interface("report", report).Msg("applied retention policy")
+		}
+
+		select {
+		case <-runCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
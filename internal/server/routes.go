@@ -12,12 +12,31 @@ func New(ctx *app.App) http.Handler {
 	With(r,
 		middleware.Recoverer, // optional
 		RequestID,
+		User,
 		NewLogger(ctx.Logger), // 👈 using your App logger!
 		CORS,
 	)
 
 	r.Get("/statements", getStatements(ctx))
-	r.Get("/summary/{problemId}", getSummary(ctx))
-	r.Handle("/ws", makeWSHandler(ctx))
+	r.Get("/search", getSearch(ctx))
+	r.Get("/export", getExport(ctx))
+	r.Post("/import", postImport(ctx))
+	aiLimit := newLimiter(ctx.MaxConcurrentAI)
+
+	r.Get("/summary/{problemId}", getSummary(ctx, aiLimit))
+	r.Post("/summary/{problemId}/regenerate", regenerateSummary(ctx, aiLimit))
+	r.Get("/summary/{problemId}/history", getSummaryHistory(ctx))
+	r.Get("/problems/{problemId}/sessions", getProblemSessions(ctx))
+	r.Get("/problems/{problemId}/hints", getHints(ctx))
+	r.Get("/problems/{problemId}/feedback", getProblemFeedback(ctx))
+	r.Get("/problems/{problemId}/snapshots", getProblemSnapshots(ctx))
+	r.Post("/problems/{problemId}/hints", postHint(ctx, aiLimit))
+	r.Get("/sessions/{sessionId}", getSession(ctx))
+	r.Post("/sessions/{sessionId}/end", endSession(ctx))
+	r.Get("/sessions/{sessionId}/feedback", getSessionFeedback(ctx))
+	r.Get("/sessions/{sessionId}/snapshots", getSessionSnapshots(ctx))
+	conns := newConnRegistry()
+	r.Handle("/ws", makeWSHandler(ctx, aiLimit, conns))
+	r.Get("/ws/connections", getConnections(ctx, conns))
 	return r
 }
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"cmp"
+	"coach_demon/internal/app"
+	"coach_demon/internal/search"
+	"coach_demon/internal/storage"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// snippetWidth is roughly how many characters of text a snippet shows.
+const snippetWidth = 160
+
+// searchResult is a problem with its matching records, best first.
+type searchResult struct {
+	ProblemID string        `json:"problemId"`
+	Score     float64       `json:"score"`
+	Matches   []searchMatch `json:"matches"`
+}
+
+// searchMatch is one matching record. Snippet is HTML with the matched
+// words wrapped in <mark>.
+type searchMatch struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	Field     string    `json:"field"`
+	Timestamp time.Time `json:"timestamp,omitzero"`
+	Score     float64   `json:"score"`
+	Snippet   string    `json:"snippet"`
+}
+
+// getSearch serves GET /search?q=&limit=, grouping the best matches among
+// the statements and the user's records by problem.
+func getSearch(ctx *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		query := search.Parse(q)
+		if query.Empty() {
+			http.Error(w, "q must contain a word to search for", http.StatusBadRequest)
+			return
+		}
+		limit := 0
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 || n > storage.MaxListLimit {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", storage.MaxListLimit), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		hits, err := ctx.Store.Search(r.Context(), getUserID(r.Context()), q, limit)
+		if err != nil {
+			ctx.Logger.Error().Msgf("failed to search %q: %v", q, err)
+			http.Error(w, "internal error searching", storageStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(groupHits(query, hits)); err != nil {
+			ctx.Logger.Error().Msgf("failed to encode search results: %v", err)
+			http.Error(w, "internal error encoding search results", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// groupHits groups hits by problem. A problem scores the sum of its hits.
+func groupHits(query search.Query, hits []storage.SearchHit) []searchResult {
+	results := []searchResult{}
+	index := make(map[string]int)
+	for _, hit := range hits {
+		i, ok := index[hit.ProblemID]
+		if !ok {
+			i = len(results)
+			index[hit.ProblemID] = i
+			results = append(results, searchResult{ProblemID: hit.ProblemID})
+		}
+		field, snippet := hitSnippet(query, hit)
+		results[i].Score += hit.Score
+		results[i].Matches = append(results[i].Matches, searchMatch{
+			Kind:      hit.Kind,
+			ID:        hit.ID,
+			Field:     field,
+			Timestamp: hit.Timestamp,
+			Score:     hit.Score,
+			Snippet:   snippet,
+		})
+	}
+	slices.SortStableFunc(results, func(a, b searchResult) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return results
+}
+
+// hitSnippet highlights the first field of hit that matches the query.
+// MongoDB stems words differently, so a hit it found may have no match
+// here; then the start of its first field is shown.
+func hitSnippet(query search.Query, hit storage.SearchHit) (field, snippet string) {
+	names := make([]string, 0, len(hit.Fields))
+	for name := range hit.Fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if snippet, ok := query.Highlight(hit.Fields[name], snippetWidth); ok {
+			return name, snippet
+		}
+	}
+	if len(names) == 0 {
+		return "", ""
+	}
+	text := hit.Fields[names[0]]
+	if utf8.RuneCountInString(text) > snippetWidth {
+		text = string([]rune(text)[:snippetWidth]) + "…"
+	}
+	return names[0], html.EscapeString(text)
+}
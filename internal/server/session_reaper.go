@@ -0,0 +1,40 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"context"
+	"time"
+)
+
+// reapInterval is how often idle coding sessions are looked for.
+var reapInterval = time.Minute
+
+// RunSessionReaper ends coding sessions that have been idle for longer than
+// ctx.SessionIdleTimeout, until runCtx is done. Sessions stay open across
+// reconnects so they can be resumed; this is what eventually closes them.
+func RunSessionReaper(runCtx context.Context, ctx *app.App) {
+	if ctx.SessionIdleTimeout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-runCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now().UTC()
+		n, err := ctx.Store.EndIdleSessions(runCtx, now.Add(-ctx.SessionIdleTimeout), now)
+		if err != nil {
+			ctx.Logger.Warn().Err(err).Msg("ending idle sessions failed")
+			continue
+		}
+		if n > 0 {
+			ctx.Logger.Info().Int("sessions", n).Msg("ended idle coding sessions")
+		}
+	}
+}
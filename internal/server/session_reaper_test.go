@@ -0,0 +1,69 @@
+package server
+
+import (
+	"coach_demon/internal/storage"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessionReaperEndsIdleSessions(t *testing.T) {
+	defer func(interval time.Duration) { reapInterval = interval }(reapInterval)
+	reapInterval = 10 * time.Millisecond
+
+	store := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	idle, err := store.CreateSession(context.Background(), storage.Session{ProblemID: "1A", StartedAt: now.Add(-time.Hour), LastSeenAt: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, err := store.CreateSession(context.Background(), storage.Session{ProblemID: "2B", StartedAt: now, LastSeenAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := testApp(t, store, nil)
+	a.SessionIdleTimeout = 30 * time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunSessionReaper(ctx, a)
+		close(done)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		session, err := store.GetSession(context.Background(), idle.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.EndedAt != nil {
+			if session.EndReason != storage.SessionEndIdle {
+				t.Errorf("idle session ended with reason %q, want %q", session.EndReason, storage.SessionEndIdle)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("idle session was not ended")
+		}
+		time.Sleep(reapInterval)
+	}
+	cancel()
+	<-done
+
+	if session, err := store.GetSession(context.Background(), active.ID); err != nil || session.EndedAt != nil {
+		t.Errorf("active session = %+v, %v; want it open", session, err)
+	}
+}
+
+func TestSessionReaperDisabled(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		RunSessionReaper(context.Background(), testApp(t, storage.NewMemoryStore(), nil))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reaper ran without a session idle timeout")
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"coach_demon/internal/storage"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func getProblemSessions(ctx *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		problemID := chi.URLParam(r, "problemId")
+
+		sessions, err := ctx.Store.GetSessionsByProblemID(r.Context(), getUserID(r.Context()), problemID)
+		if err != nil {
+			ctx.Logger.Error().Msgf("failed to get sessions for %s: %v", problemID, err)
+			http.Error(w, "internal error fetching sessions", storageStatus(err))
+			return
+		}
+		if sessions == nil {
+			sessions = []storage.Session{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(sessions); err != nil {
+			ctx.Logger.Error().Msgf("failed to encode sessions: %v", err)
+			http.Error(w, "internal error encoding sessions", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func getSession(ctx *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := chi.URLParam(r, "sessionId")
+
+		session, err := userSession(r, ctx.Store, sessionID)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "no session found for this ID", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			ctx.Logger.Error().Msgf("failed to get session %s: %v", sessionID, err)
+			http.Error(w, "internal error fetching session", storageStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(session); err != nil {
+			ctx.Logger.Error().Msgf("failed to encode session: %v", err)
+			http.Error(w, "internal error encoding session", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func endSession(ctx *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := chi.URLParam(r, "sessionId")
+
+		_, err := userSession(r, ctx.Store, sessionID)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "no session found for this ID", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			ctx.Logger.Error().Msgf("failed to get session %s: %v", sessionID, err)
+			http.Error(w, "internal error fetching session", storageStatus(err))
+			return
+		}
+
+		if err := ctx.Store.EndSession(r.Context(), sessionID, time.Now().UTC(), storage.SessionEndExplicit); err != nil {
+			ctx.Logger.Error().Msgf("failed to end session %s: %v", sessionID, err)
+			http.Error(w, "internal error ending session", storageStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// userSession returns the session if it belongs to the user of r, and
+// ErrNotFound otherwise, so other users' sessions cannot be told apart from
+// missing ones.
+func userSession(r *http.Request, store storage.Storage, sessionID string) (*storage.Session, error) {
+	session, err := store.GetSession(r.Context(), sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != getUserID(r.Context()) {
+		return nil, storage.ErrNotFound
+	}
+	return session, nil
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"coach_demon/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	errUnknownProblem = errors.New("unknown problem")
+	errFetchFailed    = errors.New("statement fetch failed")
+)
+
+// loadStatement returns the stored statement for problemID, fetching and
+// saving it from Codeforces on first use.
+func loadStatement(ctx context.Context, a *app.App, problemID string) (*storage.StatementEntry, error) {
+	statement, err := a.Store.GetStatement(ctx, problemID)
+	if err == nil {
+		return statement, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	a.Logger.Info().Msgf("fetching missing statement for %s", problemID)
+	codeforcesStatement, err := a.Fetch.Fetch(ctx, problemID)
+	if err != nil {
+		return nil, fmt.Errorf("%w for %s: %v", errFetchFailed, problemID, err)
+	}
+	if codeforcesStatement == "" {
+		return nil, fmt.Errorf("%w %s: fetched empty statement from codeforces", errUnknownProblem, problemID)
+	}
+	statement = &storage.StatementEntry{
+		Statement: codeforcesStatement,
+		ProblemID: problemID,
+	}
+	if err := a.Store.SaveStatement(ctx, *statement); err != nil {
+		a.Logger.Warn().Err(err).Msgf("failed to save statement for %s", problemID)
+	}
+	return statement, nil
+}
@@ -8,10 +8,10 @@ import (
 
 func getStatements(ctx *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		statements, err := ctx.Store.GetAllStatements()
+		statements, err := ctx.Store.GetAllStatements(r.Context())
 		if err != nil {
 			ctx.Logger.Error().Msgf("failed to get all statements: %v", err)
-			http.Error(w, "internal error fetching statements", http.StatusInternalServerError)
+			http.Error(w, "internal error fetching statements", storageStatus(err))
 			return
 		}
 
@@ -0,0 +1,16 @@
+package server
+
+import (
+	"coach_demon/internal/storage"
+	"errors"
+	"net/http"
+)
+
+// storageStatus is the HTTP status for a failed storage operation: a store
+// that did not answer in time is reported as a gateway timeout.
+func storageStatus(err error) int {
+	if errors.Is(err, storage.ErrTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"cmp"
+	"coach_demon/internal/app"
+	"coach_demon/internal/prompts"
+	"coach_demon/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	errNoStatement = errors.New("no statement found for this problem")
+	errNoFeedback  = errors.New("no feedbacks found for this problem")
+)
+
+// summaryResponse is a stored summary together with how much feedback has
+// arrived since it was generated.
+type summaryResponse struct {
+	storage.Summary
+	Stale        bool
+	NewFeedbacks int
+}
+
+// newSummaryResponse marks summary stale when entries holds feedback it does
+// not cover.
+func newSummaryResponse(summary storage.Summary, entries []storage.FeedbackEntry) summaryResponse {
+	resp := summaryResponse{Summary: summary}
+	for _, entry := range entries {
+		if !summary.Covers(entry) {
+			resp.NewFeedbacks++
+		}
+	}
+	resp.Stale = resp.NewFeedbacks > 0
+	return resp
+}
+
+// generateSummary asks the AI to summarize every feedback the user was given
+// for the problem so far and stores the result as their next summary version.
+// mode selects the prompts, "" the server's default.
+func generateSummary(ctx context.Context, a *app.App, aiLimit limiter, userID, problemID, mode string) (*storage.Summary, error) {
+	statement, err := a.Store.GetStatement(ctx, problemID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, errNoStatement
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get statement: %w", err)
+	}
+
+	entries, err := a.Store.GetAllFeedbacksByProblemID(ctx, userID, problemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feedbacks: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, errNoFeedback
+	}
+
+	var feedbacks, proofs, optimalMetaCognitions, feedbackIDs []string
+	for _, entry := range entries {
+		feedbackIDs = append(feedbackIDs, entry.ID)
+		if entry.Feedback != "" {
+			feedbacks = append(feedbacks, entry.Feedback)
+			proofs = append(proofs, entry.Proof)
+		}
+		if entry.OptimalMetaCognition != "" {
+			optimalMetaCognitions = append(optimalMetaCognitions, entry.OptimalMetaCognition)
+		}
+	}
+
+	hints, err := a.Store.GetHintsByProblemID(ctx, userID, problemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hints: %w", err)
+	}
+	hintsUsed := make(map[string]int)
+	for _, hint := range hints {
+		hintsUsed[hint.Level]++
+	}
+
+	data := prompts.Data{
+		Problem:               prompts.NewProblem(problemID),
+		Statement:             promptStatement(a, problemID, statement.Statement),
+		Feedbacks:             feedbacks,
+		Proofs:                proofs,
+		OptimalMetaCognitions: optimalMetaCognitions,
+		HintsUsed:             hintsUsed,
+		MaxTokens:             a.PromptTokens,
+	}
+	prompt, err := a.Prompts.Current().Summary(cmp.Or(mode, a.PromptMode), data)
+	if err != nil {
+		return nil, err
+	}
+	logPrompt(a, prompts.KindSummary, problemID, data, prompt)
+
+	if err := aiLimit.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	a.Logger.Info().Int("feedbacks", len(entries)).Msgf("asking OpenAI to summarize %s", problemID)
+	openAISummary, err := a.AI.SummarizeFeedback(ctx, prompt)
+	aiLimit.Release()
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize feedback: %w", err)
+	}
+
+	return a.Store.SaveSummary(ctx, storage.Summary{
+		UserID:               userID,
+		ProblemID:            problemID,
+		Timestamp:            time.Now().UTC(),
+		Feedback:             openAISummary.Feedback,
+		Proof:                openAISummary.Proof,
+		OptimalMetaCognition: openAISummary.OptimalMetaCognition,
+		HintsUsed:            hintsUsed,
+		FeedbackIDs:          feedbackIDs,
+	})
+}
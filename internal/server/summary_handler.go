@@ -2,91 +2,114 @@ package server
 
 import (
 	"coach_demon/internal/app"
+	"coach_demon/internal/prompts"
 	"coach_demon/internal/storage"
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/go-chi/chi/v5"
 )
 
-func getSummary(ctx *app.App) http.HandlerFunc {
+// getSummary returns the latest summary of a problem, generating the first
+// one when none exists yet. A summary that misses newer feedback is returned
+// as is and marked stale; regenerating it is up to the client.
+func getSummary(ctx *app.App, aiLimit limiter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		problemID := r.URL.Query().Get("problemId")
-		if problemID == "" {
-			http.Error(w, "missing problemId in query", http.StatusBadRequest)
-			return
-		}
+		problemID := chi.URLParam(r, "problemId")
+		userID := getUserID(r.Context())
 
-		summary, err := ctx.Store.GetSummaryByProblemID(problemID)
-		if summary != nil {
-			w.Header().Set("Content-Type", "application/json")
-			if err := json.NewEncoder(w).Encode(summary); err != nil {
-				ctx.Logger.Error().Msgf("failed to encode summary response: %v", err)
-				http.Error(w, "internal error during encoding summary", http.StatusInternalServerError)
+		summary, err := ctx.Store.GetSummaryByProblemID(r.Context(), userID, problemID)
+		if errors.Is(err, storage.ErrNotFound) {
+			summary, err = generateSummary(r.Context(), ctx, aiLimit, userID, problemID, r.URL.Query().Get("mode"))
+			if err != nil {
+				writeSummaryError(ctx, w, problemID, err)
 				return
 			}
+		} else if err != nil {
+			ctx.Logger.Error().Msgf("failed to get summary for %s: %v", problemID, err)
+			http.Error(w, "internal error fetching summary", storageStatus(err))
+			return
 		}
 
-		// 1️⃣ Fetch problem statement from database
-		statement, err := ctx.Store.GetStatement(problemID)
+		writeSummary(ctx, w, r, *summary)
+	}
+}
+
+// regenerateSummary stores a new summary version covering all feedback so far.
+func regenerateSummary(ctx *app.App, aiLimit limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		problemID := chi.URLParam(r, "problemId")
+
+		summary, err := generateSummary(r.Context(), ctx, aiLimit, getUserID(r.Context()), problemID, r.URL.Query().Get("mode"))
 		if err != nil {
-			ctx.Logger.Error().Msgf("failed to get statement for %s: %v", problemID, err)
-			http.Error(w, "internal error fetching statement", http.StatusInternalServerError)
-			return
-		}
-		if statement == nil {
-			http.Error(w, "no statement found for this problem", http.StatusNotFound)
+			writeSummaryError(ctx, w, problemID, err)
 			return
 		}
 
-		// 2️⃣ Fetch all feedback entries
-		entries, err := ctx.Store.GetAllFeedbacksByProblemID(problemID)
+		writeSummary(ctx, w, r, *summary)
+	}
+}
+
+// getSummaryHistory lists every summary version of a problem, newest first.
+func getSummaryHistory(ctx *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		problemID := chi.URLParam(r, "problemId")
+		userID := getUserID(r.Context())
+
+		summaries, err := ctx.Store.GetSummaryHistory(r.Context(), userID, problemID)
 		if err != nil {
-			ctx.Logger.Error().Msgf("failed to get all feedbacks for problem ID %s: %v", problemID, err)
-			http.Error(w, "internal error fetching feedbacks", http.StatusInternalServerError)
+			ctx.Logger.Error().Msgf("failed to get summary history for %s: %v", problemID, err)
+			http.Error(w, "internal error fetching summary history", storageStatus(err))
 			return
 		}
-		if len(entries) == 0 {
-			http.Error(w, "no feedbacks found for this problem ID", http.StatusNotFound)
+		entries, err := ctx.Store.GetAllFeedbacksByProblemID(r.Context(), userID, problemID)
+		if err != nil {
+			ctx.Logger.Error().Msgf("failed to get all feedbacks for problem ID %s: %v", problemID, err)
+			http.Error(w, "internal error fetching feedbacks", storageStatus(err))
 			return
 		}
 
-		// 3️⃣ Prepare all code + thoughts snapshots
-		var feedbacks []string
-		var proofs []string
-		var optimalMetaCognitions []string
-		for _, entry := range entries {
-			if entry.Feedback != "" {
-				feedbacks = append(feedbacks, entry.Feedback)
-			}
-			if entry.Feedback != "" {
-				proofs = append(proofs, entry.Proof)
-			}
-			if entry.OptimalMetaCognition != "" {
-				optimalMetaCognitions = append(optimalMetaCognitions, entry.OptimalMetaCognition)
-			}
+		history := make([]summaryResponse, 0, len(summaries))
+		for _, summary := range summaries {
+			history = append(history, newSummaryResponse(summary, entries))
 		}
 
-		// 4️⃣ Call OpenAI to get a nice summary
-		openAISummary, err := ctx.AI.SummarizeFeedback(statement.Statement, feedbacks, proofs, optimalMetaCognitions)
-		if err != nil {
-			ctx.Logger.Error().Msgf("failed to summarize history for %s: %v", problemID, err)
-			http.Error(w, "internal error during summarization", http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(history); err != nil {
+			ctx.Logger.Error().Msgf("failed to encode summary history: %v", err)
+			http.Error(w, "internal error encoding summary history", http.StatusInternalServerError)
 			return
 		}
+	}
+}
 
-		err = ctx.Store.SaveSummary(storage.Summary{
-			Feedback:             openAISummary.Feedback,
-			OptimalMetaCognition: openAISummary.OptimalMetaCognition,
-			Proof:                openAISummary.Proof,
-		})
-		if err != nil {
-			ctx.Logger.Error().Msgf("failed to store summary for %s: %v", problemID, err)
-		}
+func writeSummary(ctx *app.App, w http.ResponseWriter, r *http.Request, summary storage.Summary) {
+	entries, err := ctx.Store.GetAllFeedbacksByProblemID(r.Context(), summary.UserID, summary.ProblemID)
+	if err != nil {
+		ctx.Logger.Error().Msgf("failed to get all feedbacks for problem ID %s: %v", summary.ProblemID, err)
+		http.Error(w, "internal error fetching feedbacks", storageStatus(err))
+		return
+	}
 
-		// 5️⃣ Respond to client
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(summary); err != nil {
-			ctx.Logger.Error().Msgf("failed to encode summary response: %v", err)
-			http.Error(w, "internal error during encoding summary", http.StatusInternalServerError)
-		}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newSummaryResponse(summary, entries)); err != nil {
+		ctx.Logger.Error().Msgf("failed to encode summary response: %v", err)
+		http.Error(w, "internal error during encoding summary", http.StatusInternalServerError)
+	}
+}
+
+func writeSummaryError(ctx *app.App, w http.ResponseWriter, problemID string, err error) {
+	switch {
+	case errors.Is(err, errNoStatement), errors.Is(err, errNoFeedback):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, prompts.ErrUnknownMode):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrTimeout), errors.Is(err, storage.ErrBackend):
+		ctx.Logger.Error().Msgf("failed to generate summary for %s: %v", problemID, err)
+		http.Error(w, "internal error generating summary", storageStatus(err))
+	default:
+		ctx.Logger.Error().Msgf("failed to summarize history for %s: %v", problemID, err)
+		http.Error(w, "internal error during summarization", http.StatusInternalServerError)
 	}
 }
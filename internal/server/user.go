@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"unicode"
+)
+
+// UserHeader names the user a request acts for. WebSocket clients that
+// cannot set headers pass ?user= instead. Without either the request is
+// anonymous and sees only anonymous records.
+const UserHeader = "X-Coach-User"
+
+// maxUserIDLen bounds user IDs, which end up in storage keys.
+const maxUserIDLen = 128
+
+var errBadUserID = errors.New("user ID must be at most 128 printable characters")
+
+type ctxKeyUserID struct{}
+
+// User resolves the user of a request from UserHeader or the user query
+// parameter. Users are identified, not authenticated: the coach trusts its
+// network, and the ID only keeps teammates' histories apart.
+func User(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get(UserHeader)
+		if userID == "" {
+			userID = r.URL.Query().Get("user")
+		}
+		if err := checkUserID(userID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx := context.WithValue(r.Context(), ctxKeyUserID{}, userID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// getUserID returns the user resolved by User, "" when anonymous.
+func getUserID(ctx context.Context) string {
+	userID, _ := ctx.Value(ctxKeyUserID{}).(string)
+	return userID
+}
+
+func checkUserID(userID string) error {
+	if len(userID) > maxUserIDLen {
+		return errBadUserID
+	}
+	for _, r := range userID {
+		if !unicode.IsPrint(r) {
+			return errBadUserID
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is the time allowed to write one frame.
+	writeWait = 10 * time.Second
+	// pongWait is the time allowed between two frames or pongs from the peer.
+	pongWait = 60 * time.Second
+	// pingPeriod must be shorter than pongWait so a healthy peer never times out.
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize caps a single incoming frame.
+	maxMessageSize = 4 << 20
+)
+
+// wsConn wraps a WebSocket connection so that several goroutines can write
+// to it safely; gorilla/websocket supports only one concurrent writer.
+type wsConn struct {
+	*websocket.Conn
+	writeMu sync.Mutex
+}
+
+func newWSConn(conn *websocket.Conn) *wsConn {
+	conn.SetReadLimit(maxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	return &wsConn{Conn: conn}
+}
+
+// WriteJSON serializes v as a single text frame.
+func (c *wsConn) WriteJSON(v any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.Conn.WriteJSON(v)
+}
+
+// Ping sends a heartbeat; WriteControl is safe to call concurrently.
+func (c *wsConn) Ping() error {
+	return c.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+}
+
+// CloseWith sends a close frame with code and reason, then closes the socket.
+func (c *wsConn) CloseWith(code int, reason string) error {
+	_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+	return c.Close()
+}
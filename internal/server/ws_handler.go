@@ -1,105 +1,654 @@
 package server
 
 import (
+	"cmp"
 	"coach_demon/internal/app"
+	"coach_demon/internal/diff"
+	"coach_demon/internal/openai"
+	"coach_demon/internal/policy"
+	"coach_demon/internal/prompts"
 	"coach_demon/internal/storage"
+	"coach_demon/pkg/codeforces"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-type EditorMessage struct {
-	ProblemID string `json:"problemId"`
-	Code      string `json:"code"`
-	Thoughts  string `json:"thoughts"`
-}
-
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true }, // allow any frontend
 }
 
-func makeWSHandler(ctx *app.App) http.HandlerFunc {
+// wsSession holds the per-connection protocol state.
+type wsSession struct {
+	id          string
+	remoteAddr  string
+	connectedAt time.Time
+
+	app          *app.App
+	conn         *wsConn
+	version      atomic.Int32
+	lastActivity atomic.Int64 // unix nanoseconds of the last client frame
+	closedByUs   atomic.Bool
+	worker       *feedbackWorker
+	aiLimit      limiter
+	policy       atomic.Pointer[policy.Config]
+	hinting      atomic.Bool            // a hint request is being answered, see handleHintRequest
+	owner        atomic.Pointer[string] // userID, for listing connections by user
+
+	// Set by hello and read only on the read loop. userID starts as the user
+	// of the upgrade request, if any, and is changed with setUser.
+	client   storage.ClientInfo
+	userID   string
+	mode     string                      // coaching mode, "" for the server's default
+	sessions map[string]*storage.Session // open coding sessions by problem ID
+}
+
+func makeWSHandler(ctx *app.App, aiLimit limiter, reg *connRegistry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
+		rawConn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			ctx.Logger.Info().Err(err).Msg("could not upgrade WebSocket")
 			return
 		}
+		conn := newWSConn(rawConn)
 		defer conn.Close()
 
-		ctx.Logger.Info().Msg("WebSocket connection established")
+		s := &wsSession{
+			id:          getRequestID(r.Context()),
+			remoteAddr:  r.RemoteAddr,
+			connectedAt: time.Now().UTC(),
+			app:         ctx,
+			conn:        conn,
+			aiLimit:     aiLimit,
+			client:      storage.ClientInfo{RemoteAddr: r.RemoteAddr},
+			sessions:    make(map[string]*storage.Session),
+		}
+		s.setUser(getUserID(r.Context()))
+		s.version.Store(protocolUnknown)
+		s.touch()
+		s.policy.Store(&ctx.Feedback)
+		s.worker = newFeedbackWorker(s.analyze, s.obsoletes)
+
+		live := reg.add(s)
+		ctx.Logger.Info().Str("conn", s.id).Int("live", live).Msg("WebSocket connection established")
+		defer func() {
+			live := reg.remove(s)
+			ctx.Logger.Info().Str("conn", s.id).Int("live", live).Msg("WebSocket connection closed")
+		}()
+
+		sessionCtx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go s.worker.Run(sessionCtx)
+		go s.heartbeat(sessionCtx)
 
 		for {
 			_, raw, err := conn.ReadMessage()
 			if err != nil {
 				var closeErr *websocket.CloseError
-				ok := errors.As(err, &closeErr)
-				if ok {
-					ctx.Logger.Info().Int("code", closeErr.Code).Str("text", closeErr.Text).Msg("WebSocket closed normally")
-				} else {
-					ctx.Logger.Warn().Err(err).Msg("WebSocket temporary read error")
+				switch {
+				case errors.As(err, &closeErr):
+					ctx.Logger.Info().Str("conn", s.id).Int("code", closeErr.Code).Str("text", closeErr.Text).Msg("WebSocket closed by peer")
+				case s.closedByUs.Load():
+					// closed by the heartbeat, already logged
+				default:
+					ctx.Logger.Warn().Str("conn", s.id).Err(err).Msg("WebSocket read failed, closing")
 				}
-				time.Sleep(1 * time.Second) // wait a bit before next read
-				continue
+				return
 			}
 
-			var in EditorMessage
-			if err := json.Unmarshal(raw, &in); err != nil {
-				ctx.Logger.Warn().Err(err).Msg("could not parse incoming JSON")
-				continue
-			}
+			s.touch()
+			_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+			s.handleFrame(sessionCtx, raw)
+		}
+	}
+}
 
-			statement, err := ctx.Store.GetStatement(in.ProblemID)
-			if err != nil {
-				ctx.Logger.Warn().Err(err).Msg("load statement error")
-				continue
+// heartbeat pings the peer every pingPeriod and closes the connection when a
+// ping cannot be sent or the client has been idle for too long. Closing the
+// socket unblocks the read loop, which then tears the session down.
+func (s *wsSession) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		idle := time.Since(time.Unix(0, s.lastActivity.Load()))
+		if timeout := s.app.WSIdleTimeout; timeout > 0 && idle > timeout {
+			s.app.Logger.Info().Str("conn", s.id).Dur("idle", idle).Msg("closing idle WebSocket")
+			s.closedByUs.Store(true)
+			_ = s.conn.CloseWith(websocket.CloseGoingAway, "idle timeout")
+			return
+		}
+		if err := s.conn.Ping(); err != nil {
+			s.app.Logger.Info().Str("conn", s.id).Err(err).Msg("WebSocket ping failed, closing")
+			s.closedByUs.Store(true)
+			_ = s.conn.Close()
+			return
+		}
+	}
+}
+
+// touch records client activity for the idle timeout.
+func (s *wsSession) touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (s *wsSession) info() ConnectionInfo {
+	return ConnectionInfo{
+		ID:           s.id,
+		RemoteAddr:   s.remoteAddr,
+		ConnectedAt:  s.connectedAt,
+		LastActivity: time.Unix(0, s.lastActivity.Load()).UTC(),
+		Protocol:     int(s.version.Load()),
+	}
+}
+
+// setUser sets the user the connection acts for.
+func (s *wsSession) setUser(userID string) {
+	s.userID = userID
+	s.owner.Store(&userID)
+}
+
+// handleFrame decodes one incoming frame and dispatches it by type. Frames
+// without a "type" field are bare EditorMessages from protocol v0 clients.
+func (s *wsSession) handleFrame(ctx context.Context, raw []byte) {
+	var msg ClientMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		s.app.Logger.Warn().Err(err).Msg("could not parse incoming JSON")
+		s.sendError("", ErrCodeBadJSON, "frame is not valid JSON", "")
+		return
+	}
+
+	version := s.version.Load()
+	if msg.Type == "" {
+		if version != protocolUnknown && version != ProtocolV0 {
+			s.sendError(msg.ID, ErrCodeBadMessage, "missing message type", "")
+			return
+		}
+		var in EditorMessage
+		if err := json.Unmarshal(raw, &in); err != nil || in.ProblemID == "" {
+			s.app.Logger.Warn().Msg("ignoring v0 frame without problemId")
+			return
+		}
+		s.version.Store(ProtocolV0)
+		s.handleSnapshot(ctx, "", in)
+		return
+	}
+
+	if msg.Type == TypeHello {
+		s.handleHello(msg)
+		return
+	}
+	if version == protocolUnknown || version == ProtocolV0 {
+		s.sendError(msg.ID, ErrCodeHandshakeRequired, "send a hello frame before "+msg.Type, "")
+		return
+	}
+
+	switch msg.Type {
+	case TypeSnapshot:
+		var in EditorMessage
+		if err := json.Unmarshal(msg.Payload, &in); err != nil {
+			s.sendError(msg.ID, ErrCodeBadJSON, "snapshot payload is not valid JSON", "")
+			return
+		}
+		if in.ProblemID == "" {
+			s.sendError(msg.ID, ErrCodeBadMessage, "snapshot is missing problemId", "")
+			return
+		}
+		s.handleSnapshot(ctx, msg.ID, in)
+	case TypeEndSession:
+		var in EndSessionMessage
+		if err := json.Unmarshal(msg.Payload, &in); err != nil {
+			s.sendError(msg.ID, ErrCodeBadJSON, "end_session payload is not valid JSON", "")
+			return
+		}
+		s.handleEndSession(ctx, msg.ID, in)
+	case TypePing:
+		s.send(TypeAck, msg.ID, nil)
+	case TypeHintRequest:
+		var in HintRequestMessage
+		if err := json.Unmarshal(msg.Payload, &in); err != nil {
+			s.sendError(msg.ID, ErrCodeBadJSON, "hint_request payload is not valid JSON", "")
+			return
+		}
+		req := hintRequest{UserID: s.userID, ProblemID: in.ProblemID, Level: in.Level, Mode: cmp.Or(in.Mode, s.mode), Code: in.code(), Thoughts: in.Thoughts}
+		if session, ok := s.sessions[in.ProblemID]; ok {
+			req.SessionID = session.ID
+		}
+		if !s.hinting.CompareAndSwap(false, true) {
+			s.sendError(msg.ID, ErrCodeBusy, "a hint request is already in progress", in.ProblemID)
+			return
+		}
+		go s.handleHintRequest(ctx, msg.ID, req)
+	default:
+		s.sendError(msg.ID, ErrCodeUnknownType, fmt.Sprintf("unknown message type %q", msg.Type), "")
+	}
+}
+
+func (s *wsSession) handleHello(msg ClientMessage) {
+	var hello HelloMessage
+	if err := json.Unmarshal(msg.Payload, &hello); err != nil {
+		s.sendError(msg.ID, ErrCodeBadJSON, "hello payload is not valid JSON", "")
+		return
+	}
+	version, ok := negotiateVersion(hello.Versions)
+	if !ok {
+		s.sendError(msg.ID, ErrCodeUnsupportedVersion,
+			fmt.Sprintf("no common protocol version, server supports %v", supportedVersions), "")
+		return
+	}
+	// The user cannot change once known, or once records were made as
+	// anonymous.
+	if hello.User != "" && hello.User != s.userID {
+		if s.userID != "" || len(s.sessions) > 0 {
+			s.sendError(msg.ID, ErrCodeBadMessage, "hello user differs from the user of this connection", "")
+			return
+		}
+		if err := checkUserID(hello.User); err != nil {
+			s.sendError(msg.ID, ErrCodeBadMessage, err.Error(), "")
+			return
+		}
+		s.setUser(hello.User)
+	}
+	if hello.Mode != "" && !s.app.Prompts.Current().HasMode(hello.Mode) {
+		s.sendError(msg.ID, ErrCodeBadMessage,
+			fmt.Sprintf("%v %q, server has %v", prompts.ErrUnknownMode, hello.Mode, s.app.Prompts.Current().Modes()), "")
+		return
+	}
+	s.mode = hello.Mode
+	s.version.Store(int32(version))
+	s.client.Name = hello.Client
+	s.client.Version = hello.ClientVersion
+
+	cfg := s.app.Feedback
+	if hello.FeedbackPolicy != nil {
+		cfg = cfg.WithOverride(hello.FeedbackPolicy.override())
+	}
+	s.policy.Store(&cfg)
+
+	s.app.Logger.Info().Int("version", version).Str("client", hello.Client).Msg("WebSocket handshake completed")
+	s.send(TypeHello, msg.ID, HelloReply{
+		Version:  version,
+		Versions: supportedVersions,
+		Mode:     cmp.Or(s.mode, s.app.PromptMode, prompts.DefaultMode),
+		Modes:    s.app.Prompts.Current().Modes(),
+		FeedbackPolicy: FeedbackPolicyReply{
+			MinIntervalSeconds: cfg.MinInterval.Seconds(),
+			MinChange:          cfg.MinChange,
+			OnThoughtsChange:   cfg.OnThoughtsChange,
+		},
+	})
+}
+
+// handleSnapshot validates and stores a snapshot on the read loop and hands
+// it to the worker, so reading never waits on the fetcher or the AI.
+func (s *wsSession) handleSnapshot(ctx context.Context, replyTo string, in EditorMessage) {
+	if _, _, err := codeforces.ParseID(in.ProblemID); err != nil {
+		s.sendError(replyTo, ErrCodeUnknownProblem, fmt.Sprintf("%s: %v", errUnknownProblem, err), in.ProblemID)
+		return
+	}
+
+	now := time.Now().UTC()
+	job := feedbackJob{replyTo: replyTo, snapshot: in, userID: s.userID, mode: s.mode}
+	var ack AckMessage
+
+	session, err := s.sessionFor(ctx, in, now)
+	if err != nil {
+		s.app.Logger.Warn().Err(err).Str("problemId", in.ProblemID).Msg("opening session failed")
+	} else {
+		job.sessionID = session.ID
+		ack.SessionID = session.ID
+	}
+
+	entry := in.snapshot()
+	entry.UserID = s.userID
+	entry.SessionID = job.sessionID
+	entry.Timestamp = now
+	snapshot, err := s.app.Store.SaveSnapshot(ctx, entry)
+	if err != nil {
+		s.app.Logger.Warn().Err(err).Str("problemId", in.ProblemID).Msg("saving snapshot failed")
+	} else {
+		job.snapshotID = snapshot.ID
+		ack.SnapshotID = snapshot.ID
+		ack.Seq = snapshot.Seq
+	}
+
+	s.send(TypeAck, replyTo, ack)
+	s.worker.Submit(job)
+}
+
+// sessionFor returns the open session for the snapshot's problem, resuming
+// the session named by its token or starting a new one on first use.
+func (s *wsSession) sessionFor(ctx context.Context, in EditorMessage, now time.Time) (*storage.Session, error) {
+	if session, ok := s.sessions[in.ProblemID]; ok {
+		if !s.sessionExpired(session, now) {
+			if err := s.app.Store.TouchSession(ctx, session.ID, now); err != nil {
+				return nil, err
 			}
-			if statement == nil {
-				ctx.Logger.Info().Msgf("fetching missing statement for %s", in.ProblemID)
-				codeforcesStatement, err := ctx.Fetch.Fetch(r.Context(), in.ProblemID)
-				if err != nil {
-					ctx.Logger.Warn().
-						Err(err).
-						Str("problemId", in.ProblemID).
-						Msg("fetch error")
-					continue
-				}
-				if codeforcesStatement == "" {
-					ctx.Logger.Warn().
-						Str("problemId", in.ProblemID).
-						Msg("fetched empty statement from codeforces")
-					continue
-				}
-				_ = ctx.Store.SaveStatement(storage.StatementEntry{
-					Statement: codeforcesStatement,
-					ProblemID: in.ProblemID,
-				})
+			session.LastSeenAt = now
+			return session, nil
+		}
+		delete(s.sessions, in.ProblemID)
+		if err := s.app.Store.EndSession(ctx, session.ID, now, storage.SessionEndIdle); err != nil {
+			return nil, err
+		}
+	}
+
+	if in.SessionToken != "" {
+		prev, err := s.app.Store.GetSessionByToken(ctx, in.SessionToken)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+		if err == nil && prev.UserID == s.userID && prev.ProblemID == in.ProblemID && prev.EndedAt == nil && !s.sessionExpired(prev, now) {
+			if err := s.app.Store.TouchSession(ctx, prev.ID, now); err != nil {
+				return nil, err
 			}
+			prev.LastSeenAt = now
+			s.openSession(prev, true)
+			return prev, nil
+		}
+	}
 
-			latest, _ := ctx.Store.GetLatestFeedback(in.ProblemID)
-			if latest == nil || time.Since(latest.Timestamp) > time.Minute {
-				ctx.Logger.Info().Msgf("asking OpenAI for new feedback for %s", in.ProblemID)
-				fb, err := ctx.AI.GetFeedback(in.Code, in.Thoughts, statement.Statement)
-				if err != nil {
-					ctx.Logger.Warn().Err(err).Msg("OpenAI feedback error")
-					continue
-				}
-				err = ctx.Store.SaveFeedback(storage.FeedbackEntry{
-					ProblemID:            in.ProblemID,
-					Timestamp:            time.Now().UTC(),
-					Code:                 in.Code,
-					Thoughts:             in.Thoughts,
-					Feedback:             fb.Feedback,
-					Proof:                fb.Proof,
-					OptimalMetaCognition: fb.OptimalMetaCognition,
-				})
-				if err != nil {
-					ctx.Logger.Warn().Err(err).Msg("saving OpenAI feedback failed")
-				}
+	session, err := s.app.Store.CreateSession(ctx, storage.Session{
+		UserID:     s.userID,
+		ProblemID:  in.ProblemID,
+		StartedAt:  now,
+		LastSeenAt: now,
+		Client:     s.client,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.openSession(session, false)
+	return session, nil
+}
+
+func (s *wsSession) openSession(session *storage.Session, resumed bool) {
+	s.sessions[session.ProblemID] = session
+	s.app.Logger.Info().Str("conn", s.id).Str("session", session.ID).Bool("resumed", resumed).Msg("coding session opened")
+	s.send(TypeSession, "", SessionMessage{
+		SessionID: session.ID,
+		Token:     session.Token,
+		ProblemID: session.ProblemID,
+		StartedAt: session.StartedAt,
+		Resumed:   resumed,
+	})
+}
+
+func (s *wsSession) sessionExpired(session *storage.Session, now time.Time) bool {
+	timeout := s.app.SessionIdleTimeout
+	return timeout > 0 && now.Sub(session.LastSeenAt) > timeout
+}
+
+func (s *wsSession) handleEndSession(ctx context.Context, replyTo string, in EndSessionMessage) {
+	for problemID, session := range s.sessions {
+		if session.ID != in.SessionID {
+			continue
+		}
+		if err := s.app.Store.EndSession(ctx, session.ID, time.Now().UTC(), storage.SessionEndExplicit); err != nil {
+			s.app.Logger.Warn().Err(err).Str("session", session.ID).Msg("ending session failed")
+			s.sendError(replyTo, ErrCodeInternal, "could not end session", problemID)
+			return
+		}
+		delete(s.sessions, problemID)
+		s.send(TypeAck, replyTo, AckMessage{SessionID: session.ID})
+		return
+	}
+	s.sendError(replyTo, ErrCodeUnknownSession, "no open session "+in.SessionID+" on this connection", "")
+}
+
+// analyze runs on the worker goroutine. ctx is cancelled when a newer
+// snapshot of the same problem arrives or the connection closes.
+func (s *wsSession) analyze(ctx context.Context, job feedbackJob) {
+	in := job.snapshot
+	code := in.code()
+	statement, err := loadStatement(ctx, s.app, in.ProblemID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		s.app.Logger.Warn().Err(err).Str("problemId", in.ProblemID).Msg("load statement error")
+		switch {
+		case errors.Is(err, errUnknownProblem):
+			s.sendError(job.replyTo, ErrCodeUnknownProblem, err.Error(), in.ProblemID)
+		case errors.Is(err, errFetchFailed):
+			s.sendError(job.replyTo, ErrCodeFetchFailed, err.Error(), in.ProblemID)
+		default:
+			s.sendError(job.replyTo, ErrCodeInternal, "could not load problem statement", in.ProblemID)
+		}
+		return
+	}
+
+	latest, err := s.latestFeedback(ctx, job)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		s.app.Logger.Warn().Err(err).Str("problemId", in.ProblemID).Msg("loading latest feedback failed")
+	}
+	var last *policy.Snapshot
+	var lastAt time.Time
+	var previousFeedback string
+	if err == nil {
+		last = &policy.Snapshot{Code: latest.Code, Thoughts: latest.Thoughts}
+		lastAt = latest.Timestamp
+		previousFeedback = latest.Feedback
+	}
+	decision := s.policy.Load().Decide(last, lastAt, policy.Snapshot{Code: code.Text(), Thoughts: in.Thoughts}, time.Now())
+	if !decision.Analyze {
+		s.app.Logger.Debug().Str("problemId", in.ProblemID).Str("reason", decision.Reason).Msg("skipping feedback")
+		if decision.Reason == policy.ReasonTooSoon {
+			s.worker.Defer(job, decision.RetryAt)
+		}
+		return
+	}
+
+	history, codeDiff := feedbackContext(ctx, s.app, job, code.Text())
+	data := prompts.Data{
+		Problem:          prompts.NewProblem(in.ProblemID),
+		Statement:        promptStatement(s.app, in.ProblemID, statement.Statement),
+		Thoughts:         in.Thoughts,
+		PreviousFeedback: previousFeedback,
+		History:          history,
+		Diff:             codeDiff,
+		MaxTokens:        s.app.PromptTokens,
+	}
+	data.SetCode(code)
+	prompt, err := s.app.Prompts.Current().Feedback(cmp.Or(job.mode, s.app.PromptMode), data)
+	if err != nil {
+		s.app.Logger.Warn().Err(err).Str("problemId", in.ProblemID).Msg("rendering feedback prompt failed")
+		s.sendError(job.replyTo, ErrCodeInternal, "could not build the feedback prompt", in.ProblemID)
+		return
+	}
+
+	logPrompt(s.app, prompts.KindFeedback, in.ProblemID, data, prompt)
+
+	if err := s.aiLimit.Acquire(ctx); err != nil {
+		return
+	}
+	feedbackID := storage.NewID()
+	s.app.Logger.Info().Str("reason", decision.Reason).Msgf("asking OpenAI for new feedback for %s", in.ProblemID)
+	var fb openai.Feedback
+	if s.app.StreamFeedback {
+		fb, err = s.app.AI.StreamFeedback(ctx, prompt, func(d openai.FeedbackDelta) {
+			field, ok := deltaFields[d.Field]
+			if !ok || ctx.Err() != nil {
+				return
 			}
+			s.send(TypeFeedbackDelta, "", FeedbackDeltaMessage{
+				FeedbackID: feedbackID,
+				SnapshotID: job.snapshotID,
+				ProblemID:  in.ProblemID,
+				Field:      field,
+				Delta:      d.Text,
+			})
+		})
+	} else {
+		fb, err = s.app.AI.GetFeedback(ctx, prompt)
+	}
+	s.aiLimit.Release()
+	if ctx.Err() != nil {
+		s.app.Logger.Debug().Str("problemId", in.ProblemID).Msg("discarding obsolete feedback request")
+		return
+	}
+	if err != nil {
+		s.app.Logger.Warn().Err(err).Msg("OpenAI feedback error")
+		s.sendError(job.replyTo, ErrCodeInternal, "could not get feedback", in.ProblemID)
+		return
+	}
+	entry := storage.FeedbackEntry{
+		ID:                   feedbackID,
+		UserID:               job.userID,
+		SessionID:            job.sessionID,
+		SnapshotID:           job.snapshotID,
+		ProblemID:            in.ProblemID,
+		Timestamp:            time.Now().UTC(),
+		Code:                 code.Text(),
+		Thoughts:             in.Thoughts,
+		Feedback:             fb.Feedback,
+		Proof:                fb.Proof,
+		OptimalMetaCognition: fb.OptimalMetaCognition,
+	}
+	// A newer snapshot must not cancel saving feedback that is already paid for.
+	err = s.app.Store.SaveFeedback(context.WithoutCancel(ctx), entry)
+	if err != nil {
+		s.app.Logger.Warn().Err(err).Msg("saving OpenAI feedback failed")
+	}
+
+	s.sendFeedback(entry)
+}
+
+// latestFeedback returns the newest feedback given in the job's coding
+// session, or on its problem when the session could not be stored.
+func (s *wsSession) latestFeedback(ctx context.Context, job feedbackJob) (*storage.FeedbackEntry, error) {
+	page, err := s.app.Store.ListFeedback(ctx, storage.ListQuery{
+		UserID:     job.userID,
+		ProblemID:  job.snapshot.ProblemID,
+		SessionID:  job.sessionID,
+		Descending: true,
+		Limit:      1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Items) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return &page.Items[0], nil
+}
+
+// diffContext is how many unchanged lines surround each change in the code
+// diff of a feedback prompt.
+const diffContext = 3
+
+// contextShare is the share of the prompt budget, as a divisor, that the
+// feedback history and code diff may take together, so they leave room for
+// the statement and the code.
+const contextShare = 4
+
+// feedbackContext returns the latest feedback of the job's session, or of
+// the problem when the session could not be stored, oldest first, and the
+// diff of code against the code the newest of it was given for. The history
+// is sent along with every request rather than chained on the provider, so
+// it works with every backend and survives restarts.
+func feedbackContext(ctx context.Context, a *app.App, job feedbackJob, code string) ([]prompts.PastFeedback, string) {
+	if a.FeedbackHistory <= 0 {
+		return nil, ""
+	}
+	page, err := a.Store.ListFeedback(ctx, storage.ListQuery{
+		UserID:     job.userID,
+		ProblemID:  job.snapshot.ProblemID,
+		SessionID:  job.sessionID,
+		Descending: true,
+		Limit:      a.FeedbackHistory,
+	})
+	if err != nil {
+		a.Logger.Warn().Err(err).Str("problemId", job.snapshot.ProblemID).Msg("loading feedback history failed")
+		return nil, ""
+	}
+	if len(page.Items) == 0 {
+		return nil, ""
+	}
+	history := make([]prompts.PastFeedback, 0, len(page.Items))
+	for _, entry := range slices.Backward(page.Items) {
+		history = append(history, prompts.PastFeedback{Timestamp: entry.Timestamp, Feedback: entry.Feedback})
+	}
+	return prompts.FitContext(history, diff.Unified(page.Items[0].Code, code, diffContext), a.PromptTokens/contextShare)
+}
+
+// obsoletes reports whether a newer snapshot makes the analysis of the
+// current one pointless, i.e. whether it changed significantly.
+func (s *wsSession) obsoletes(newer, current feedbackJob) bool {
+	return s.policy.Load().Significant(
+		policy.Snapshot{Code: current.snapshot.code().Text(), Thoughts: current.snapshot.Thoughts},
+		policy.Snapshot{Code: newer.snapshot.code().Text(), Thoughts: newer.snapshot.Thoughts},
+	)
+}
+
+// handleHintRequest answers a hint request off the read loop. It frees the
+// connection's hint slot before replying, so the editor may ask again as
+// soon as it has the answer.
+func (s *wsSession) handleHintRequest(ctx context.Context, replyTo string, req hintRequest) {
+	entry, err := requestHint(ctx, s.app, s.aiLimit, req)
+	s.hinting.Store(false)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		s.app.Logger.Warn().Err(err).Str("problemId", req.ProblemID).Msg("hint request failed")
+		switch {
+		case errors.Is(err, errBadHintLevel), errors.Is(err, prompts.ErrUnknownMode):
+			s.sendError(replyTo, ErrCodeBadMessage, err.Error(), req.ProblemID)
+		case errors.Is(err, errUnknownProblem):
+			s.sendError(replyTo, ErrCodeUnknownProblem, err.Error(), req.ProblemID)
+		case errors.Is(err, errFetchFailed):
+			s.sendError(replyTo, ErrCodeFetchFailed, err.Error(), req.ProblemID)
+		default:
+			s.sendError(replyTo, ErrCodeInternal, "could not get hint", req.ProblemID)
 		}
+		return
+	}
+	s.send(TypeHint, replyTo, newHintMessage(*entry))
+}
+
+func (s *wsSession) sendFeedback(entry storage.FeedbackEntry) {
+	s.send(TypeFeedback, "", FeedbackMessage{
+		ID:                   entry.ID,
+		SnapshotID:           entry.SnapshotID,
+		ProblemID:            entry.ProblemID,
+		Timestamp:            entry.Timestamp,
+		Feedback:             entry.Feedback,
+		Proof:                entry.Proof,
+		OptimalMetaCognition: entry.OptimalMetaCognition,
+	})
+}
+
+// sendError reports a problem to the client. Protocol v0 clients only know
+// feedback frames, so errors are logged for them instead.
+func (s *wsSession) sendError(replyTo, code, message, problemID string) {
+	if s.version.Load() == ProtocolV0 {
+		return
+	}
+	s.send(TypeError, replyTo, ErrorMessage{Code: code, Message: message, ProblemID: problemID})
+}
+
+// send writes one frame. Acknowledgements are a v1 feature and are skipped
+// for v0 clients.
+func (s *wsSession) send(typ, replyTo string, payload any) {
+	if s.version.Load() == ProtocolV0 && typ != TypeFeedback {
+		return
+	}
+	err := s.conn.WriteJSON(ServerMessage{Type: typ, ReplyTo: replyTo, Payload: payload})
+	if err != nil {
+		s.app.Logger.Warn().Err(err).Str("type", typ).Msg("sending frame to editor failed")
 	}
 }
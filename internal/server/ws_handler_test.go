@@ -0,0 +1,447 @@
+package server
+
+import (
+	"coach_demon/internal/app"
+	"coach_demon/internal/openai"
+	"coach_demon/internal/policy"
+	"coach_demon/internal/prompts"
+	"coach_demon/internal/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+// newTestStore returns a memory store holding the given statements by
+// problem ID.
+func newTestStore(t *testing.T, statements map[string]string) *storage.MemoryStore {
+	t.Helper()
+	store := storage.NewMemoryStore()
+	for problemID, statement := range statements {
+		if err := store.SaveStatement(context.Background(), storage.StatementEntry{ProblemID: problemID, Statement: statement}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// responsesAPI answers every OpenAI Responses API call with output as the
+// model's text and records the request bodies. When release is set, each
+// call is reported on calls and held until release is closed or the request
+// is cancelled.
+type responsesAPI struct {
+	output  string
+	calls   chan string
+	release chan struct{}
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (a *responsesAPI) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.requests = append(a.requests, string(body))
+	a.mu.Unlock()
+
+	if a.release != nil {
+		a.calls <- string(body)
+		select {
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-a.release:
+		}
+	}
+
+	text, _ := json.Marshal(a.output)
+	resp := `{"id":"resp_1","object":"response","created_at":0,"model":"o3","status":"completed","output":[` +
+		`{"type":"message","id":"msg_1","status":"completed","role":"assistant","content":[` +
+		`{"type":"output_text","annotations":[],"text":` + string(text) + `}]}]}`
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(resp)),
+		Request:    r,
+	}, nil
+}
+
+// dialWS starts the server for a and opens a WebSocket connection to /ws.
+func dialWS(t *testing.T, a *app.App) *websocket.Conn {
+	t.Helper()
+	srv := httptest.NewServer(New(a))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// frame is a ServerMessage as the editor decodes it.
+type frame struct {
+	Type    string          `json:"type"`
+	ReplyTo string          `json:"replyTo"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) frame {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var f frame
+	if err := conn.ReadJSON(&f); err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	return f
+}
+
+func writeFrame(t *testing.T, conn *websocket.Conn, raw string) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(raw)); err != nil {
+		t.Fatalf("writing frame: %v", err)
+	}
+}
+
+// testAI returns an OpenAI client served by api, or by a stub answering
+// with fixed feedback when api is nil.
+func testAI(t *testing.T, api *responsesAPI) *openai.Client {
+	t.Helper()
+	ai, err := openai.NewClient(openai.Config{APIKey: "test"}, &http.Client{Transport: api})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ai
+}
+
+// readUntil skips frames until one of type typ arrives.
+func readUntil(t *testing.T, conn *websocket.Conn, typ string) frame {
+	t.Helper()
+	for {
+		if f := readFrame(t, conn); f.Type == typ {
+			return f
+		}
+	}
+}
+
+func testApp(t *testing.T, store storage.Storage, ai openai.Provider) *app.App {
+	t.Helper()
+	library, err := prompts.NewLibrary("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zerolog.Nop()
+	return &app.App{Store: store, AI: ai, Logger: &logger, Prompts: library, Feedback: policy.Default}
+}
+
+// recordingAI is the Fake provider recording the feedback prompts it gets.
+type recordingAI struct {
+	openai.Fake
+
+	mu      sync.Mutex
+	prompts []openai.Prompt
+}
+
+func (r *recordingAI) GetFeedback(ctx context.Context, prompt openai.Prompt) (openai.Feedback, error) {
+	r.mu.Lock()
+	r.prompts = append(r.prompts, prompt)
+	r.mu.Unlock()
+	return r.Fake.GetFeedback(ctx, prompt)
+}
+
+func TestHelloReply(t *testing.T) {
+	conn := dialWS(t, testApp(t, storage.NewMemoryStore(), nil))
+
+	writeFrame(t, conn, `{"type":"hello","id":"h1","payload":{"versions":[0,1,7],"client":"test"}}`)
+	f := readFrame(t, conn)
+	var reply HelloReply
+	if err := json.Unmarshal(f.Payload, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != TypeHello || f.ReplyTo != "h1" || reply.Version != ProtocolV1 || !slices.Equal(reply.Versions, supportedVersions) {
+		t.Fatalf("hello reply = %s (replyTo %q) %+v, want version %d of %v", f.Type, f.ReplyTo, reply, ProtocolV1, supportedVersions)
+	}
+
+	writeFrame(t, conn, `{"type":"ping","id":"p1"}`)
+	if f := readFrame(t, conn); f.Type != TypeAck || f.ReplyTo != "p1" {
+		t.Fatalf("ping reply = %s (replyTo %q), want ack to p1", f.Type, f.ReplyTo)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	const hello = `{"type":"hello","payload":{"versions":[1]}}`
+	tests := []struct {
+		name    string
+		frames  []string // the last frame is answered with the error
+		code    string
+		replyTo string
+	}{
+		{
+			name:    "snapshot before hello",
+			frames:  []string{`{"type":"snapshot","id":"s1","payload":{"problemId":"1A"}}`},
+			code:    ErrCodeHandshakeRequired,
+			replyTo: "s1",
+		},
+		{
+			name:    "no common version",
+			frames:  []string{`{"type":"hello","id":"h1","payload":{"versions":[0,7]}}`},
+			code:    ErrCodeUnsupportedVersion,
+			replyTo: "h1",
+		},
+		{
+			name:   "not JSON",
+			frames: []string{`{"type":`},
+			code:   ErrCodeBadJSON,
+		},
+		{
+			name:    "bad snapshot payload",
+			frames:  []string{hello, `{"type":"snapshot","id":"s1","payload":"1A"}`},
+			code:    ErrCodeBadJSON,
+			replyTo: "s1",
+		},
+		{
+			name:    "unknown type",
+			frames:  []string{hello, `{"type":"bogus","id":"b1"}`},
+			code:    ErrCodeUnknownType,
+			replyTo: "b1",
+		},
+		{
+			name:   "bare frame after hello",
+			frames: []string{hello, `{"problemId":"1A"}`},
+			code:   ErrCodeBadMessage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialWS(t, testApp(t, storage.NewMemoryStore(), nil))
+			for i, raw := range tt.frames {
+				writeFrame(t, conn, raw)
+				if i < len(tt.frames)-1 {
+					readFrame(t, conn)
+				}
+			}
+
+			f := readFrame(t, conn)
+			var msg ErrorMessage
+			if err := json.Unmarshal(f.Payload, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if f.Type != TypeError || msg.Code != tt.code || f.ReplyTo != tt.replyTo {
+				t.Fatalf("got %s %q (replyTo %q), want error %q (replyTo %q)", f.Type, msg.Code, f.ReplyTo, tt.code, tt.replyTo)
+			}
+		})
+	}
+}
+
+// TestSnapshotGetsFeedbackFrame drives a protocol v0 editor: a bare
+// EditorMessage without a handshake is answered with only a feedback frame.
+func TestSnapshotGetsFeedbackFrame(t *testing.T) {
+	store := newTestStore(t, map[string]string{"1A": "Theatre Square"})
+	ai := &recordingAI{}
+	conn := dialWS(t, testApp(t, store, ai))
+
+	if err := conn.WriteJSON(EditorMessage{ProblemID: "1A", Code: "print(1)", Thoughts: "ceil"}); err != nil {
+		t.Fatal(err)
+	}
+	f := readFrame(t, conn)
+	var got FeedbackMessage
+	if err := json.Unmarshal(f.Payload, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := store.GetSnapshotsByProblemID(context.Background(), "", "1A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	feedbacks, err := store.GetAllFeedbacksByProblemID(context.Background(), "", "1A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || len(feedbacks) != 1 {
+		t.Fatalf("stored %d snapshots and %d feedbacks, want one each", len(snapshots), len(feedbacks))
+	}
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+	if len(ai.prompts) != 1 || !strings.Contains(ai.prompts[0].User, "Theatre Square") || !strings.Contains(ai.prompts[0].User, "print(1)") {
+		t.Fatalf("feedback prompts = %q, want one with the statement and the code", ai.prompts)
+	}
+	fb, err := ai.Fake.GetFeedback(context.Background(), ai.prompts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FeedbackMessage{
+		ID:                   feedbacks[0].ID,
+		SnapshotID:           snapshots[0].ID,
+		ProblemID:            "1A",
+		Feedback:             fb.Feedback,
+		Proof:                fb.Proof,
+		OptimalMetaCognition: fb.OptimalMetaCognition,
+	}
+	got.Timestamp = time.Time{}
+	if f.Type != TypeFeedback || got != want {
+		t.Fatalf("frame = %s %+v, want feedback %+v", f.Type, got, want)
+	}
+}
+
+func TestSnapshotAckCarriesSeq(t *testing.T) {
+	store := newTestStore(t, map[string]string{"1A": "Theatre Square", "2B": "The least round way"})
+	conn := dialWS(t, testApp(t, store, openai.Fake{}))
+	writeFrame(t, conn, `{"type":"hello","payload":{"versions":[1]}}`)
+	readFrame(t, conn)
+
+	tests := []struct {
+		problemID string
+		seq       int64
+	}{
+		{"1A", 1},
+		{"1A", 2},
+		{"2B", 1},
+		{"1A", 3},
+	}
+	for i, tt := range tests {
+		id := fmt.Sprint(i)
+		writeFrame(t, conn, fmt.Sprintf(`{"type":"snapshot","id":%q,"payload":{"problemId":%q,"code":"v%d"}}`, id, tt.problemID, i))
+		f := readUntil(t, conn, TypeAck)
+		var ack AckMessage
+		if err := json.Unmarshal(f.Payload, &ack); err != nil {
+			t.Fatal(err)
+		}
+		if f.ReplyTo != id || ack.Seq != tt.seq || ack.SnapshotID == "" {
+			t.Errorf("snapshot %d of %s: ack %+v (replyTo %q), want seq %d", i, tt.problemID, ack, f.ReplyTo, tt.seq)
+		}
+
+		saved, err := store.GetSnapshot(context.Background(), ack.SnapshotID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved == nil || saved.Seq != tt.seq || saved.Code != fmt.Sprintf("v%d", i) {
+			t.Errorf("snapshot %d: stored %+v, want seq %d", i, saved, tt.seq)
+		}
+	}
+}
+
+func TestSessionResume(t *testing.T) {
+	store := newTestStore(t, map[string]string{"1A": "Theatre Square", "2B": "The least round way"})
+	a := testApp(t, store, openai.Fake{})
+
+	// openSession sends one snapshot as user on a new connection and returns
+	// the session frame it starts or resumes.
+	openSession := func(user, problemID, token string) SessionMessage {
+		t.Helper()
+		conn := dialWS(t, a)
+		writeFrame(t, conn, fmt.Sprintf(`{"type":"hello","payload":{"versions":[1],"user":%q}}`, user))
+		readFrame(t, conn)
+		writeFrame(t, conn, fmt.Sprintf(`{"type":"snapshot","id":"s","payload":{"problemId":%q,"code":"x","sessionToken":%q}}`, problemID, token))
+		var session SessionMessage
+		if err := json.Unmarshal(readUntil(t, conn, TypeSession).Payload, &session); err != nil {
+			t.Fatal(err)
+		}
+		var ack AckMessage
+		if err := json.Unmarshal(readUntil(t, conn, TypeAck).Payload, &ack); err != nil {
+			t.Fatal(err)
+		}
+		if ack.SessionID != session.SessionID {
+			t.Errorf("ack session %q, want %q", ack.SessionID, session.SessionID)
+		}
+		return session
+	}
+
+	first := openSession("ana", "1A", "")
+	if first.Resumed || first.Token == "" || first.ProblemID != "1A" {
+		t.Fatalf("first session frame = %+v, want a new 1A session with a token", first)
+	}
+
+	tests := []struct {
+		name      string
+		user      string
+		problemID string
+		token     string
+		resumed   bool
+	}{
+		{"same user and problem", "ana", "1A", first.Token, true},
+		{"another user", "bob", "1A", first.Token, false},
+		{"another problem", "ana", "2B", first.Token, false},
+		{"unknown token", "ana", "1A", "no-such-token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := openSession(tt.user, tt.problemID, tt.token)
+			if got.Resumed != tt.resumed || (got.SessionID == first.SessionID) != tt.resumed {
+				t.Errorf("session frame = %+v, want resumed %v of %s", got, tt.resumed, first.SessionID)
+			}
+			if got.Resumed && got.Token != first.Token {
+				t.Errorf("resumed session token %q, want %q", got.Token, first.Token)
+			}
+		})
+	}
+
+	ended := openSession("ana", "1A", "")
+	if err := store.EndSession(context.Background(), ended.SessionID, time.Now().UTC(), storage.SessionEndExplicit); err != nil {
+		t.Fatal(err)
+	}
+	if got := openSession("ana", "1A", ended.Token); got.Resumed {
+		t.Errorf("ended session was resumed: %+v", got)
+	}
+}
+
+func TestTooSoonSnapshotIsDeferred(t *testing.T) {
+	store := newTestStore(t, map[string]string{"1A": "Theatre Square"})
+	a := testApp(t, store, openai.Fake{})
+	a.Feedback = policy.Config{MinInterval: 200 * time.Millisecond, MinChange: 0.05, OnThoughtsChange: true}
+	conn := dialWS(t, a)
+	writeFrame(t, conn, `{"type":"hello","payload":{"versions":[1]}}`)
+	readFrame(t, conn)
+
+	writeFrame(t, conn, `{"type":"snapshot","id":"1","payload":{"problemId":"1A","code":"x := 1"}}`)
+	readUntil(t, conn, TypeFeedback)
+	writeFrame(t, conn, `{"type":"snapshot","id":"2","payload":{"problemId":"1A","code":"y := 2"}}`)
+	readUntil(t, conn, TypeFeedback)
+
+	feedbacks, err := store.GetAllFeedbacksByProblemID(context.Background(), "", "1A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feedbacks) != 2 || feedbacks[1].Code != "y := 2" {
+		t.Fatalf("stored feedback %+v, want a second one on the deferred snapshot", feedbacks)
+	}
+	if gap := feedbacks[1].Timestamp.Sub(feedbacks[0].Timestamp); gap < a.Feedback.MinInterval {
+		t.Errorf("second feedback %v after the first, want at least %v", gap, a.Feedback.MinInterval)
+	}
+}
+
+func TestFeedbackComparedWithinSession(t *testing.T) {
+	store := newTestStore(t, map[string]string{"1A": "Theatre Square"})
+	a := testApp(t, store, openai.Fake{})
+
+	sessions := make(map[string]bool)
+	for range 2 {
+		// Each connection starts its own session on the same code, which is
+		// new to that session.
+		conn := dialWS(t, a)
+		writeFrame(t, conn, `{"type":"hello","payload":{"versions":[1],"user":"ana"}}`)
+		readFrame(t, conn)
+		writeFrame(t, conn, `{"type":"snapshot","payload":{"problemId":"1A","code":"x := 1"}}`)
+		var session SessionMessage
+		if err := json.Unmarshal(readUntil(t, conn, TypeSession).Payload, &session); err != nil {
+			t.Fatal(err)
+		}
+		sessions[session.SessionID] = true
+		readUntil(t, conn, TypeFeedback)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("got sessions %v, want two", sessions)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ConnectionInfo describes one live WebSocket connection.
+type ConnectionInfo struct {
+	ID           string    `json:"id"`
+	RemoteAddr   string    `json:"remoteAddr"`
+	ConnectedAt  time.Time `json:"connectedAt"`
+	LastActivity time.Time `json:"lastActivity"`
+	Protocol     int       `json:"protocol"`
+}
+
+// connRegistry tracks the live WebSocket sessions of the whole server. It is
+// keyed by session rather than by its ID, which comes from the client's
+// X-Request-ID and may repeat.
+type connRegistry struct {
+	mu    sync.Mutex
+	conns map[*wsSession]struct{}
+}
+
+func newConnRegistry() *connRegistry {
+	return &connRegistry{conns: make(map[*wsSession]struct{})}
+}
+
+func (r *connRegistry) add(s *wsSession) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conns[s] = struct{}{}
+	return len(r.conns)
+}
+
+func (r *connRegistry) remove(s *wsSession) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, s)
+	return len(r.conns)
+}
+
+// Count returns the number of live connections.
+func (r *connRegistry) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+// List returns the live connections of a user, oldest first. Connections
+// that have not named a user belong to the anonymous user "".
+func (r *connRegistry) List(userID string) []ConnectionInfo {
+	r.mu.Lock()
+	infos := make([]ConnectionInfo, 0, len(r.conns))
+	for s := range r.conns {
+		if owner := s.owner.Load(); owner != nil && *owner == userID {
+			infos = append(infos, s.info())
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+	return infos
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"coach_demon/internal/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnRegistryAllowsRepeatedIDs(t *testing.T) {
+	reg := newConnRegistry()
+	// Both connections sent the same X-Request-ID.
+	a, b := &wsSession{id: "same"}, &wsSession{id: "same"}
+	a.setUser("")
+	b.setUser("")
+	if live := reg.add(a); live != 1 {
+		t.Errorf("add = %d, want 1", live)
+	}
+	if live := reg.add(b); live != 2 {
+		t.Errorf("add of a second connection with the same ID = %d, want 2", live)
+	}
+	if live := reg.remove(a); live != 1 {
+		t.Errorf("remove = %d, want 1", live)
+	}
+	if got := reg.List(""); len(got) != 1 {
+		t.Errorf("List = %v, want the remaining connection", got)
+	}
+}
+
+func TestConnectionsListedByUser(t *testing.T) {
+	srv := httptest.NewServer(New(testApp(t, storage.NewMemoryStore(), nil)))
+	t.Cleanup(srv.Close)
+
+	// The first editor names its user in the upgrade request, the second in
+	// its hello, and the third stays anonymous. The hello reply comes after the
+	// connection is registered.
+	for _, c := range []struct{ query, hello string }{
+		{"?user=alice", `{"type":"hello","payload":{"versions":[1]}}`},
+		{"", `{"type":"hello","payload":{"versions":[1],"user":"bob"}}`},
+		{"", `{"type":"hello","payload":{"versions":[1]}}`},
+	} {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws"+c.query, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		writeFrame(t, conn, c.hello)
+		if f := readFrame(t, conn); f.Type != TypeHello {
+			t.Fatalf("hello reply = %s, want %s", f.Type, TypeHello)
+		}
+	}
+
+	for _, userID := range []string{"alice", "bob", "", "carol"} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/ws/connections", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if userID != "" {
+			req.Header.Set(UserHeader, userID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got connectionsResponse
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 1
+		if userID == "carol" {
+			want = 0
+		}
+		if got.Count != want || len(got.Connections) != want {
+			t.Errorf("connections of %q = %+v, want %d", userID, got, want)
+		}
+	}
+}
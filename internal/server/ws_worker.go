@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// feedbackJob is a snapshot waiting to be analyzed.
+type feedbackJob struct {
+	replyTo    string
+	snapshot   EditorMessage
+	userID     string
+	mode       string // coaching mode, "" for the server's default
+	sessionID  string // coding session, "" if it could not be stored
+	snapshotID string // stored snapshot, "" if saving it failed
+}
+
+// feedbackWorker analyzes snapshots of one connection off the read loop.
+// Only the newest snapshot per problem is kept, and a snapshot arriving for
+// the problem currently being analyzed cancels that analysis if it makes it
+// obsolete.
+type feedbackWorker struct {
+	analyze   func(ctx context.Context, job feedbackJob)
+	obsoletes func(newer, current feedbackJob) bool
+
+	mu       sync.Mutex
+	pending  map[string]feedbackJob // newest unprocessed snapshot per problem
+	order    []string               // problems in pending, oldest first
+	inflight string                 // problem being analyzed, "" when idle
+	current  feedbackJob            // job being analyzed
+	cancel   context.CancelFunc     // cancels the in-flight analysis
+	deferred map[string]*time.Timer // resubmits a snapshot that came too soon
+	stopped  bool
+	wake     chan struct{}
+}
+
+func newFeedbackWorker(
+	analyze func(ctx context.Context, job feedbackJob),
+	obsoletes func(newer, current feedbackJob) bool,
+) *feedbackWorker {
+	return &feedbackWorker{
+		analyze:   analyze,
+		obsoletes: obsoletes,
+		pending:   make(map[string]feedbackJob),
+		deferred:  make(map[string]*time.Timer),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Submit queues job, replacing any older snapshot of the same problem.
+func (w *feedbackWorker) Submit(job feedbackJob) {
+	problemID := job.snapshot.ProblemID
+
+	w.mu.Lock()
+	if t, ok := w.deferred[problemID]; ok {
+		t.Stop()
+		delete(w.deferred, problemID)
+	}
+	if _, ok := w.pending[problemID]; !ok {
+		w.order = append(w.order, problemID)
+	}
+	w.pending[problemID] = job
+	if w.inflight == problemID && w.cancel != nil && w.obsoletes(job, w.current) {
+		w.cancel()
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Defer submits job at the given time, unless a newer snapshot of the same
+// problem is submitted first.
+func (w *feedbackWorker) Defer(job feedbackJob, at time.Time) {
+	problemID := job.snapshot.ProblemID
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	if t, ok := w.deferred[problemID]; ok {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(time.Until(at), func() {
+		w.mu.Lock()
+		current := w.deferred[problemID] == t
+		w.mu.Unlock()
+		if current {
+			w.Submit(job)
+		}
+	})
+	w.deferred[problemID] = t
+}
+
+// Run processes jobs until ctx is done.
+func (w *feedbackWorker) Run(ctx context.Context) {
+	defer w.stop()
+	for {
+		job, jobCtx, ok := w.take(ctx)
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.wake:
+				continue
+			}
+		}
+		w.analyze(jobCtx, job)
+		w.finish()
+	}
+}
+
+func (w *feedbackWorker) take(ctx context.Context) (feedbackJob, context.Context, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.order) == 0 || ctx.Err() != nil {
+		return feedbackJob{}, nil, false
+	}
+	problemID := w.order[0]
+	w.order = w.order[1:]
+	job := w.pending[problemID]
+	delete(w.pending, problemID)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	w.inflight = problemID
+	w.current = job
+	w.cancel = cancel
+	return job, jobCtx, true
+}
+
+func (w *feedbackWorker) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.inflight = ""
+	w.current = feedbackJob{}
+	w.cancel = nil
+}
+
+func (w *feedbackWorker) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopped = true
+	for problemID, t := range w.deferred {
+		t.Stop()
+		delete(w.deferred, problemID)
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func snapshotJob(problemID, code string) feedbackJob {
+	return feedbackJob{snapshot: EditorMessage{ProblemID: problemID, Code: code}}
+}
+
+func TestFeedbackWorkerKeepsNewestSnapshot(t *testing.T) {
+	analyzed := make(chan feedbackJob, 10)
+	w := newFeedbackWorker(
+		func(ctx context.Context, job feedbackJob) { analyzed <- job },
+		func(newer, current feedbackJob) bool { return true },
+	)
+	for i := 1; i <= 5; i++ {
+		w.Submit(snapshotJob("1A", fmt.Sprintf("v%d", i)))
+	}
+	w.Submit(snapshotJob("2B", "other"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	for _, want := range []string{"1A v5", "2B other"} {
+		select {
+		case job := <-analyzed:
+			if got := job.snapshot.ProblemID + " " + job.snapshot.Code; got != want {
+				t.Errorf("analyzed %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no analysis of %s", want)
+		}
+	}
+	select {
+	case job := <-analyzed:
+		t.Errorf("burst analyzed again: %s %s", job.snapshot.ProblemID, job.snapshot.Code)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFeedbackWorkerCancelsObsoleteAnalysis(t *testing.T) {
+	started := make(chan feedbackJob, 10)
+	results := make(chan string, 10)
+	w := newFeedbackWorker(
+		func(ctx context.Context, job feedbackJob) {
+			started <- job
+			if job.snapshot.Code == "v1" || job.snapshot.Code == "v2" {
+				<-ctx.Done()
+			}
+			results <- fmt.Sprintf("%s: %v", job.snapshot.Code, ctx.Err())
+		},
+		func(newer, current feedbackJob) bool { return newer.snapshot.Code != "v1 reindented" },
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	wait := func(ch <-chan string, want string) {
+		t.Helper()
+		select {
+		case got := <-ch:
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	waitStarted := func(want string) {
+		t.Helper()
+		select {
+		case job := <-started:
+			if job.snapshot.Code != want {
+				t.Errorf("started %q, want %q", job.snapshot.Code, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("analysis of %q did not start", want)
+		}
+	}
+
+	w.Submit(snapshotJob("1A", "v1"))
+	waitStarted("v1")
+	// A snapshot that does not obsolete the analysis waits for it.
+	w.Submit(snapshotJob("1A", "v1 reindented"))
+	select {
+	case got := <-results:
+		t.Fatalf("insignificant snapshot ended the analysis: %s", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// A significant one cancels it and replaces the queued snapshot.
+	w.Submit(snapshotJob("1A", "v2"))
+	wait(results, "v1: context canceled")
+	waitStarted("v2")
+	w.Submit(snapshotJob("1A", "v3"))
+	wait(results, "v2: context canceled")
+	waitStarted("v3")
+	wait(results, "v3: <nil>")
+}
+
+func TestFeedbackWorkerDefer(t *testing.T) {
+	analyzed := make(chan string, 10)
+	w := newFeedbackWorker(
+		func(ctx context.Context, job feedbackJob) { analyzed <- job.snapshot.Code },
+		func(newer, current feedbackJob) bool { return true },
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	start := time.Now()
+	w.Defer(snapshotJob("1A", "v1"), start.Add(30*time.Millisecond))
+	select {
+	case got := <-analyzed:
+		if got != "v1" || time.Since(start) < 30*time.Millisecond {
+			t.Errorf("analyzed %q after %v, want v1 after 30ms", got, time.Since(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("deferred snapshot was not analyzed")
+	}
+
+	// A newer snapshot replaces the deferred one.
+	w.Defer(snapshotJob("1A", "v2"), time.Now().Add(30*time.Millisecond))
+	w.Submit(snapshotJob("1A", "v3"))
+	select {
+	case got := <-analyzed:
+		if got != "v3" {
+			t.Errorf("analyzed %q, want v3", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("submitted snapshot was not analyzed")
+	}
+	select {
+	case got := <-analyzed:
+		t.Errorf("replaced deferred snapshot analyzed: %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSnapshotBurstGetsOneFeedback(t *testing.T) {
+	api := &responsesAPI{
+		output:  `{"feedback":"Use ceil division.","proof":"","optima_meta_cognition":""}`,
+		calls:   make(chan string, 100),
+		release: make(chan struct{}),
+	}
+	store := newTestStore(t, map[string]string{"1A": "Theatre Square"})
+	a := testApp(t, store, testAI(t, api))
+	a.Feedback.MinInterval = 0
+	a.MaxConcurrentAI = 1
+	conn := dialWS(t, a)
+
+	frames := make(chan frame, 100)
+	go func() {
+		for {
+			var f frame
+			if err := conn.ReadJSON(&f); err != nil {
+				close(frames)
+				return
+			}
+			frames <- f
+		}
+	}()
+	next := func(typ string) frame {
+		t.Helper()
+		for {
+			select {
+			case f, ok := <-frames:
+				if !ok {
+					t.Fatalf("connection closed waiting for %s", typ)
+				}
+				if f.Type == typ {
+					return f
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("no %s frame", typ)
+			}
+		}
+	}
+	send := func(typ, id string, payload any) {
+		t.Helper()
+		raw, _ := json.Marshal(payload)
+		if err := conn.WriteJSON(ClientMessage{Type: typ, ID: id, Payload: raw}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send(TypeHello, "hello", HelloMessage{Versions: []int{ProtocolV1}})
+	next(TypeHello)
+	const snapshots = 5
+	code := func(i int) string {
+		return fmt.Sprintf("long long answer%d = solve%d();\nprint(answer%d);\n", i, i, i)
+	}
+	for i := 1; i <= snapshots; i++ {
+		send(TypeSnapshot, fmt.Sprint(i), EditorMessage{ProblemID: "1A", Code: code(i), Thoughts: "ceil"})
+		next(TypeAck)
+	}
+	// Release the AI once the newest snapshot reached it; every older
+	// analysis has been cancelled by then.
+	for request := range api.calls {
+		if strings.Contains(request, fmt.Sprintf("solve%d()", snapshots)) {
+			break
+		}
+	}
+	close(api.release)
+
+	next(TypeFeedback)
+	select {
+	case f := <-frames:
+		if f.Type == TypeFeedback {
+			t.Errorf("second feedback frame: %+v", f)
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+	entries, err := store.GetAllFeedbacksByProblemID(context.Background(), "", "1A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Code != code(snapshots) {
+		t.Fatalf("stored feedback %+v, want one on the newest snapshot", entries)
+	}
+}
@@ -0,0 +1,731 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Bucket names of the embedded store. Records are stored BSON-encoded, the
+// same documents MongoManager writes, keyed by ID or by problem ID.
+var (
+	bucketSessions      = []byte("sessions")
+	bucketSessionTokens = []byte("sessionTokens") // token → session ID
+	bucketSnapshots     = []byte("snapshots")
+	bucketSnapshotSeqs  = []byte("snapshotSeqs") // userID 0x00 problemID 0x00 seq → snapshot ID
+	bucketFeedbacks     = []byte("feedbacks")
+	bucketHints         = []byte("hints")
+	bucketStatements    = []byte("statements") // problemID → statement
+	bucketSummaries     = []byte("summaries")  // userID 0x00 problemID 0x00 version → summary
+	bucketSummaryIDs    = []byte("summaryIDs") // summary ID → summaries key
+)
+
+// BoltStore is a Storage kept in a single bbolt file, for single-user
+// installs that do not want to run MongoDB. Only one process may open the
+// file at a time.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			bucketSessions, bucketSessionTokens, bucketSnapshots, bucketSnapshotSeqs,
+			bucketFeedbacks, bucketHints, bucketStatements, bucketSummaries, bucketSummaryIDs,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Close releases the file lock.
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+func (b *BoltStore) CreateSession(ctx context.Context, entry Session) (*Session, error) {
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	if entry.Token == "" {
+		entry.Token = NewID()
+	}
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		tokens := tx.Bucket(bucketSessionTokens)
+		if tokens.Get([]byte(entry.Token)) != nil {
+			return ErrDuplicate
+		}
+		if err := insert(tx.Bucket(bucketSessions), []byte(entry.ID), entry); err != nil {
+			return err
+		}
+		return tokens.Put([]byte(entry.Token), []byte(entry.ID))
+	})
+	if err != nil {
+		return nil, opError("failed to insert session", err)
+	}
+	return &entry, nil
+}
+
+func (b *BoltStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	var entry *Session
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		entry, err = get[Session](tx.Bucket(bucketSessions), []byte(id))
+		return err
+	})
+	if err != nil {
+		return nil, opError("failed to find session", err)
+	}
+	if entry == nil {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+func (b *BoltStore) GetSessionByToken(ctx context.Context, token string) (*Session, error) {
+	var entry *Session
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		id := tx.Bucket(bucketSessionTokens).Get([]byte(token))
+		if id == nil {
+			return nil
+		}
+		var err error
+		entry, err = get[Session](tx.Bucket(bucketSessions), id)
+		return err
+	})
+	if err != nil {
+		return nil, opError("failed to find session", err)
+	}
+	if entry == nil {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+func (b *BoltStore) GetSessionsByProblemID(ctx context.Context, userID, problemID string) ([]Session, error) {
+	var entries []Session
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return scan(tx.Bucket(bucketSessions), func(s Session) {
+			if s.UserID == userID && s.ProblemID == problemID {
+				entries = append(entries, s)
+			}
+		})
+	})
+	if err != nil {
+		return nil, opError("failed to query sessions", err)
+	}
+	slices.SortStableFunc(entries, func(a, b Session) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	return entries, nil
+}
+
+func (b *BoltStore) TouchSession(ctx context.Context, id string, at time.Time) error {
+	err := b.updateSession(ctx, id, func(s *Session) bool {
+		s.LastSeenAt = at
+		return true
+	})
+	if err != nil {
+		return opError("failed to touch session", err)
+	}
+	return nil
+}
+
+func (b *BoltStore) EndSession(ctx context.Context, id string, at time.Time, reason string) error {
+	err := b.updateSession(ctx, id, func(s *Session) bool {
+		if s.EndedAt != nil {
+			return false
+		}
+		s.EndedAt = &at
+		s.EndReason = reason
+		return true
+	})
+	if err != nil {
+		return opError("failed to end session", err)
+	}
+	return nil
+}
+
+// updateSession applies fn to the session id, if it exists, and writes it
+// back when fn reports a change.
+func (b *BoltStore) updateSession(ctx context.Context, id string, fn func(*Session) bool) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketSessions)
+		entry, err := get[Session](bucket, []byte(id))
+		if err != nil || entry == nil || !fn(entry) {
+			return err
+		}
+		return put(bucket, []byte(id), entry)
+	})
+}
+
+func (b *BoltStore) EndIdleSessions(ctx context.Context, idleSince, at time.Time) (int, error) {
+	n := 0
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketSessions)
+		var idle []Session
+		err := scan(bucket, func(s Session) {
+			if s.EndedAt == nil && s.LastSeenAt.Before(idleSince) {
+				idle = append(idle, s)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		for _, s := range idle {
+			s.EndedAt = &at
+			s.EndReason = SessionEndIdle
+			if err := put(bucket, []byte(s.ID), s); err != nil {
+				return err
+			}
+		}
+		n = len(idle)
+		return nil
+	})
+	if err != nil {
+		return 0, opError("failed to end idle sessions", err)
+	}
+	return n, nil
+}
+
+func (b *BoltStore) SaveSnapshot(ctx context.Context, entry Snapshot) (*Snapshot, error) {
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	// bbolt serializes writers, so reading the latest seq and inserting the
+	// next one cannot race.
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		seqs := tx.Bucket(bucketSnapshotSeqs)
+		if entry.Seq == 0 {
+			entry.Seq = 1
+			if k, _ := lastSeqKey(seqs.Cursor(), entry.UserID, entry.ProblemID); k != nil {
+				entry.Seq = keyNumber(k) + 1
+			}
+		}
+		key := seqKey(entry.UserID, entry.ProblemID, entry.Seq)
+		if seqs.Get(key) != nil {
+			return ErrDuplicate
+		}
+		if err := insert(tx.Bucket(bucketSnapshots), []byte(entry.ID), entry); err != nil {
+			return err
+		}
+		return seqs.Put(key, []byte(entry.ID))
+	})
+	if err != nil {
+		return nil, opError("failed to insert snapshot", err)
+	}
+	return &entry, nil
+}
+
+func (b *BoltStore) GetSnapshot(ctx context.Context, id string) (*Snapshot, error) {
+	var entry *Snapshot
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		entry, err = get[Snapshot](tx.Bucket(bucketSnapshots), []byte(id))
+		return err
+	})
+	if err != nil {
+		return nil, opError("failed to find snapshot", err)
+	}
+	if entry == nil {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+func (b *BoltStore) GetSnapshotsByProblemID(ctx context.Context, userID, problemID string) ([]Snapshot, error) {
+	var entries []Snapshot
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(bucketSnapshots)
+		prefix := seqPrefix(userID, problemID)
+		c := tx.Bucket(bucketSnapshotSeqs).Cursor()
+		for k, id := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, id = c.Next() {
+			entry, err := get[Snapshot](snapshots, id)
+			if err != nil {
+				return err
+			}
+			if entry != nil {
+				entries = append(entries, *entry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, opError("failed to query snapshots", err)
+	}
+	return entries, nil
+}
+
+func (b *BoltStore) GetLatestSnapshot(ctx context.Context, userID, problemID string) (*Snapshot, error) {
+	var entry *Snapshot
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		k, id := lastSeqKey(tx.Bucket(bucketSnapshotSeqs).Cursor(), userID, problemID)
+		if k == nil {
+			return nil
+		}
+		var err error
+		entry, err = get[Snapshot](tx.Bucket(bucketSnapshots), id)
+		return err
+	})
+	if err != nil {
+		return nil, opError("failed to find latest snapshot", err)
+	}
+	if entry == nil {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+func (b *BoltStore) ListSnapshots(ctx context.Context, q ListQuery) (Page[Snapshot], error) {
+	var entries []Snapshot
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return scan(tx.Bucket(bucketSnapshots), func(s Snapshot) {
+			if q.matches(s.UserID, s.ProblemID, s.SessionID, s.Timestamp) {
+				entries = append(entries, s)
+			}
+		})
+	})
+	if err != nil {
+		return Page[Snapshot]{}, opError("failed to query snapshots", err)
+	}
+	return paginate(entries, q, snapshotPos)
+}
+
+func (b *BoltStore) DeleteSnapshots(ctx context.Context, ids []string) (int, error) {
+	n := 0
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(bucketSnapshots)
+		for _, id := range ids {
+			entry, err := get[Snapshot](snapshots, []byte(id))
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				continue
+			}
+			if err := snapshots.Delete([]byte(id)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(bucketSnapshotSeqs).Delete(seqKey(entry.UserID, entry.ProblemID, entry.Seq)); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, opError("failed to delete snapshots", err)
+	}
+	return n, nil
+}
+
+func (b *BoltStore) SaveFeedback(ctx context.Context, entry FeedbackEntry) error {
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		return insert(tx.Bucket(bucketFeedbacks), []byte(entry.ID), entry)
+	})
+	if err != nil {
+		return opError("failed to insert feedback", err)
+	}
+	return nil
+}
+
+func (b *BoltStore) GetAllFeedbacksByProblemID(ctx context.Context, userID, problemID string) ([]FeedbackEntry, error) {
+	var entries []FeedbackEntry
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return scan(tx.Bucket(bucketFeedbacks), func(f FeedbackEntry) {
+			if f.UserID == userID && f.ProblemID == problemID {
+				entries = append(entries, f)
+			}
+		})
+	})
+	if err != nil {
+		return nil, opError("failed to query feedbacks", err)
+	}
+	return entries, nil
+}
+
+func (b *BoltStore) GetLatestFeedback(ctx context.Context, userID, problemID string) (*FeedbackEntry, error) {
+	var latest *FeedbackEntry
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return scan(tx.Bucket(bucketFeedbacks), func(f FeedbackEntry) {
+			if f.UserID == userID && f.ProblemID == problemID && (latest == nil || f.Timestamp.After(latest.Timestamp)) {
+				latest = &f
+			}
+		})
+	})
+	if err != nil {
+		return nil, opError("failed to find latest feedback", err)
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (b *BoltStore) ListFeedback(ctx context.Context, q ListQuery) (Page[FeedbackEntry], error) {
+	var entries []FeedbackEntry
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return scan(tx.Bucket(bucketFeedbacks), func(f FeedbackEntry) {
+			if q.matches(f.UserID, f.ProblemID, f.SessionID, f.Timestamp) {
+				entries = append(entries, f)
+			}
+		})
+	})
+	if err != nil {
+		return Page[FeedbackEntry]{}, opError("failed to query feedbacks", err)
+	}
+	return paginate(entries, q, feedbackPos)
+}
+
+func (b *BoltStore) SaveHint(ctx context.Context, entry HintEntry) error {
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		return insert(tx.Bucket(bucketHints), []byte(entry.ID), entry)
+	})
+	if err != nil {
+		return opError("failed to insert hint", err)
+	}
+	return nil
+}
+
+func (b *BoltStore) GetHintsByProblemID(ctx context.Context, userID, problemID string) ([]HintEntry, error) {
+	var entries []HintEntry
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return scan(tx.Bucket(bucketHints), func(h HintEntry) {
+			if h.UserID == userID && h.ProblemID == problemID {
+				entries = append(entries, h)
+			}
+		})
+	})
+	if err != nil {
+		return nil, opError("failed to query hints", err)
+	}
+	slices.SortStableFunc(entries, func(a, b HintEntry) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return entries, nil
+}
+
+func (b *BoltStore) RedactSessionCode(ctx context.Context, sessionID string, before time.Time) (int, error) {
+	n := 0
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		counts := make([]int, 3)
+		var err error
+		counts[0], err = rewrite(tx.Bucket(bucketSnapshots), func(s *Snapshot) bool {
+			return inRedaction(s.UserID, s.SessionID, s.Timestamp, sessionID, before) && redactSnapshot(s)
+		})
+		if err != nil {
+			return err
+		}
+		counts[1], err = rewrite(tx.Bucket(bucketFeedbacks), func(f *FeedbackEntry) bool {
+			return inRedaction(f.UserID, f.SessionID, f.Timestamp, sessionID, before) && redactFeedback(f)
+		})
+		if err != nil {
+			return err
+		}
+		counts[2], err = rewrite(tx.Bucket(bucketHints), func(h *HintEntry) bool {
+			return inRedaction(h.UserID, h.SessionID, h.Timestamp, sessionID, before) && redactHint(h)
+		})
+		n = counts[0] + counts[1] + counts[2]
+		return err
+	})
+	if err != nil {
+		return 0, opError("failed to redact code", err)
+	}
+	return n, nil
+}
+
+func (b *BoltStore) GetStatement(ctx context.Context, problemID string) (*StatementEntry, error) {
+	var entry *StatementEntry
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		entry, err = get[StatementEntry](tx.Bucket(bucketStatements), []byte(problemID))
+		return err
+	})
+	if err != nil {
+		return nil, opError("failed to fetch statement", err)
+	}
+	if entry == nil {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+// SaveStatement keeps the first statement stored for a problem, like the
+// unique index does for MongoManager.
+func (b *BoltStore) SaveStatement(ctx context.Context, entry StatementEntry) error {
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		err := insert(tx.Bucket(bucketStatements), []byte(entry.ProblemID), entry)
+		if errors.Is(err, ErrDuplicate) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return opError("failed to insert statement", err)
+	}
+	return nil
+}
+
+func (b *BoltStore) GetAllStatements(ctx context.Context) ([]StatementEntry, error) {
+	var entries []StatementEntry
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return scan(tx.Bucket(bucketStatements), func(s StatementEntry) {
+			entries = append(entries, s)
+		})
+	})
+	if err != nil {
+		return nil, opError("failed to query statements", err)
+	}
+	return entries, nil
+}
+
+func (b *BoltStore) SaveSummary(ctx context.Context, entry Summary) (*Summary, error) {
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		ids := tx.Bucket(bucketSummaryIDs)
+		if ids.Get([]byte(entry.ID)) != nil {
+			return ErrDuplicate
+		}
+		bucket := tx.Bucket(bucketSummaries)
+		if entry.Version == 0 {
+			entry.Version = 1
+			if k, _ := lastSeqKey(bucket.Cursor(), entry.UserID, entry.ProblemID); k != nil {
+				entry.Version = keyNumber(k) + 1
+			}
+		}
+		key := seqKey(entry.UserID, entry.ProblemID, entry.Version)
+		if err := insert(bucket, key, entry); err != nil {
+			return err
+		}
+		return ids.Put([]byte(entry.ID), key)
+	})
+	if err != nil {
+		return nil, opError("failed to insert summary", err)
+	}
+	return &entry, nil
+}
+
+func (b *BoltStore) GetSummaryByProblemID(ctx context.Context, userID, problemID string) (*Summary, error) {
+	var entry *Summary
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		k, _ := lastSeqKey(tx.Bucket(bucketSummaries).Cursor(), userID, problemID)
+		if k == nil {
+			return nil
+		}
+		var err error
+		entry, err = get[Summary](tx.Bucket(bucketSummaries), k)
+		return err
+	})
+	if err != nil {
+		return nil, opError("failed to find summary", err)
+	}
+	if entry == nil {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+func (b *BoltStore) GetSummaryHistory(ctx context.Context, userID, problemID string) ([]Summary, error) {
+	var entries []Summary
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		prefix := seqPrefix(userID, problemID)
+		c := tx.Bucket(bucketSummaries).Cursor()
+		for k, data := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, data = c.Next() {
+			var entry Summary
+			if err := bson.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, opError("failed to query summaries", err)
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+func (b *BoltStore) Search(ctx context.Context, userID, query string, limit int) ([]SearchHit, error) {
+	s := newSearcher(query)
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		err := scan(tx.Bucket(bucketStatements), func(entry StatementEntry) { s.add(statementHit(entry)) })
+		if err != nil {
+			return err
+		}
+		err = scan(tx.Bucket(bucketSnapshots), func(entry Snapshot) {
+			if entry.UserID == userID {
+				s.add(snapshotHit(entry))
+			}
+		})
+		if err != nil {
+			return err
+		}
+		err = scan(tx.Bucket(bucketFeedbacks), func(entry FeedbackEntry) {
+			if entry.UserID == userID {
+				s.add(feedbackHit(entry))
+			}
+		})
+		if err != nil {
+			return err
+		}
+		// The user's summaries are the keys with its prefix.
+		prefix := append([]byte(userID), 0)
+		c := tx.Bucket(bucketSummaries).Cursor()
+		for k, data := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, data = c.Next() {
+			var entry Summary
+			if err := bson.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+			s.add(summaryHit(entry))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, opError("failed to search", err)
+	}
+	return s.best(limit), nil
+}
+
+// view and update run fn in a read-only or read-write transaction, unless
+// ctx is already done. Transactions are short and not interrupted once begun.
+func (b *BoltStore) view(ctx context.Context, fn func(*bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.View(fn)
+}
+
+func (b *BoltStore) update(ctx context.Context, fn func(*bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.Update(fn)
+}
+
+// get decodes the record at key, or returns nil when there is none.
+func get[T any](bucket *bolt.Bucket, key []byte) (*T, error) {
+	data := bucket.Get(key)
+	if data == nil {
+		return nil, nil
+	}
+	var entry T
+	if err := bson.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func put(bucket *bolt.Bucket, key []byte, entry any) error {
+	data, err := bson.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// insert is put failing with ErrDuplicate when key is taken.
+func insert(bucket *bolt.Bucket, key []byte, entry any) error {
+	if bucket.Get(key) != nil {
+		return ErrDuplicate
+	}
+	return put(bucket, key, entry)
+}
+
+// scan decodes every record of bucket in key order.
+func scan[T any](bucket *bolt.Bucket, fn func(T)) error {
+	return bucket.ForEach(func(_, data []byte) error {
+		var entry T
+		if err := bson.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		fn(entry)
+		return nil
+	})
+}
+
+// rewrite stores back every record of bucket that fn changed and returns how
+// many there were.
+func rewrite[T any](bucket *bolt.Bucket, fn func(*T) bool) (int, error) {
+	changed := make(map[string]*T)
+	err := bucket.ForEach(func(key, data []byte) error {
+		var entry T
+		if err := bson.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		if fn(&entry) {
+			changed[string(key)] = &entry
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for key, entry := range changed {
+		if err := put(bucket, []byte(key), entry); err != nil {
+			return 0, err
+		}
+	}
+	return len(changed), nil
+}
+
+// Numbered keys, for snapshot seqs and summary versions, sort by user, then
+// by problem and then by number.
+
+func seqPrefix(userID, problemID string) []byte {
+	prefix := append([]byte(userID), 0)
+	prefix = append(prefix, problemID...)
+	return append(prefix, 0)
+}
+
+func seqKey(userID, problemID string, n int64) []byte {
+	return binary.BigEndian.AppendUint64(seqPrefix(userID, problemID), uint64(n))
+}
+
+func keyNumber(key []byte) int64 {
+	return int64(binary.BigEndian.Uint64(key[len(key)-8:]))
+}
+
+// lastSeqKey returns the highest numbered key of the user's problem and its
+// value.
+func lastSeqKey(c *bolt.Cursor, userID, problemID string) ([]byte, []byte) {
+	prefix := seqPrefix(userID, problemID)
+	k, v := c.Seek(seqKey(userID, problemID, -1)) // all ones: past every number
+	if k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	if k == nil || !bytes.HasPrefix(k, prefix) {
+		return nil, nil
+	}
+	return k, v
+}
@@ -0,0 +1,51 @@
+package storage_test
+
+import (
+	"coach_demon/internal/storage"
+	"coach_demon/internal/storage/storagetest"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		store, err := storage.NewBoltStore(filepath.Join(t.TempDir(), "coach.db"))
+		if err != nil {
+			t.Fatalf("NewBoltStore: %v", err)
+		}
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	})
+}
+
+func TestBoltStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coach.db")
+	store, err := storage.NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltStore: %v", err)
+	}
+	if err := store.SaveStatement(t.Context(), storage.StatementEntry{ProblemID: "1A", Statement: "Theatre Square"}); err != nil {
+		t.Fatalf("SaveStatement: %v", err)
+	}
+	if _, err := store.SaveSnapshot(t.Context(), storage.Snapshot{ProblemID: "1A"}); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	store, err = storage.NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+
+	statement, err := store.GetStatement(t.Context(), "1A")
+	if err != nil || statement == nil || statement.Statement != "Theatre Square" {
+		t.Fatalf("GetStatement after reopen = %+v, %v", statement, err)
+	}
+	snapshot, err := store.SaveSnapshot(t.Context(), storage.Snapshot{ProblemID: "1A"})
+	if err != nil || snapshot.Seq != 2 {
+		t.Fatalf("SaveSnapshot after reopen = %+v, %v; want seq 2", snapshot, err)
+	}
+}
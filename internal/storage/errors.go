@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Errors returned by Storage implementations, to be matched with errors.Is.
+// A cancelled context is reported as context.Canceled.
+var (
+	// ErrNotFound is returned by getters of a single record that does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when inserting a record whose ID, session
+	// token, snapshot seq or summary version is already taken.
+	ErrDuplicate = errors.New("duplicate key")
+	// ErrTimeout is returned when an operation ran past its deadline.
+	ErrTimeout = errors.New("storage timeout")
+	// ErrBackend is returned for any other failure of the database.
+	ErrBackend = errors.New("storage backend failure")
+)
+
+// opError wraps err, a failure of the operation described by op, so that it
+// matches exactly one of ErrDuplicate, ErrTimeout, context.Canceled or
+// ErrBackend.
+func opError(op string, err error) error {
+	switch {
+	case errors.Is(err, ErrDuplicate):
+		return fmt.Errorf("%s: %w", op, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%s: %w: %w", op, ErrTimeout, err)
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("%s: %w", op, err)
+	default:
+		return fmt.Errorf("%s: %w: %w", op, ErrBackend, err)
+	}
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page size bounds of ListQuery.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// ErrBadCursor is returned when ListQuery.Cursor was not produced by a
+// previous page.
+var ErrBadCursor = errors.New("invalid cursor")
+
+// ListQuery selects a page of the feedback or snapshots of a user, narrowed
+// to a problem, a session, or both. Records are ordered by timestamp, ties
+// broken by ID.
+type ListQuery struct {
+	UserID string
+	// AllUsers lists the records of every user and ignores UserID, for
+	// maintenance that spans users.
+	AllUsers  bool
+	ProblemID string
+	SessionID string
+	// Since and Until bound the timestamp: Since inclusive, Until exclusive.
+	// Zero leaves that side open.
+	Since time.Time
+	Until time.Time
+	// Descending lists the newest records first.
+	Descending bool
+	// Limit is the page size: DefaultListLimit when zero, at most MaxListLimit.
+	Limit int
+	// Cursor continues after the last record of a previous page.
+	Cursor string
+}
+
+// Page is one page of a listing. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+}
+
+func (q ListQuery) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultListLimit
+	case q.Limit > MaxListLimit:
+		return MaxListLimit
+	}
+	return q.Limit
+}
+
+// listPos is the position of a record in a listing.
+type listPos struct {
+	Timestamp time.Time
+	ID        string
+}
+
+func compareListPos(a, b listPos) int {
+	return cmp.Or(a.Timestamp.Compare(b.Timestamp), strings.Compare(a.ID, b.ID))
+}
+
+func encodeCursor(pos listPos) string {
+	raw := strconv.FormatInt(pos.Timestamp.UnixNano(), 10) + ":" + pos.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// after decodes the cursor, returning false when the query has none.
+func (q ListQuery) after() (listPos, bool, error) {
+	if q.Cursor == "" {
+		return listPos{}, false, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return listPos{}, false, fmt.Errorf("%w: %v", ErrBadCursor, err)
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return listPos{}, false, ErrBadCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return listPos{}, false, fmt.Errorf("%w: %v", ErrBadCursor, err)
+	}
+	return listPos{Timestamp: time.Unix(0, n).UTC(), ID: id}, true, nil
+}
+
+// matches reports whether a record belongs to the listing, ignoring the cursor.
+func (q ListQuery) matches(userID, problemID, sessionID string, ts time.Time) bool {
+	return (q.AllUsers || userID == q.UserID) &&
+		(q.ProblemID == "" || problemID == q.ProblemID) &&
+		(q.SessionID == "" || sessionID == q.SessionID) &&
+		(q.Since.IsZero() || !ts.Before(q.Since)) &&
+		(q.Until.IsZero() || ts.Before(q.Until))
+}
+
+// paginate orders the matching records of a store without indexes and cuts
+// out the page the query asks for.
+func paginate[T any](items []T, q ListQuery, pos func(T) listPos) (Page[T], error) {
+	after, hasCursor, err := q.after()
+	if err != nil {
+		return Page[T]{}, err
+	}
+	compare := func(a, b T) int { return compareListPos(pos(a), pos(b)) }
+	if q.Descending {
+		compare = func(a, b T) int { return compareListPos(pos(b), pos(a)) }
+	}
+	slices.SortFunc(items, compare)
+
+	if hasCursor {
+		items = slices.DeleteFunc(items, func(item T) bool {
+			c := compareListPos(pos(item), after)
+			return c == 0 || (c < 0) != q.Descending
+		})
+	}
+	return newPage(items, q.limit(), pos), nil
+}
+
+// newPage keeps the first limit items, given up to one more to tell whether
+// another page follows.
+func newPage[T any](items []T, limit int, pos func(T) listPos) Page[T] {
+	if len(items) <= limit {
+		return Page[T]{Items: items}
+	}
+	items = items[:limit]
+	return Page[T]{Items: items, NextCursor: encodeCursor(pos(items[limit-1]))}
+}
+
+func feedbackPos(f FeedbackEntry) listPos {
+	return listPos{Timestamp: f.Timestamp, ID: f.ID}
+}
+
+func snapshotPos(s Snapshot) listPos {
+	return listPos{Timestamp: s.Timestamp, ID: s.ID}
+}
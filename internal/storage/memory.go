@@ -0,0 +1,593 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Storage kept entirely in memory. It mirrors the
+// semantics of MongoManager and is meant for tests and offline runs;
+// everything is lost when the process exits.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	sessions   []Session
+	snapshots  []Snapshot
+	feedbacks  []FeedbackEntry
+	hints      []HintEntry
+	statements []StatementEntry
+	summaries  []Summary
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (m *MemoryStore) CreateSession(ctx context.Context, entry Session) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	if entry.Token == "" {
+		entry.Token = NewID()
+	}
+	for _, s := range m.sessions {
+		if s.ID == entry.ID || s.Token == entry.Token {
+			return nil, opError("failed to insert session", ErrDuplicate)
+		}
+	}
+	m.sessions = append(m.sessions, *copySession(entry))
+	return copySession(entry), nil
+}
+
+func (m *MemoryStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	for _, s := range m.sessions {
+		if s.ID == id {
+			return copySession(s), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) GetSessionByToken(ctx context.Context, token string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	for _, s := range m.sessions {
+		if s.Token == token {
+			return copySession(s), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) GetSessionsByProblemID(ctx context.Context, userID, problemID string) ([]Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	var entries []Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.ProblemID == problemID {
+			entries = append(entries, *copySession(s))
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b Session) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	return entries, nil
+}
+
+func (m *MemoryStore) TouchSession(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return opError("memory store", err)
+	}
+
+	for i := range m.sessions {
+		if m.sessions[i].ID == id {
+			m.sessions[i].LastSeenAt = at
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) EndSession(ctx context.Context, id string, at time.Time, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return opError("memory store", err)
+	}
+
+	for i := range m.sessions {
+		if m.sessions[i].ID == id && m.sessions[i].EndedAt == nil {
+			m.sessions[i].EndedAt = &at
+			m.sessions[i].EndReason = reason
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) EndIdleSessions(ctx context.Context, idleSince, at time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, opError("memory store", err)
+	}
+
+	n := 0
+	for i := range m.sessions {
+		s := &m.sessions[i]
+		if s.EndedAt == nil && s.LastSeenAt.Before(idleSince) {
+			s.EndedAt = &at
+			s.EndReason = SessionEndIdle
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) SaveSnapshot(ctx context.Context, entry Snapshot) (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	var latest int64
+	for _, s := range m.snapshots {
+		if s.ID == entry.ID {
+			return nil, opError("failed to insert snapshot", ErrDuplicate)
+		}
+		if s.UserID == entry.UserID && s.ProblemID == entry.ProblemID {
+			if s.Seq == entry.Seq {
+				return nil, opError("failed to insert snapshot", ErrDuplicate)
+			}
+			latest = max(latest, s.Seq)
+		}
+	}
+	if entry.Seq == 0 {
+		entry.Seq = latest + 1
+	}
+	m.snapshots = append(m.snapshots, *copySnapshot(entry))
+	return copySnapshot(entry), nil
+}
+
+func (m *MemoryStore) GetSnapshot(ctx context.Context, id string) (*Snapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	for _, s := range m.snapshots {
+		if s.ID == id {
+			return copySnapshot(s), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) GetSnapshotsByProblemID(ctx context.Context, userID, problemID string) ([]Snapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	var entries []Snapshot
+	for _, s := range m.snapshots {
+		if s.UserID == userID && s.ProblemID == problemID {
+			entries = append(entries, *copySnapshot(s))
+		}
+	}
+	slices.SortFunc(entries, func(a, b Snapshot) int {
+		return cmp.Compare(a.Seq, b.Seq)
+	})
+	return entries, nil
+}
+
+func (m *MemoryStore) GetLatestSnapshot(ctx context.Context, userID, problemID string) (*Snapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	var latest *Snapshot
+	for i, s := range m.snapshots {
+		if s.UserID == userID && s.ProblemID == problemID && (latest == nil || s.Seq > latest.Seq) {
+			latest = &m.snapshots[i]
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return copySnapshot(*latest), nil
+}
+
+func (m *MemoryStore) ListSnapshots(ctx context.Context, q ListQuery) (Page[Snapshot], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return Page[Snapshot]{}, opError("memory store", err)
+	}
+
+	var entries []Snapshot
+	for _, s := range m.snapshots {
+		if q.matches(s.UserID, s.ProblemID, s.SessionID, s.Timestamp) {
+			entries = append(entries, *copySnapshot(s))
+		}
+	}
+	return paginate(entries, q, snapshotPos)
+}
+
+func (m *MemoryStore) DeleteSnapshots(ctx context.Context, ids []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, opError("memory store", err)
+	}
+
+	n := len(m.snapshots)
+	m.snapshots = slices.DeleteFunc(m.snapshots, func(s Snapshot) bool {
+		return slices.Contains(ids, s.ID)
+	})
+	return n - len(m.snapshots), nil
+}
+
+func (m *MemoryStore) SaveFeedback(ctx context.Context, entry FeedbackEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return opError("memory store", err)
+	}
+
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	for _, f := range m.feedbacks {
+		if f.ID == entry.ID {
+			return opError("failed to insert feedback", ErrDuplicate)
+		}
+	}
+	m.feedbacks = append(m.feedbacks, entry)
+	return nil
+}
+
+func (m *MemoryStore) GetAllFeedbacksByProblemID(ctx context.Context, userID, problemID string) ([]FeedbackEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	var entries []FeedbackEntry
+	for _, f := range m.feedbacks {
+		if f.UserID == userID && f.ProblemID == problemID {
+			entries = append(entries, f)
+		}
+	}
+	return entries, nil
+}
+
+func (m *MemoryStore) GetLatestFeedback(ctx context.Context, userID, problemID string) (*FeedbackEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	var latest *FeedbackEntry
+	for i, f := range m.feedbacks {
+		if f.UserID == userID && f.ProblemID == problemID && (latest == nil || f.Timestamp.After(latest.Timestamp)) {
+			latest = &m.feedbacks[i]
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	entry := *latest
+	return &entry, nil
+}
+
+func (m *MemoryStore) ListFeedback(ctx context.Context, q ListQuery) (Page[FeedbackEntry], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return Page[FeedbackEntry]{}, opError("memory store", err)
+	}
+
+	var entries []FeedbackEntry
+	for _, f := range m.feedbacks {
+		if q.matches(f.UserID, f.ProblemID, f.SessionID, f.Timestamp) {
+			entries = append(entries, f)
+		}
+	}
+	return paginate(entries, q, feedbackPos)
+}
+
+func (m *MemoryStore) SaveHint(ctx context.Context, entry HintEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return opError("memory store", err)
+	}
+
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	for _, h := range m.hints {
+		if h.ID == entry.ID {
+			return opError("failed to insert hint", ErrDuplicate)
+		}
+	}
+	m.hints = append(m.hints, entry)
+	return nil
+}
+
+func (m *MemoryStore) GetHintsByProblemID(ctx context.Context, userID, problemID string) ([]HintEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	var entries []HintEntry
+	for _, h := range m.hints {
+		if h.UserID == userID && h.ProblemID == problemID {
+			entries = append(entries, h)
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b HintEntry) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return entries, nil
+}
+
+func (m *MemoryStore) RedactSessionCode(ctx context.Context, sessionID string, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, opError("memory store", err)
+	}
+
+	n := 0
+	for i := range m.snapshots {
+		s := &m.snapshots[i]
+		if inRedaction(s.UserID, s.SessionID, s.Timestamp, sessionID, before) && redactSnapshot(s) {
+			n++
+		}
+	}
+	for i := range m.feedbacks {
+		f := &m.feedbacks[i]
+		if inRedaction(f.UserID, f.SessionID, f.Timestamp, sessionID, before) && redactFeedback(f) {
+			n++
+		}
+	}
+	for i := range m.hints {
+		h := &m.hints[i]
+		if inRedaction(h.UserID, h.SessionID, h.Timestamp, sessionID, before) && redactHint(h) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) GetStatement(ctx context.Context, problemID string) (*StatementEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	for _, s := range m.statements {
+		if s.ProblemID == problemID {
+			entry := s
+			return &entry, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// SaveStatement keeps the first statement stored for a problem, like the
+// unique index does for MongoManager.
+func (m *MemoryStore) SaveStatement(ctx context.Context, entry StatementEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return opError("memory store", err)
+	}
+
+	for _, s := range m.statements {
+		if s.ProblemID == entry.ProblemID {
+			return nil
+		}
+	}
+	m.statements = append(m.statements, entry)
+	return nil
+}
+
+func (m *MemoryStore) GetAllStatements(ctx context.Context) ([]StatementEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	return slices.Clone(m.statements), nil
+}
+
+func (m *MemoryStore) SaveSummary(ctx context.Context, entry Summary) (*Summary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	var latest int64
+	for _, s := range m.summaries {
+		if s.ID == entry.ID {
+			return nil, opError("failed to insert summary", ErrDuplicate)
+		}
+		if s.UserID == entry.UserID && s.ProblemID == entry.ProblemID {
+			if s.Version == entry.Version {
+				return nil, opError("failed to insert summary", ErrDuplicate)
+			}
+			latest = max(latest, s.Version)
+		}
+	}
+	if entry.Version == 0 {
+		entry.Version = latest + 1
+	}
+	m.summaries = append(m.summaries, copySummary(entry))
+	stored := copySummary(entry)
+	return &stored, nil
+}
+
+func (m *MemoryStore) GetSummaryByProblemID(ctx context.Context, userID, problemID string) (*Summary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	var latest *Summary
+	for i, s := range m.summaries {
+		if s.UserID == userID && s.ProblemID == problemID && (latest == nil || s.Version > latest.Version) {
+			latest = &m.summaries[i]
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	entry := copySummary(*latest)
+	return &entry, nil
+}
+
+func (m *MemoryStore) GetSummaryHistory(ctx context.Context, userID, problemID string) ([]Summary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	var entries []Summary
+	for _, s := range m.summaries {
+		if s.UserID == userID && s.ProblemID == problemID {
+			entries = append(entries, copySummary(s))
+		}
+	}
+	slices.SortFunc(entries, func(a, b Summary) int {
+		return cmp.Compare(b.Version, a.Version)
+	})
+	return entries, nil
+}
+
+func (m *MemoryStore) Search(ctx context.Context, userID, query string, limit int) ([]SearchHit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, opError("memory store", err)
+	}
+
+	s := newSearcher(query)
+	for _, entry := range m.statements {
+		s.add(statementHit(entry))
+	}
+	for _, entry := range m.snapshots {
+		if entry.UserID == userID {
+			s.add(snapshotHit(entry))
+		}
+	}
+	for _, entry := range m.feedbacks {
+		if entry.UserID == userID {
+			s.add(feedbackHit(entry))
+		}
+	}
+	for _, entry := range m.summaries {
+		if entry.UserID == userID {
+			s.add(summaryHit(entry))
+		}
+	}
+	return s.best(limit), nil
+}
+
+// The copy helpers detach returned records from the store's own slices,
+// maps and pointers, as decoding from Mongo would.
+
+func copySession(s Session) *Session {
+	if s.EndedAt != nil {
+		endedAt := *s.EndedAt
+		s.EndedAt = &endedAt
+	}
+	return &s
+}
+
+func copySnapshot(s Snapshot) *Snapshot {
+	s.Files = slices.Clone(s.Files)
+	if s.Cursor != nil {
+		cursor := *s.Cursor
+		s.Cursor = &cursor
+	}
+	return &s
+}
+
+func copySummary(s Summary) Summary {
+	s.HintsUsed = maps.Clone(s.HintsUsed)
+	s.FeedbackIDs = slices.Clone(s.FeedbackIDs)
+	return s
+}
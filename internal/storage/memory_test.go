@@ -0,0 +1,13 @@
+package storage_test
+
+import (
+	"coach_demon/internal/storage"
+	"coach_demon/internal/storage/storagetest"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewMemoryStore()
+	})
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CopyStats counts the records copied per collection.
+type CopyStats struct {
+	Statements int
+	Sessions   int
+	Snapshots  int
+	Feedbacks  int
+	Hints      int
+	Summaries  int
+}
+
+// CopyTo copies every record of the database into dst, keeping IDs, session
+// tokens, snapshot seqs and summary versions. It reads the collections
+// directly rather than through the per-problem queries, so nothing is left
+// behind. dst should be empty: records it already holds fail with a
+// duplicate key error, except statements, which keep the existing one.
+func (m *MongoManager) CopyTo(ctx context.Context, dst Storage) (CopyStats, error) {
+	var stats CopyStats
+	var err error
+
+	if stats.Statements, err = copyCollection(ctx, m.statements, dst.SaveStatement); err != nil {
+		return stats, fmt.Errorf("failed to copy statements: %w", err)
+	}
+	stats.Sessions, err = copyCollection(ctx, m.sessions, func(ctx context.Context, s Session) error {
+		_, err := dst.CreateSession(ctx, s)
+		return err
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to copy sessions: %w", err)
+	}
+	stats.Snapshots, err = copyCollection(ctx, m.snapshots, func(ctx context.Context, s Snapshot) error {
+		_, err := dst.SaveSnapshot(ctx, s)
+		return err
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to copy snapshots: %w", err)
+	}
+	if stats.Feedbacks, err = copyCollection(ctx, m.feedbacks, dst.SaveFeedback); err != nil {
+		return stats, fmt.Errorf("failed to copy feedbacks: %w", err)
+	}
+	if stats.Hints, err = copyCollection(ctx, m.hints, dst.SaveHint); err != nil {
+		return stats, fmt.Errorf("failed to copy hints: %w", err)
+	}
+	stats.Summaries, err = copyCollection(ctx, m.summaries, func(ctx context.Context, s Summary) error {
+		_, err := dst.SaveSummary(ctx, s)
+		return err
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to copy summaries: %w", err)
+	}
+	return stats, nil
+}
+
+// copyCollection decodes every document of coll and passes it to save.
+func copyCollection[T any](ctx context.Context, coll *mongo.Collection, save func(context.Context, T) error) (int, error) {
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	n := 0
+	for cursor.Next(ctx) {
+		var entry T
+		if err := cursor.Decode(&entry); err != nil {
+			return n, err
+		}
+		if err := save(ctx, entry); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, cursor.Err()
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"coach_demon/internal/search"
 	"context"
 	"errors"
 	"fmt"
@@ -8,78 +9,254 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+	"time"
 )
 
+// insertRetries bounds retries when two writers race for the same snapshot
+// seq or summary version.
+const insertRetries = 5
+
 type MongoManager struct {
+	db         *mongo.Database
+	sessions   *mongo.Collection
+	snapshots  *mongo.Collection
 	feedbacks  *mongo.Collection
+	hints      *mongo.Collection
 	summaries  *mongo.Collection
 	statements *mongo.Collection
 	logger     *zerolog.Logger
 }
 
-func NewMongoManager(uri string, logger *zerolog.Logger) (*MongoManager, error) {
+// NewMongoManager connects to the database named database at uri. Indexes
+// are created by the schema migrations; see Migrate and CheckSchema.
+func NewMongoManager(ctx context.Context, uri, database string, logger *zerolog.Logger) (*MongoManager, error) {
 	clientOpts := options.Client().ApplyURI(uri)
-	client, err := mongo.Connect(context.Background(), clientOpts)
+	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
 		return nil, fmt.Errorf("cannot connect to MongoDB: %w", err)
 	}
-	if err := client.Ping(context.Background(), nil); err != nil {
+	if err := client.Ping(ctx, nil); err != nil {
 		return nil, fmt.Errorf("cannot ping MongoDB: %w", err)
 	}
 
-	db := client.Database("coach_demon")
+	db := client.Database(database)
 	logger.Info().Msg("connected to MongoDB")
 
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "problemid", Value: 1}},
-		Options: options.Index().SetUnique(true),
+	return &MongoManager{
+		db:         db,
+		sessions:   db.Collection("sessions"),
+		snapshots:  db.Collection("snapshots"),
+		feedbacks:  db.Collection("feedbacks"),
+		hints:      db.Collection("hints"),
+		statements: db.Collection("statements"),
+		summaries:  db.Collection("summaries"),
+		logger:     logger,
+	}, nil
+}
+
+func (m *MongoManager) CreateSession(ctx context.Context, entry Session) (*Session, error) {
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	if entry.Token == "" {
+		entry.Token = NewID()
 	}
-	_, err = db.Collection("summaries").Indexes().CreateOne(context.Background(), indexModel)
+	_, err := m.sessions.InsertOne(ctx, entry)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create unique index on summaries: %w", err)
+		return nil, mongoError("failed to insert session", err)
 	}
+	return &entry, nil
+}
 
-	_, err = db.Collection("statements").Indexes().CreateOne(context.Background(), indexModel)
+func (m *MongoManager) GetSession(ctx context.Context, id string) (*Session, error) {
+	return m.findSession(ctx, bson.M{"_id": id})
+}
+
+func (m *MongoManager) GetSessionByToken(ctx context.Context, token string) (*Session, error) {
+	return m.findSession(ctx, bson.M{"token": token})
+}
+
+func (m *MongoManager) findSession(ctx context.Context, filter bson.M) (*Session, error) {
+	var entry Session
+	err := m.sessions.FindOne(ctx, filter).Decode(&entry)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create unique index on statements: %w", err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, mongoError("failed to find session", err)
 	}
+	return &entry, nil
+}
 
-	return &MongoManager{
-		feedbacks:  db.Collection("feedbacks"),
-		statements: db.Collection("statements"),
-		summaries:  db.Collection("summaries"),
-		logger:     logger,
-	}, nil
+func (m *MongoManager) GetSessionsByProblemID(ctx context.Context, userID, problemID string) ([]Session, error) {
+	filter := bson.M{"userID": userID, "problemID": problemID}
+	opts := options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}})
+	cursor, err := m.sessions.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, mongoError("failed to query sessions", err)
+	}
+	defer func() {
+		if cerr := cursor.Close(context.Background()); cerr != nil {
+			m.logger.Error().Msgf("failed to close cursor: %v", cerr)
+		}
+	}()
+
+	var entries []Session
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, mongoError("failed to decode sessions", err)
+	}
+	return entries, nil
 }
 
-func (m *MongoManager) SaveFeedback(entry FeedbackEntry) error {
-	_, err := m.feedbacks.InsertOne(context.Background(), entry)
+func (m *MongoManager) TouchSession(ctx context.Context, id string, at time.Time) error {
+	_, err := m.sessions.UpdateByID(ctx, id, bson.M{"$set": bson.M{"lastSeenAt": at}})
 	if err != nil {
-		return fmt.Errorf("failed to insert feedback: %w", err)
+		return mongoError("failed to touch session", err)
 	}
 	return nil
 }
 
-func (m *MongoManager) GetLatestFeedback(problemID string) (*FeedbackEntry, error) {
-	filter := bson.M{"problemid": problemID}
+func (m *MongoManager) EndSession(ctx context.Context, id string, at time.Time, reason string) error {
+	filter := bson.M{"_id": id, "endedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"endedAt": at, "endReason": reason}}
+	_, err := m.sessions.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return mongoError("failed to end session", err)
+	}
+	return nil
+}
+
+func (m *MongoManager) EndIdleSessions(ctx context.Context, idleSince, at time.Time) (int, error) {
+	filter := bson.M{"endedAt": bson.M{"$exists": false}, "lastSeenAt": bson.M{"$lt": idleSince}}
+	update := bson.M{"$set": bson.M{"endedAt": at, "endReason": SessionEndIdle}}
+	res, err := m.sessions.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, mongoError("failed to end idle sessions", err)
+	}
+	return int(res.ModifiedCount), nil
+}
+
+func (m *MongoManager) SaveSnapshot(ctx context.Context, entry Snapshot) (*Snapshot, error) {
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	assignSeq := entry.Seq == 0
+
+	for attempt := 0; ; attempt++ {
+		if assignSeq {
+			latest, err := m.GetLatestSnapshot(ctx, entry.UserID, entry.ProblemID)
+			switch {
+			case err == nil:
+				entry.Seq = latest.Seq + 1
+			case errors.Is(err, ErrNotFound):
+				entry.Seq = 1
+			default:
+				return nil, err
+			}
+		}
+
+		_, err := m.snapshots.InsertOne(ctx, entry)
+		if mongo.IsDuplicateKeyError(err) && assignSeq && attempt < insertRetries {
+			continue
+		}
+		if err != nil {
+			return nil, mongoError("failed to insert snapshot", err)
+		}
+		return &entry, nil
+	}
+}
+
+func (m *MongoManager) GetSnapshot(ctx context.Context, id string) (*Snapshot, error) {
+	var entry Snapshot
+	err := m.snapshots.FindOne(ctx, bson.M{"_id": id}).Decode(&entry)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, mongoError("failed to find snapshot", err)
+	}
+	return &entry, nil
+}
+
+func (m *MongoManager) GetSnapshotsByProblemID(ctx context.Context, userID, problemID string) ([]Snapshot, error) {
+	filter := bson.M{"userID": userID, "problemID": problemID}
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cursor, err := m.snapshots.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, mongoError("failed to query snapshots", err)
+	}
+	defer func() {
+		if cerr := cursor.Close(context.Background()); cerr != nil {
+			m.logger.Error().Msgf("failed to close cursor: %v", cerr)
+		}
+	}()
+
+	var entries []Snapshot
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, mongoError("failed to decode snapshots", err)
+	}
+	return entries, nil
+}
+
+func (m *MongoManager) GetLatestSnapshot(ctx context.Context, userID, problemID string) (*Snapshot, error) {
+	filter := bson.M{"userID": userID, "problemID": problemID}
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+
+	var entry Snapshot
+	err := m.snapshots.FindOne(ctx, filter, opts).Decode(&entry)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, mongoError("failed to find latest snapshot", err)
+	}
+	return &entry, nil
+}
+
+func (m *MongoManager) ListSnapshots(ctx context.Context, q ListQuery) (Page[Snapshot], error) {
+	return findPage(ctx, m, m.snapshots, q, snapshotPos, "snapshots")
+}
+
+func (m *MongoManager) DeleteSnapshots(ctx context.Context, ids []string) (int, error) {
+	res, err := m.snapshots.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, mongoError("failed to delete snapshots", err)
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (m *MongoManager) SaveFeedback(ctx context.Context, entry FeedbackEntry) error {
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	_, err := m.feedbacks.InsertOne(ctx, entry)
+	if err != nil {
+		return mongoError("failed to insert feedback", err)
+	}
+	return nil
+}
+
+func (m *MongoManager) GetLatestFeedback(ctx context.Context, userID, problemID string) (*FeedbackEntry, error) {
+	filter := bson.M{"userID": userID, "problemID": problemID}
 	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})
 
 	var entry FeedbackEntry
-	err := m.feedbacks.FindOne(context.Background(), filter, opts).Decode(&entry)
+	err := m.feedbacks.FindOne(ctx, filter, opts).Decode(&entry)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, nil
+			return nil, ErrNotFound
 		}
-		return nil, fmt.Errorf("failed to find latest feedback: %w", err)
+		return nil, mongoError("failed to find latest feedback", err)
 	}
 	return &entry, nil
 }
 
-func (m *MongoManager) GetAllFeedbacksByProblemID(problemID string) ([]FeedbackEntry, error) {
-	filter := bson.M{"problemid": problemID}
-	cursor, err := m.feedbacks.Find(context.Background(), filter)
+func (m *MongoManager) GetAllFeedbacksByProblemID(ctx context.Context, userID, problemID string) ([]FeedbackEntry, error) {
+	filter := bson.M{"userID": userID, "problemID": problemID}
+	cursor, err := m.feedbacks.Find(ctx, filter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query feedbacks: %w", err)
+		return nil, mongoError("failed to query feedbacks", err)
 	}
 	defer func() {
 		if cerr := cursor.Close(context.Background()); cerr != nil {
@@ -88,73 +265,197 @@ func (m *MongoManager) GetAllFeedbacksByProblemID(problemID string) ([]FeedbackE
 	}()
 
 	var entries []FeedbackEntry
-	if err := cursor.All(context.Background(), &entries); err != nil {
-		return nil, fmt.Errorf("failed to decode feedbacks: %w", err)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, mongoError("failed to decode feedbacks", err)
 	}
 	return entries, nil
 }
 
-func (m *MongoManager) GetStatement(problemID string) (*StatementEntry, error) {
-	filter := bson.M{"problemid": problemID}
+func (m *MongoManager) ListFeedback(ctx context.Context, q ListQuery) (Page[FeedbackEntry], error) {
+	return findPage(ctx, m, m.feedbacks, q, feedbackPos, "feedbacks")
+}
+
+func (m *MongoManager) SaveHint(ctx context.Context, entry HintEntry) error {
+	if entry.ID == "" {
+		entry.ID = NewID()
+	}
+	_, err := m.hints.InsertOne(ctx, entry)
+	if err != nil {
+		return mongoError("failed to insert hint", err)
+	}
+	return nil
+}
+
+func (m *MongoManager) GetHintsByProblemID(ctx context.Context, userID, problemID string) ([]HintEntry, error) {
+	filter := bson.M{"userID": userID, "problemID": problemID}
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+	cursor, err := m.hints.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, mongoError("failed to query hints", err)
+	}
+	defer func() {
+		if cerr := cursor.Close(context.Background()); cerr != nil {
+			m.logger.Error().Msgf("failed to close cursor: %v", cerr)
+		}
+	}()
+
+	var entries []HintEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, mongoError("failed to decode hints", err)
+	}
+	return entries, nil
+}
+
+func (m *MongoManager) RedactSessionCode(ctx context.Context, sessionID string, before time.Time) (int, error) {
+	scope := bson.D{{Key: "timestamp", Value: bson.M{"$lt": before}}}
+	if sessionID == "" {
+		scope = append(scope,
+			bson.E{Key: "sessionID", Value: bson.M{"$in": bson.A{nil, ""}}},
+			bson.E{Key: "userID", Value: ""},
+		)
+	} else {
+		scope = append(scope, bson.E{Key: "sessionID", Value: sessionID})
+	}
+	withCode := bson.E{Key: "code", Value: bson.M{"$nin": bson.A{nil, ""}}}
+
+	n := 0
+	res, err := m.snapshots.UpdateMany(ctx,
+		slices.Concat(scope, bson.D{{Key: "$or", Value: bson.A{
+			bson.D{withCode},
+			bson.M{"files": bson.M{"$elemMatch": bson.M{"content": bson.M{"$ne": ""}}}},
+		}}}),
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"files": bson.M{"$cond": bson.A{
+				bson.M{"$isArray": "$files"},
+				bson.M{"$map": bson.M{
+					"input": "$files",
+					"in":    bson.M{"$mergeObjects": bson.A{"$$this", bson.M{"content": ""}}},
+				}},
+				"$$REMOVE",
+			}},
+		}}}, {{Key: "$unset", Value: "code"}}},
+	)
+	if err != nil {
+		return 0, mongoError("failed to redact snapshot code", err)
+	}
+	n += int(res.ModifiedCount)
+
+	for name, coll := range map[string]*mongo.Collection{"feedback": m.feedbacks, "hint": m.hints} {
+		res, err := coll.UpdateMany(ctx, slices.Concat(scope, bson.D{withCode}), bson.M{"$unset": bson.M{"code": ""}})
+		if err != nil {
+			return n, mongoError("failed to redact "+name+" code", err)
+		}
+		n += int(res.ModifiedCount)
+	}
+	return n, nil
+}
+
+func (m *MongoManager) GetStatement(ctx context.Context, problemID string) (*StatementEntry, error) {
+	filter := bson.M{"problemID": problemID}
 	var result StatementEntry
-	err := m.statements.FindOne(context.Background(), filter).Decode(&result)
+	err := m.statements.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, nil
+			return nil, ErrNotFound
 		}
-		return nil, fmt.Errorf("failed to fetch statement: %w", err)
+		return nil, mongoError("failed to fetch statement", err)
 	}
 	return &result, nil
 }
 
-func (m *MongoManager) SaveStatement(entry StatementEntry) error {
-	_, err := m.statements.InsertOne(context.Background(), entry)
+// mongoStatement is a statement as stored, with the text its text index
+// covers.
+type mongoStatement struct {
+	StatementEntry `bson:",inline"`
+	Text           string `bson:"text"`
+}
+
+func (m *MongoManager) SaveStatement(ctx context.Context, entry StatementEntry) error {
+	_, err := m.statements.InsertOne(ctx, mongoStatement{entry, statementText(entry.Statement)})
 	if mongo.IsDuplicateKeyError(err) {
 		m.logger.Warn().Msgf("statement already exists for problemID %s", entry.ProblemID)
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to insert statement: %w", err)
+		return mongoError("failed to insert statement", err)
 	}
 	return nil
 }
 
-func (m *MongoManager) SaveSummary(entry Summary) error {
-	_, err := m.summaries.InsertOne(context.Background(), entry)
-	if mongo.IsDuplicateKeyError(err) {
-		m.logger.Warn().Msgf("summary already exists for problemID %s", entry.ProblemID)
-		return nil
+func (m *MongoManager) SaveSummary(ctx context.Context, entry Summary) (*Summary, error) {
+	if entry.ID == "" {
+		entry.ID = NewID()
 	}
-	if err != nil {
-		return fmt.Errorf("failed to insert summary: %w", err)
+	assignVersion := entry.Version == 0
+
+	for attempt := 0; ; attempt++ {
+		if assignVersion {
+			latest, err := m.GetSummaryByProblemID(ctx, entry.UserID, entry.ProblemID)
+			switch {
+			case err == nil:
+				entry.Version = latest.Version + 1
+			case errors.Is(err, ErrNotFound):
+				entry.Version = 1
+			default:
+				return nil, err
+			}
+		}
+
+		_, err := m.summaries.InsertOne(ctx, entry)
+		if mongo.IsDuplicateKeyError(err) && assignVersion && attempt < insertRetries {
+			continue
+		}
+		if err != nil {
+			return nil, mongoError("failed to insert summary", err)
+		}
+		return &entry, nil
 	}
-	return nil
 }
 
-func (m *MongoManager) GetSummaryByProblemID(problemID string) (*Summary, error) {
-	filter := bson.M{"problemid": problemID}
-	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+func (m *MongoManager) GetSummaryByProblemID(ctx context.Context, userID, problemID string) (*Summary, error) {
+	filter := bson.M{"userID": userID, "problemID": problemID}
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
 
 	var entry Summary
-	err := m.summaries.FindOne(context.Background(), filter, opts).Decode(&entry)
+	err := m.summaries.FindOne(ctx, filter, opts).Decode(&entry)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, nil
+			return nil, ErrNotFound
 		}
-		return nil, fmt.Errorf("failed to find summary: %w", err)
+		return nil, mongoError("failed to find summary", err)
 	}
 	return &entry, nil
 }
 
-func (m *MongoManager) GetAllStatements() ([]StatementEntry, error) {
-	cursor, err := m.statements.Find(context.Background(), bson.M{})
+func (m *MongoManager) GetSummaryHistory(ctx context.Context, userID, problemID string) ([]Summary, error) {
+	filter := bson.M{"userID": userID, "problemID": problemID}
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}})
+	cursor, err := m.summaries.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, mongoError("failed to query summaries", err)
+	}
+	defer func() {
+		if cerr := cursor.Close(context.Background()); cerr != nil {
+			m.logger.Error().Msgf("failed to close cursor: %v", cerr)
+		}
+	}()
+
+	var entries []Summary
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, mongoError("failed to decode summaries", err)
+	}
+	return entries, nil
+}
+
+func (m *MongoManager) GetAllStatements(ctx context.Context) ([]StatementEntry, error) {
+	cursor, err := m.statements.Find(ctx, bson.M{})
 	if err != nil {
-		return nil, err
+		return nil, mongoError("failed to query statements", err)
 	}
 	defer cursor.Close(context.Background())
 
 	var statements []StatementEntry
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var doc StatementEntry
 		if err := cursor.Decode(&doc); err != nil {
 			m.logger.Err(err).Msg("failed to decode statement entry")
@@ -163,8 +464,139 @@ func (m *MongoManager) GetAllStatements() ([]StatementEntry, error) {
 		statements = append(statements, doc)
 	}
 	if err := cursor.Err(); err != nil {
-		return nil, err
+		return nil, mongoError("failed to query statements", err)
 	}
 
 	return statements, nil
 }
+
+func (m *MongoManager) Search(ctx context.Context, userID, query string, limit int) ([]SearchHit, error) {
+	if search.Parse(query).Empty() {
+		return nil, nil
+	}
+	limit = searchLimit(limit)
+
+	shared, owned := bson.M{}, bson.M{"userID": userID}
+	var hits []SearchHit
+	for _, find := range []func() ([]SearchHit, error){
+		func() ([]SearchHit, error) {
+			return textSearch(ctx, m, m.statements, shared, query, limit, statementHit)
+		},
+		func() ([]SearchHit, error) { return textSearch(ctx, m, m.snapshots, owned, query, limit, snapshotHit) },
+		func() ([]SearchHit, error) { return textSearch(ctx, m, m.feedbacks, owned, query, limit, feedbackHit) },
+		func() ([]SearchHit, error) { return textSearch(ctx, m, m.summaries, owned, query, limit, summaryHit) },
+	} {
+		found, err := find()
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, found...)
+	}
+	return rankHits(hits, limit), nil
+}
+
+// textSearch runs a $text query against the text index of coll, narrowed by
+// filter, and returns the best limit matches with their text score.
+func textSearch[T any](ctx context.Context, m *MongoManager, coll *mongo.Collection, filter bson.M, query string, limit int, toHit func(T) SearchHit) ([]SearchHit, error) {
+	score := bson.M{"score": bson.M{"$meta": "textScore"}}
+	opts := options.Find().SetProjection(score).SetSort(score).SetLimit(int64(limit))
+	filter["$text"] = bson.M{"$search": query}
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, mongoError("failed to search "+coll.Name(), err)
+	}
+	defer func() {
+		if cerr := cursor.Close(context.Background()); cerr != nil {
+			m.logger.Error().Msgf("failed to close cursor: %v", cerr)
+		}
+	}()
+
+	var hits []SearchHit
+	for cursor.Next(ctx) {
+		var entry T
+		if err := cursor.Decode(&entry); err != nil {
+			return nil, mongoError("failed to decode "+coll.Name(), err)
+		}
+		hit := toHit(entry)
+		hit.Score, _ = cursor.Current.Lookup("score").DoubleOK()
+		hits = append(hits, hit)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, mongoError("failed to search "+coll.Name(), err)
+	}
+	return hits, nil
+}
+
+// findPage runs q against coll, whose documents carry userID, problemID,
+// sessionID and timestamp fields, sorted on the (timestamp, _id) indexes.
+func findPage[T any](ctx context.Context, m *MongoManager, coll *mongo.Collection, q ListQuery, pos func(T) listPos, name string) (Page[T], error) {
+	after, hasCursor, err := q.after()
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	filter := bson.D{}
+	if !q.AllUsers {
+		filter = append(filter, bson.E{Key: "userID", Value: q.UserID})
+	}
+	if q.ProblemID != "" {
+		filter = append(filter, bson.E{Key: "problemID", Value: q.ProblemID})
+	}
+	if q.SessionID != "" {
+		filter = append(filter, bson.E{Key: "sessionID", Value: q.SessionID})
+	}
+	timeRange := bson.D{}
+	if !q.Since.IsZero() {
+		timeRange = append(timeRange, bson.E{Key: "$gte", Value: q.Since})
+	}
+	if !q.Until.IsZero() {
+		timeRange = append(timeRange, bson.E{Key: "$lt", Value: q.Until})
+	}
+	if len(timeRange) > 0 {
+		filter = append(filter, bson.E{Key: "timestamp", Value: timeRange})
+	}
+
+	order, past := 1, "$gt"
+	if q.Descending {
+		order, past = -1, "$lt"
+	}
+	if hasCursor {
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "timestamp", Value: bson.D{{Key: past, Value: after.Timestamp}}}},
+			bson.D{{Key: "timestamp", Value: after.Timestamp}, {Key: "_id", Value: bson.D{{Key: past, Value: after.ID}}}},
+		}})
+	}
+
+	limit := q.limit()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(int64(limit + 1))
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return Page[T]{}, mongoError("failed to query "+name, err)
+	}
+	defer func() {
+		if cerr := cursor.Close(context.Background()); cerr != nil {
+			m.logger.Error().Msgf("failed to close cursor: %v", cerr)
+		}
+	}()
+
+	var items []T
+	if err := cursor.All(ctx, &items); err != nil {
+		return Page[T]{}, mongoError("failed to decode "+name, err)
+	}
+	return newPage(items, limit, pos), nil
+}
+
+// mongoError classifies a driver error, counting server-side timeouts as
+// ErrTimeout like an expired context and unique index violations as
+// ErrDuplicate.
+func mongoError(op string, err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		err = fmt.Errorf("%w: %w", ErrDuplicate, err)
+	}
+	if mongo.IsTimeout(err) && !errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+	return opError(op, err)
+}
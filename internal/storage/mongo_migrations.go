@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrSchemaTooNew is returned when the database was migrated by a newer
+	// coach_demon; running against it could corrupt data.
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+	// ErrSchemaOutdated is returned by CheckSchema when migrations are pending.
+	ErrSchemaOutdated = errors.New("database schema is outdated")
+)
+
+// The schema version is kept in a single document of the meta collection.
+const (
+	metaCollection = "meta"
+	schemaDocID    = "schema"
+)
+
+type schemaDoc struct {
+	ID        string    `bson:"_id"`
+	Version   int       `bson:"version"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// mongoMigration moves the database from Version-1 to Version. Up must be
+// safe to run again after a partial failure, since the version is only
+// recorded once it succeeds.
+type mongoMigration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// mongoMigrations are applied in order. Append new migrations with the next
+// version; never edit or reorder released ones.
+var mongoMigrations = []mongoMigration{
+	{1, "rename legacy problemid fields to problemID", renameProblemIDFields},
+	{2, "drop duplicate statements and summaries", dropDuplicatesByProblem},
+	{3, "create indexes", createIndexes},
+	{4, "version summaries", versionSummaries},
+	{5, "create listing indexes", createListingIndexes},
+	{6, "create text indexes", createTextIndexes},
+	{7, "scope records by user", scopeByUser},
+}
+
+// SchemaVersion is the newest schema this binary knows.
+func SchemaVersion() int {
+	return mongoMigrations[len(mongoMigrations)-1].Version
+}
+
+// SchemaVersion returns the version recorded in the database, 0 when it has
+// never been migrated.
+func (m *MongoManager) SchemaVersion(ctx context.Context) (int, error) {
+	var doc schemaDoc
+	err := m.db.Collection(metaCollection).FindOne(ctx, bson.M{"_id": schemaDocID}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, mongoError("failed to read schema version", err)
+	}
+	return doc.Version, nil
+}
+
+// CheckSchema fails with ErrSchemaTooNew or ErrSchemaOutdated unless the
+// database is at exactly SchemaVersion.
+func (m *MongoManager) CheckSchema(ctx context.Context) error {
+	version, err := m.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version > SchemaVersion():
+		return fmt.Errorf("%w: database is at version %d, this binary supports %d", ErrSchemaTooNew, version, SchemaVersion())
+	case version < SchemaVersion():
+		return fmt.Errorf("%w: database is at version %d, want %d", ErrSchemaOutdated, version, SchemaVersion())
+	}
+	return nil
+}
+
+// Migrate applies every pending migration in order and returns the versions
+// it applied. It refuses to touch a database with a newer schema.
+func (m *MongoManager) Migrate(ctx context.Context) ([]int, error) {
+	version, err := m.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version > SchemaVersion() {
+		return nil, fmt.Errorf("%w: database is at version %d, this binary supports %d", ErrSchemaTooNew, version, SchemaVersion())
+	}
+
+	var applied []int
+	for _, migration := range mongoMigrations {
+		if migration.Version <= version {
+			continue
+		}
+		m.logger.Info().Int("version", migration.Version).Msgf("applying migration: %s", migration.Description)
+		if err := migration.Up(ctx, m.db); err != nil {
+			return applied, mongoError(fmt.Sprintf("migration %d (%s) failed", migration.Version, migration.Description), err)
+		}
+		if err := m.setSchemaVersion(ctx, migration.Version); err != nil {
+			return applied, err
+		}
+		applied = append(applied, migration.Version)
+	}
+	return applied, nil
+}
+
+func (m *MongoManager) setSchemaVersion(ctx context.Context, version int) error {
+	doc := schemaDoc{ID: schemaDocID, Version: version, UpdatedAt: time.Now().UTC()}
+	_, err := m.db.Collection(metaCollection).ReplaceOne(ctx, bson.M{"_id": schemaDocID}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return mongoError("failed to record schema version", err)
+	}
+	return nil
+}
+
+// renameProblemIDFields moves documents written under the driver's default
+// lower-case field name to the problemID the structs use, and drops the
+// unique indexes that were created on the old name.
+func renameProblemIDFields(ctx context.Context, db *mongo.Database) error {
+	for _, name := range []string{"feedbacks", "summaries", "statements"} {
+		coll := db.Collection(name)
+		filter := bson.M{"problemid": bson.M{"$exists": true}, "problemID": bson.M{"$exists": false}}
+		if _, err := coll.UpdateMany(ctx, filter, bson.M{"$rename": bson.M{"problemid": "problemID"}}); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := dropIndexIfExists(ctx, coll, "problemid_1"); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// dropDuplicatesByProblem keeps the first statement and summary stored for a
+// problem, so the unique indexes can be built.
+func dropDuplicatesByProblem(ctx context.Context, db *mongo.Database) error {
+	for _, name := range []string{"summaries", "statements"} {
+		coll := db.Collection(name)
+		cursor, err := coll.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+			{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$problemID"},
+				{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			}}},
+			{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		var groups []struct {
+			IDs []any `bson:"ids"`
+		}
+		if err := cursor.All(ctx, &groups); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, group := range groups {
+			if _, err := coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}}); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func createIndexes(ctx context.Context, db *mongo.Database) error {
+	unique := options.Index().SetUnique(true)
+	indexes := map[string][]mongo.IndexModel{
+		"statements": {{Keys: bson.D{{Key: "problemID", Value: 1}}, Options: unique}},
+		"summaries":  {{Keys: bson.D{{Key: "problemID", Value: 1}}, Options: unique}},
+		"snapshots":  {{Keys: bson.D{{Key: "problemID", Value: 1}, {Key: "seq", Value: 1}}, Options: unique}},
+		"sessions": {
+			{Keys: bson.D{{Key: "token", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "problemID", Value: 1}, {Key: "startedAt", Value: -1}}},
+		},
+		"feedbacks": {{Keys: bson.D{{Key: "problemID", Value: 1}, {Key: "timestamp", Value: -1}}}},
+		"hints":     {{Keys: bson.D{{Key: "problemID", Value: 1}, {Key: "timestamp", Value: 1}}}},
+	}
+	for name, models := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func dropIndexIfExists(ctx context.Context, coll *mongo.Collection, index string) error {
+	names, err := coll.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(names, func(spec *mongo.IndexSpecification) bool { return spec.Name == index }) {
+		return nil
+	}
+	_, err = coll.Indexes().DropOne(ctx, index)
+	return err
+}
+
+// versionSummaries turns the single summary per problem into version 1 of
+// its history, dated by the creation time of its ObjectID, and replaces the
+// unique problem index with a unique (problem, version) one.
+func versionSummaries(ctx context.Context, db *mongo.Database) error {
+	coll := db.Collection("summaries")
+	_, err := coll.UpdateMany(ctx, bson.M{"version": bson.M{"$exists": false}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "version", Value: 1},
+			{Key: "timestamp", Value: bson.D{{Key: "$toDate", Value: "$_id"}}},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	if err := dropIndexIfExists(ctx, coll, "problemID_1"); err != nil {
+		return err
+	}
+	_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "problemID", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// createListingIndexes backs ListFeedback and ListSnapshots, which sort by
+// (timestamp, _id) within a problem or a session.
+func createListingIndexes(ctx context.Context, db *mongo.Database) error {
+	for _, name := range []string{"feedbacks", "snapshots"} {
+		_, err := db.Collection(name).Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: bson.D{{Key: "problemID", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}},
+			{Keys: bson.D{{Key: "sessionID", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}},
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// createTextIndexes backs Search. A collection can have only one text index,
+// so it covers every searchable field. Statements are indexed by their text
+// without markup, which is stored alongside them first.
+func createTextIndexes(ctx context.Context, db *mongo.Database) error {
+	if err := storeStatementText(ctx, db.Collection("statements")); err != nil {
+		return fmt.Errorf("statements: %w", err)
+	}
+	indexes := map[string]bson.D{
+		"statements": {{Key: "text", Value: "text"}},
+		"snapshots":  {{Key: "thoughts", Value: "text"}},
+		"feedbacks":  {{Key: "feedback", Value: "text"}, {Key: "proofs", Value: "text"}, {Key: "optimalMetaCognition", Value: "text"}},
+		"summaries":  {{Key: "feedback", Value: "text"}, {Key: "proof", Value: "text"}, {Key: "optimalMetaCognition", Value: "text"}},
+	}
+	for name, keys := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys}); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// storeStatementText sets the text field SaveStatement writes on the
+// statements stored before it did.
+func storeStatementText(ctx context.Context, coll *mongo.Collection) error {
+	cursor, err := coll.Find(ctx, bson.M{"text": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	var docs []struct {
+		ID        any    `bson:"_id"`
+		Statement string `bson:"statement"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		_, err := coll.UpdateByID(ctx, doc.ID, bson.M{"$set": bson.M{"text": statementText(doc.Statement)}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scopeByUser records the empty user on the documents from before users were
+// recorded, so they match queries for anonymous records, and makes snapshot
+// seqs and summary versions unique per user rather than per problem.
+func scopeByUser(ctx context.Context, db *mongo.Database) error {
+	for _, name := range []string{"sessions", "snapshots", "feedbacks", "hints", "summaries"} {
+		_, err := db.Collection(name).UpdateMany(ctx, bson.M{"userID": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"userID": ""}})
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	unique := options.Index().SetUnique(true)
+	for name, number := range map[string]string{"snapshots": "seq", "summaries": "version"} {
+		coll := db.Collection(name)
+		if err := dropIndexIfExists(ctx, coll, "problemID_1_"+number+"_1"); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "problemID", Value: 1}, {Key: number, Value: 1}},
+			Options: unique,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	indexes := map[string][]mongo.IndexModel{
+		"sessions":  {{Keys: bson.D{{Key: "userID", Value: 1}, {Key: "problemID", Value: 1}, {Key: "startedAt", Value: -1}}}},
+		"hints":     {{Keys: bson.D{{Key: "userID", Value: 1}, {Key: "problemID", Value: 1}, {Key: "timestamp", Value: 1}}}},
+		"feedbacks": {{Keys: bson.D{{Key: "userID", Value: 1}, {Key: "problemID", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}}},
+		"snapshots": {{Keys: bson.D{{Key: "userID", Value: 1}, {Key: "problemID", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}}},
+	}
+	for name, models := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package storage
+
+import "testing"
+
+func TestMongoMigrationsAreConsecutive(t *testing.T) {
+	for i, migration := range mongoMigrations {
+		if migration.Version != i+1 {
+			t.Fatalf("migration %q has version %d, want %d", migration.Description, migration.Version, i+1)
+		}
+		if migration.Up == nil {
+			t.Fatalf("migration %d has no Up", migration.Version)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package storage
+
+import "time"
+
+// Redaction helpers of the stores that rewrite records themselves. Each
+// clears the code of a record and reports whether there was any.
+
+func redactSnapshot(s *Snapshot) bool {
+	changed := s.Code != ""
+	s.Code = ""
+	for i := range s.Files {
+		changed = changed || s.Files[i].Content != ""
+		s.Files[i].Content = ""
+	}
+	return changed
+}
+
+func redactFeedback(f *FeedbackEntry) bool {
+	changed := f.Code != ""
+	f.Code = ""
+	return changed
+}
+
+func redactHint(h *HintEntry) bool {
+	changed := h.Code != ""
+	h.Code = ""
+	return changed
+}
+
+// inRedaction reports whether a record belongs to a RedactSessionCode call.
+func inRedaction(userID, sessionID string, ts time.Time, wantSession string, before time.Time) bool {
+	return sessionID == wantSession && (wantSession != "" || userID == "") && ts.Before(before)
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"cmp"
+	"coach_demon/internal/search"
+	"coach_demon/pkg/codeforces"
+	"slices"
+	"time"
+)
+
+// Kinds of searchable records.
+const (
+	SearchStatement = "statement"
+	SearchSnapshot  = "snapshot"
+	SearchFeedback  = "feedback"
+	SearchSummary   = "summary"
+)
+
+// SearchHit is a record matching a search, with the text of its searchable
+// fields keyed by name ("statement", "thoughts", "feedback", "proof" or
+// "optimalMetaCognition"). ID is the problem ID for statements.
+type SearchHit struct {
+	Kind      string
+	ID        string
+	ProblemID string
+	Timestamp time.Time
+	Score     float64
+	Fields    map[string]string
+}
+
+func statementHit(s StatementEntry) SearchHit {
+	return SearchHit{Kind: SearchStatement, ID: s.ProblemID, ProblemID: s.ProblemID, Fields: nonEmpty(
+		"statement", statementText(s.Statement),
+	)}
+}
+
+// statementText is a statement as searched and shown in snippets. Fetched
+// statements are HTML, whose tags and attributes would otherwise match
+// queries and fill snippets, so they are condensed to Markdown.
+func statementText(statement string) string {
+	text, err := codeforces.StatementMarkdown(statement)
+	if err != nil {
+		return statement
+	}
+	return text
+}
+
+func snapshotHit(s Snapshot) SearchHit {
+	return SearchHit{Kind: SearchSnapshot, ID: s.ID, ProblemID: s.ProblemID, Timestamp: s.Timestamp, Fields: nonEmpty(
+		"thoughts", s.Thoughts,
+	)}
+}
+
+func feedbackHit(f FeedbackEntry) SearchHit {
+	return SearchHit{Kind: SearchFeedback, ID: f.ID, ProblemID: f.ProblemID, Timestamp: f.Timestamp, Fields: nonEmpty(
+		"feedback", f.Feedback,
+		"proof", f.Proof,
+		"optimalMetaCognition", f.OptimalMetaCognition,
+	)}
+}
+
+func summaryHit(s Summary) SearchHit {
+	return SearchHit{Kind: SearchSummary, ID: s.ID, ProblemID: s.ProblemID, Timestamp: s.Timestamp, Fields: nonEmpty(
+		"feedback", s.Feedback,
+		"proof", s.Proof,
+		"optimalMetaCognition", s.OptimalMetaCognition,
+	)}
+}
+
+func nonEmpty(pairs ...string) map[string]string {
+	fields := make(map[string]string)
+	for i := 0; i < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			fields[pairs[i]] = pairs[i+1]
+		}
+	}
+	return fields
+}
+
+// searcher scores records for the stores without a text index.
+type searcher struct {
+	q    search.Query
+	hits []SearchHit
+}
+
+func newSearcher(query string) *searcher {
+	return &searcher{q: search.Parse(query)}
+}
+
+func (s *searcher) add(hit SearchHit) {
+	texts := make([]string, 0, len(hit.Fields))
+	for _, text := range hit.Fields {
+		texts = append(texts, text)
+	}
+	if hit.Score = s.q.Score(texts...); hit.Score > 0 {
+		s.hits = append(s.hits, hit)
+	}
+}
+
+// best returns the limit best hits, best first.
+func (s *searcher) best(limit int) []SearchHit {
+	return rankHits(s.hits, limit)
+}
+
+func rankHits(hits []SearchHit, limit int) []SearchHit {
+	slices.SortStableFunc(hits, func(a, b SearchHit) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), b.Timestamp.Compare(a.Timestamp))
+	})
+	return hits[:min(len(hits), searchLimit(limit))]
+}
+
+func searchLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return DefaultListLimit
+	case limit > MaxListLimit:
+		return MaxListLimit
+	}
+	return limit
+}
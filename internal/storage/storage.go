@@ -1,8 +1,76 @@
 package storage
 
-import "time"
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ClientInfo identifies the editor that opened a session.
+type ClientInfo struct {
+	Name       string `bson:"name,omitempty"`
+	Version    string `bson:"version,omitempty"`
+	RemoteAddr string `bson:"remoteAddr,omitempty"`
+}
+
+// Session is one attempt at a problem, from the first snapshot until it is
+// ended explicitly or goes idle. Token lets a reconnecting editor resume it.
+type Session struct {
+	ID         string     `bson:"_id"`
+	Token      string     `bson:"token" json:"-"`
+	UserID     string     `bson:"userID"`
+	ProblemID  string     `bson:"problemID"`
+	StartedAt  time.Time  `bson:"startedAt"`
+	LastSeenAt time.Time  `bson:"lastSeenAt"`
+	EndedAt    *time.Time `bson:"endedAt,omitempty"`
+	EndReason  string     `bson:"endReason,omitempty"`
+	Client     ClientInfo `bson:"client"`
+}
+
+// Session end reasons.
+const (
+	SessionEndExplicit = "explicit"
+	SessionEndIdle     = "idle"
+)
+
+// SnapshotFile is one source file of a snapshot.
+type SnapshotFile struct {
+	Path     string `bson:"path,omitempty"`
+	Language string `bson:"language,omitempty"`
+	Content  string `bson:"content"`
+}
+
+// Cursor is the caret position in a snapshot, 1-based.
+type Cursor struct {
+	Path   string `bson:"path,omitempty"`
+	Line   int    `bson:"line"`
+	Column int    `bson:"column"`
+}
+
+// Snapshot is one editor state as received over the WebSocket. Seq numbers
+// the snapshots of a user's problem in arrival order, starting at 1. Editors
+// that send a single code string fill Code; multi-file editors fill Files.
+type Snapshot struct {
+	ID        string         `bson:"_id"`
+	UserID    string         `bson:"userID"`
+	SessionID string         `bson:"sessionID,omitempty"`
+	ProblemID string         `bson:"problemID"`
+	Seq       int64          `bson:"seq"`
+	Timestamp time.Time      `bson:"timestamp"`
+	Code      string         `bson:"code,omitempty"`
+	Language  string         `bson:"language,omitempty"`
+	Files     []SnapshotFile `bson:"files,omitempty"`
+	Cursor    *Cursor        `bson:"cursor,omitempty"`
+	Thoughts  string         `bson:"thoughts,omitempty"`
+}
 
 type FeedbackEntry struct {
+	ID                   string    `bson:"_id,omitempty"`
+	UserID               string    `bson:"userID"`
+	SessionID            string    `bson:"sessionID,omitempty"`
+	SnapshotID           string    `bson:"snapshotID,omitempty"` // snapshot the feedback was generated from
 	ProblemID            string    `bson:"problemID"`
 	Timestamp            time.Time `bson:"timestamp"`
 	Code                 string    `bson:"code,omitempty"`
@@ -12,11 +80,49 @@ type FeedbackEntry struct {
 	OptimalMetaCognition string    `bson:"optimalMetaCognition,omitempty"`
 }
 
+// HintEntry is a hint the user explicitly asked for. Level is one of
+// "nudge", "observation", "outline" or "proof".
+type HintEntry struct {
+	ID          string    `bson:"_id"`
+	UserID      string    `bson:"userID"`
+	SessionID   string    `bson:"sessionID,omitempty"`
+	ProblemID   string    `bson:"problemID"`
+	Level       string    `bson:"level"`
+	Timestamp   time.Time `bson:"timestamp"`
+	Code        string    `bson:"code,omitempty"`
+	Thoughts    string    `bson:"thoughts,omitempty"`
+	Hint        string    `bson:"hint"`
+	Observation string    `bson:"observation,omitempty"`
+	Outline     string    `bson:"outline,omitempty"`
+	Proof       string    `bson:"proof,omitempty"`
+	Complexity  string    `bson:"complexity,omitempty"`
+}
+
+// Summary is one version of the AI summary of a user's attempts at a
+// problem. Every regeneration stores a new version; Version numbers them per
+// user and problem, starting at 1.
 type Summary struct {
-	ProblemID            string `bson:"problemID"`
-	Feedback             string `bson:"feedback"`
-	Proof                string `bson:"proof"`
-	OptimalMetaCognition string `bson:"optimalMetaCognition"`
+	ID                   string    `bson:"_id"`
+	UserID               string    `bson:"userID"`
+	ProblemID            string    `bson:"problemID"`
+	Version              int64     `bson:"version"`
+	Timestamp            time.Time `bson:"timestamp"`
+	Feedback             string    `bson:"feedback"`
+	Proof                string    `bson:"proof"`
+	OptimalMetaCognition string    `bson:"optimalMetaCognition"`
+	// HintsUsed counts the hints asked for per level.
+	HintsUsed map[string]int `bson:"hintsUsed,omitempty"`
+	// FeedbackIDs lists the feedback entries the summary was generated from.
+	FeedbackIDs []string `bson:"feedbackIDs,omitempty"`
+}
+
+// Covers reports whether the summary was generated with entry. Summaries
+// from before FeedbackIDs was recorded cover everything up to their time.
+func (s Summary) Covers(entry FeedbackEntry) bool {
+	if len(s.FeedbackIDs) == 0 {
+		return !entry.Timestamp.After(s.Timestamp)
+	}
+	return slices.Contains(s.FeedbackIDs, entry.ID)
 }
 
 type StatementEntry struct {
@@ -24,15 +130,75 @@ type StatementEntry struct {
 	Statement string `bson:"statement"`
 }
 
+// NewID returns a fresh identifier for stored records.
+func NewID() string {
+	return uuid.New().String()
+}
+
+// Storage persists everything the coach records. Every method honours the
+// deadline and cancellation of ctx. Getters of a single record return
+// ErrNotFound when it does not exist and inserts of a taken key ErrDuplicate;
+// other failures match ErrTimeout, context.Canceled or ErrBackend.
+//
+// Statements are shared; every other record belongs to the user in its
+// UserID, which is empty for anonymous editors and for records made before
+// users were recorded. Queries by problem return the records of one user.
 type Storage interface {
-	SaveFeedback(entry FeedbackEntry) error
-	GetAllFeedbacksByProblemID(problemID string) ([]FeedbackEntry, error)
-	GetLatestFeedback(problemID string) (*FeedbackEntry, error)
+	// CreateSession stores entry, assigning ID and Token when they are empty,
+	// and returns the stored record.
+	CreateSession(ctx context.Context, entry Session) (*Session, error)
+	GetSession(ctx context.Context, id string) (*Session, error)
+	GetSessionByToken(ctx context.Context, token string) (*Session, error)
+	GetSessionsByProblemID(ctx context.Context, userID, problemID string) ([]Session, error)
+	TouchSession(ctx context.Context, id string, at time.Time) error
+	EndSession(ctx context.Context, id string, at time.Time, reason string) error
+	// EndIdleSessions ends every open session last seen before idleSince and
+	// returns how many were ended.
+	EndIdleSessions(ctx context.Context, idleSince, at time.Time) (int, error)
+
+	// SaveSnapshot stores entry, assigning ID and Seq when they are empty,
+	// and returns the stored record.
+	SaveSnapshot(ctx context.Context, entry Snapshot) (*Snapshot, error)
+	GetSnapshot(ctx context.Context, id string) (*Snapshot, error)
+	GetSnapshotsByProblemID(ctx context.Context, userID, problemID string) ([]Snapshot, error)
+	GetLatestSnapshot(ctx context.Context, userID, problemID string) (*Snapshot, error)
+	// ListSnapshots returns one page of the snapshots selected by q. A
+	// malformed cursor fails with ErrBadCursor.
+	ListSnapshots(ctx context.Context, q ListQuery) (Page[Snapshot], error)
+	// DeleteSnapshots removes the snapshots with the given IDs and returns
+	// how many of them existed.
+	DeleteSnapshots(ctx context.Context, ids []string) (int, error)
+
+	SaveFeedback(ctx context.Context, entry FeedbackEntry) error
+	GetAllFeedbacksByProblemID(ctx context.Context, userID, problemID string) ([]FeedbackEntry, error)
+	GetLatestFeedback(ctx context.Context, userID, problemID string) (*FeedbackEntry, error)
+	// ListFeedback returns one page of the feedback selected by q. A
+	// malformed cursor fails with ErrBadCursor.
+	ListFeedback(ctx context.Context, q ListQuery) (Page[FeedbackEntry], error)
+
+	SaveHint(ctx context.Context, entry HintEntry) error
+	GetHintsByProblemID(ctx context.Context, userID, problemID string) ([]HintEntry, error)
+
+	// RedactSessionCode clears the code of the snapshots, feedback and hints
+	// recorded in a session before the given time and returns how many
+	// records had any. An empty sessionID selects the anonymous records made
+	// outside any session.
+	RedactSessionCode(ctx context.Context, sessionID string, before time.Time) (int, error)
+
+	GetStatement(ctx context.Context, problemID string) (*StatementEntry, error)
+	SaveStatement(ctx context.Context, entry StatementEntry) error
+	GetAllStatements(ctx context.Context) ([]StatementEntry, error)
 
-	GetStatement(problemID string) (*StatementEntry, error)
-	SaveStatement(entry StatementEntry) error
-	GetAllStatements() ([]StatementEntry, error)
+	// Search returns the statements, and the snapshot thoughts, feedback and
+	// summaries of userID, matching query, best first and at most limit of
+	// them. See package search for the query syntax.
+	Search(ctx context.Context, userID, query string, limit int) ([]SearchHit, error)
 
-	GetSummaryByProblemID(problemID string) (*Summary, error)
-	SaveSummary(summary Summary) error
+	// GetSummaryByProblemID returns the latest summary version.
+	GetSummaryByProblemID(ctx context.Context, userID, problemID string) (*Summary, error)
+	// GetSummaryHistory returns every summary version, newest first.
+	GetSummaryHistory(ctx context.Context, userID, problemID string) ([]Summary, error)
+	// SaveSummary stores summary as a new version, assigning ID and Version
+	// when they are empty, and returns the stored record.
+	SaveSummary(ctx context.Context, summary Summary) (*Summary, error)
 }
@@ -0,0 +1,797 @@
+// Package storagetest is a conformance suite that every storage.Storage
+// implementation must pass.
+package storagetest
+
+import (
+	"coach_demon/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Run runs the suite. newStore must return an empty store for every call.
+func Run(t *testing.T, newStore func(t *testing.T) storage.Storage) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"StatementNotFound", testStatementNotFound},
+		{"StatementDuplicateKeepsFirst", testStatementDuplicateKeepsFirst},
+		{"AllStatements", testAllStatements},
+		{"FeedbackLatestByTimestamp", testFeedbackLatestByTimestamp},
+		{"FeedbackByProblem", testFeedbackByProblem},
+		{"FeedbackDuplicateID", testFeedbackDuplicateID},
+		{"ListFeedback", testListFeedback},
+		{"ListFeedbackBadCursor", testListFeedbackBadCursor},
+		{"ListSnapshots", testListSnapshots},
+		{"DeleteSnapshots", testDeleteSnapshots},
+		{"RedactSessionCode", testRedactSessionCode},
+		{"SummaryVersions", testSummaryVersions},
+		{"SummaryDuplicateID", testSummaryDuplicateID},
+		{"Search", testSearch},
+		{"SnapshotSeq", testSnapshotSeq},
+		{"SnapshotRoundTrip", testSnapshotRoundTrip},
+		{"SessionLifecycle", testSessionLifecycle},
+		{"SessionsByProblem", testSessionsByProblem},
+		{"EndIdleSessions", testEndIdleSessions},
+		{"HintsByProblem", testHintsByProblem},
+		{"UserIsolation", testUserIsolation},
+		{"CanceledContext", testCanceledContext},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func wantNotFound(t *testing.T, call string, err error) {
+	t.Helper()
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("%s returned %v, want ErrNotFound", call, err)
+	}
+}
+
+func wantDuplicate(t *testing.T, call string, err error) {
+	t.Helper()
+	if !errors.Is(err, storage.ErrDuplicate) {
+		t.Fatalf("%s returned %v, want ErrDuplicate", call, err)
+	}
+}
+
+// base is a fixed, millisecond-aligned time; Mongo stores milliseconds only.
+var base = time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func testStatementNotFound(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	_, err := s.GetStatement(ctx, "1A")
+	wantNotFound(t, "GetStatement on empty store", err)
+}
+
+func testStatementDuplicateKeepsFirst(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	must(t, s.SaveStatement(ctx, storage.StatementEntry{ProblemID: "1A", Statement: "first"}))
+	if err := s.SaveStatement(ctx, storage.StatementEntry{ProblemID: "1A", Statement: "second"}); err != nil {
+		t.Fatalf("duplicate SaveStatement returned %v, want nil", err)
+	}
+
+	got, err := s.GetStatement(ctx, "1A")
+	must(t, err)
+	if got == nil || got.Statement != "first" {
+		t.Fatalf("GetStatement = %+v, want the first statement", got)
+	}
+}
+
+func testAllStatements(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	must(t, s.SaveStatement(ctx, storage.StatementEntry{ProblemID: "1A", Statement: "a"}))
+	must(t, s.SaveStatement(ctx, storage.StatementEntry{ProblemID: "2B", Statement: "b"}))
+
+	got, err := s.GetAllStatements(ctx)
+	must(t, err)
+	if len(got) != 2 {
+		t.Fatalf("GetAllStatements returned %d statements, want 2", len(got))
+	}
+}
+
+func testFeedbackLatestByTimestamp(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	_, err := s.GetLatestFeedback(ctx, "", "1A")
+	wantNotFound(t, "GetLatestFeedback on empty store", err)
+
+	// Inserted out of order: the latest is chosen by timestamp, not insertion.
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ProblemID: "1A", Timestamp: base.Add(2 * time.Minute), Feedback: "newest"}))
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ProblemID: "1A", Timestamp: base, Feedback: "oldest"}))
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ProblemID: "2B", Timestamp: base.Add(time.Hour), Feedback: "other problem"}))
+
+	got, err := s.GetLatestFeedback(ctx, "", "1A")
+	must(t, err)
+	if got == nil || got.Feedback != "newest" {
+		t.Fatalf("GetLatestFeedback = %+v, want the newest entry", got)
+	}
+	if got.ID == "" {
+		t.Fatal("saved feedback has no ID")
+	}
+}
+
+func testFeedbackByProblem(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ProblemID: "1A", Timestamp: base, Feedback: "a1"}))
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ProblemID: "1A", Timestamp: base.Add(time.Minute), Feedback: "a2"}))
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ProblemID: "2B", Timestamp: base, Feedback: "b1"}))
+
+	got, err := s.GetAllFeedbacksByProblemID(ctx, "", "1A")
+	must(t, err)
+	if len(got) != 2 {
+		t.Fatalf("GetAllFeedbacksByProblemID returned %d entries, want 2", len(got))
+	}
+	for _, f := range got {
+		if f.ProblemID != "1A" {
+			t.Fatalf("entry of problem %s returned for 1A", f.ProblemID)
+		}
+	}
+
+	got, err = s.GetAllFeedbacksByProblemID(ctx, "", "3C")
+	must(t, err)
+	if len(got) != 0 {
+		t.Fatalf("GetAllFeedbacksByProblemID for unknown problem returned %d entries", len(got))
+	}
+}
+
+func testFeedbackDuplicateID(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	entry := storage.FeedbackEntry{ID: storage.NewID(), ProblemID: "1A", Timestamp: base}
+	must(t, s.SaveFeedback(ctx, entry))
+	err := s.SaveFeedback(ctx, entry)
+	wantDuplicate(t, "saving feedback with a duplicate ID", err)
+}
+
+func testListFeedback(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	// Five entries of 1A, the last two sharing a timestamp, in two sessions.
+	for i, id := range []string{"f1", "f2", "f3", "f5", "f4"} {
+		ts := base.Add(time.Duration(min(i, 3)) * time.Minute)
+		session := "s1"
+		if i%2 == 1 {
+			session = "s2"
+		}
+		must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ID: id, ProblemID: "1A", SessionID: session, Timestamp: ts}))
+	}
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ID: "other", ProblemID: "2B", SessionID: "s1", Timestamp: base}))
+
+	all := listAll(t, func(cursor string) (storage.Page[storage.FeedbackEntry], error) {
+		return s.ListFeedback(ctx, storage.ListQuery{ProblemID: "1A", Limit: 2, Cursor: cursor})
+	}, func(f storage.FeedbackEntry) string { return f.ID })
+	wantIDs(t, "ascending", all, "f1", "f2", "f3", "f4", "f5")
+
+	desc := listAll(t, func(cursor string) (storage.Page[storage.FeedbackEntry], error) {
+		return s.ListFeedback(ctx, storage.ListQuery{ProblemID: "1A", Descending: true, Limit: 2, Cursor: cursor})
+	}, func(f storage.FeedbackEntry) string { return f.ID })
+	wantIDs(t, "descending", desc, "f5", "f4", "f3", "f2", "f1")
+
+	page, err := s.ListFeedback(ctx, storage.ListQuery{
+		ProblemID: "1A",
+		Since:     base.Add(time.Minute),
+		Until:     base.Add(3 * time.Minute),
+	})
+	must(t, err)
+	wantIDs(t, "time range", ids(page.Items, func(f storage.FeedbackEntry) string { return f.ID }), "f2", "f3")
+	if page.NextCursor != "" {
+		t.Fatalf("last page has NextCursor %q", page.NextCursor)
+	}
+
+	page, err = s.ListFeedback(ctx, storage.ListQuery{SessionID: "s1"})
+	must(t, err)
+	wantIDs(t, "session", ids(page.Items, func(f storage.FeedbackEntry) string { return f.ID }), "f1", "other", "f3", "f4")
+
+	page, err = s.ListFeedback(ctx, storage.ListQuery{ProblemID: "3C"})
+	must(t, err)
+	if len(page.Items) != 0 || page.NextCursor != "" {
+		t.Fatalf("ListFeedback of an unknown problem = %+v, want an empty page", page)
+	}
+}
+
+func testListFeedbackBadCursor(t *testing.T, s storage.Storage) {
+	_, err := s.ListFeedback(t.Context(), storage.ListQuery{ProblemID: "1A", Cursor: "not a cursor"})
+	if !errors.Is(err, storage.ErrBadCursor) {
+		t.Fatalf("ListFeedback with a bad cursor returned %v, want ErrBadCursor", err)
+	}
+}
+
+func testListSnapshots(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	for i := range 5 {
+		session := "s1"
+		if i >= 3 {
+			session = "s2"
+		}
+		_, err := s.SaveSnapshot(ctx, storage.Snapshot{
+			ID:        fmt.Sprintf("snap%d", i+1),
+			ProblemID: "1A",
+			SessionID: session,
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+		})
+		must(t, err)
+	}
+
+	desc := listAll(t, func(cursor string) (storage.Page[storage.Snapshot], error) {
+		return s.ListSnapshots(ctx, storage.ListQuery{ProblemID: "1A", Descending: true, Limit: 3, Cursor: cursor})
+	}, func(s storage.Snapshot) string { return s.ID })
+	wantIDs(t, "descending", desc, "snap5", "snap4", "snap3", "snap2", "snap1")
+
+	page, err := s.ListSnapshots(ctx, storage.ListQuery{SessionID: "s2"})
+	must(t, err)
+	wantIDs(t, "session", ids(page.Items, func(s storage.Snapshot) string { return s.ID }), "snap4", "snap5")
+}
+
+func testDeleteSnapshots(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	var saved []*storage.Snapshot
+	for i := range 3 {
+		snapshot, err := s.SaveSnapshot(ctx, storage.Snapshot{ProblemID: "1A", Timestamp: base.Add(time.Duration(i) * time.Second)})
+		must(t, err)
+		saved = append(saved, snapshot)
+	}
+
+	n, err := s.DeleteSnapshots(ctx, []string{saved[0].ID, saved[1].ID, "missing"})
+	must(t, err)
+	if n != 2 {
+		t.Fatalf("DeleteSnapshots = %d, want 2", n)
+	}
+	_, err = s.GetSnapshot(ctx, saved[0].ID)
+	wantNotFound(t, "GetSnapshot of a deleted snapshot", err)
+
+	all, err := s.GetSnapshotsByProblemID(ctx, "", "1A")
+	must(t, err)
+	if len(all) != 1 || all[0].ID != saved[2].ID {
+		t.Fatalf("GetSnapshotsByProblemID after delete = %+v, want only the last snapshot", all)
+	}
+	next, err := s.SaveSnapshot(ctx, storage.Snapshot{ProblemID: "1A", Timestamp: base.Add(time.Minute)})
+	must(t, err)
+	if next.Seq != 4 {
+		t.Fatalf("seq after delete = %d, want 4", next.Seq)
+	}
+}
+
+func testRedactSessionCode(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+	cutoff := base.Add(time.Hour)
+
+	old, err := s.SaveSnapshot(ctx, storage.Snapshot{
+		ProblemID: "1A", SessionID: "anon", Timestamp: base, Thoughts: "kept",
+		Files: []storage.SnapshotFile{{Path: "main.cpp", Content: "int main() {}"}},
+	})
+	must(t, err)
+	recent, err := s.SaveSnapshot(ctx, storage.Snapshot{ProblemID: "1A", SessionID: "anon", Timestamp: cutoff, Code: "recent"})
+	must(t, err)
+	other, err := s.SaveSnapshot(ctx, storage.Snapshot{ProblemID: "1A", SessionID: "alice", Timestamp: base, Code: "alice"})
+	must(t, err)
+	loose, err := s.SaveSnapshot(ctx, storage.Snapshot{ProblemID: "1A", Timestamp: base, Code: "no session"})
+	must(t, err)
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ID: "f1", ProblemID: "1A", SessionID: "anon", Timestamp: base, Code: "code", Feedback: "kept"}))
+	must(t, s.SaveHint(ctx, storage.HintEntry{ID: "h1", ProblemID: "1A", SessionID: "anon", Timestamp: base, Code: "code", Hint: "kept"}))
+
+	n, err := s.RedactSessionCode(ctx, "anon", cutoff)
+	must(t, err)
+	if n != 3 {
+		t.Fatalf("RedactSessionCode = %d, want 3", n)
+	}
+	n, err = s.RedactSessionCode(ctx, "anon", cutoff)
+	must(t, err)
+	if n != 0 {
+		t.Fatalf("second RedactSessionCode = %d, want 0", n)
+	}
+
+	got, err := s.GetSnapshot(ctx, old.ID)
+	must(t, err)
+	if got.Code != "" || len(got.Files) != 1 || got.Files[0].Content != "" || got.Files[0].Path != "main.cpp" || got.Thoughts != "kept" {
+		t.Fatalf("redacted snapshot = %+v, want code cleared and the rest kept", got)
+	}
+	for _, id := range []string{recent.ID, other.ID, loose.ID} {
+		got, err := s.GetSnapshot(ctx, id)
+		must(t, err)
+		if got.Code == "" {
+			t.Fatalf("snapshot %s outside the redaction lost its code", id)
+		}
+	}
+	feedback, err := s.GetLatestFeedback(ctx, "", "1A")
+	must(t, err)
+	if feedback.Code != "" || feedback.Feedback != "kept" {
+		t.Fatalf("redacted feedback = %+v", feedback)
+	}
+	hints, err := s.GetHintsByProblemID(ctx, "", "1A")
+	must(t, err)
+	if len(hints) != 1 || hints[0].Code != "" || hints[0].Hint != "kept" {
+		t.Fatalf("redacted hints = %+v", hints)
+	}
+
+	n, err = s.RedactSessionCode(ctx, "", cutoff)
+	must(t, err)
+	if n != 1 {
+		t.Fatalf("RedactSessionCode outside sessions = %d, want 1", n)
+	}
+}
+
+func testSearch(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	must(t, s.SaveStatement(ctx, storage.StatementEntry{ProblemID: "1A", Statement: "Schedule the jobs to minimize the total penalty."}))
+	must(t, s.SaveStatement(ctx, storage.StatementEntry{ProblemID: "2B", Statement: "Count the paths in a grid."}))
+	must(t, s.SaveStatement(ctx, storage.StatementEntry{ProblemID: "3C", Statement: `<div class="problem-statement"><div class="header"><div class="title">C. Tiles</div></div><div><p>Cover the <b>board</b> with dominoes.</p></div></div>`}))
+	_, err := s.SaveSnapshot(ctx, storage.Snapshot{ID: "snap", ProblemID: "1A", Timestamp: base, Thoughts: "maybe sort the jobs by deadline"})
+	must(t, err)
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ID: "fb", ProblemID: "1A", Timestamp: base, Feedback: "Prove it with an exchange argument."}))
+	must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ID: "proof", ProblemID: "2B", Timestamp: base, Proof: "No exchange is needed, use dynamic programming."}))
+	_, err = s.SaveSummary(ctx, storage.Summary{ProblemID: "1A", Timestamp: base, OptimalMetaCognition: "Look for an exchange argument early."})
+	must(t, err)
+
+	search := func(query string) []string {
+		t.Helper()
+		hits, err := s.Search(ctx, "", query, 0)
+		must(t, err)
+		var found []string
+		for _, hit := range hits {
+			if hit.Score <= 0 || len(hit.Fields) == 0 {
+				t.Fatalf("Search(%q) hit %+v has no score or fields", query, hit)
+			}
+			found = append(found, hit.Kind+" "+hit.ProblemID)
+		}
+		slices.Sort(found)
+		return found
+	}
+
+	if got, want := search("exchange"), []string{"feedback 1A", "feedback 2B", "summary 1A"}; !slices.Equal(got, want) {
+		t.Fatalf("Search(exchange) = %v, want %v", got, want)
+	}
+	if got, want := search(`"exchange argument"`), []string{"feedback 1A", "summary 1A"}; !slices.Equal(got, want) {
+		t.Fatalf("Search of a phrase = %v, want %v", got, want)
+	}
+	if got, want := search("exchange -dynamic"), []string{"feedback 1A", "summary 1A"}; !slices.Equal(got, want) {
+		t.Fatalf("Search with an excluded word = %v, want %v", got, want)
+	}
+	if got, want := search("jobs"), []string{"snapshot 1A", "statement 1A"}; !slices.Equal(got, want) {
+		t.Fatalf("Search(jobs) = %v, want %v", got, want)
+	}
+	if got := search("matroid"); len(got) != 0 {
+		t.Fatalf("Search(matroid) = %v, want nothing", got)
+	}
+	for _, markup := range []string{"div", "class"} {
+		if got := search(markup); len(got) != 0 {
+			t.Fatalf("Search(%s) = %v, want no match in statement markup", markup, got)
+		}
+	}
+
+	hits, err := s.Search(ctx, "", "dominoes", 0)
+	must(t, err)
+	if len(hits) != 1 || hits[0].ProblemID != "3C" || strings.Contains(hits[0].Fields["statement"], "<") {
+		t.Fatalf("Search(dominoes) = %+v, want statement 3C without markup", hits)
+	}
+
+	hits, err = s.Search(ctx, "", "exchange", 1)
+	must(t, err)
+	if len(hits) != 1 {
+		t.Fatalf("Search with limit 1 returned %d hits", len(hits))
+	}
+}
+
+func testUserIsolation(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	must(t, s.SaveStatement(ctx, storage.StatementEntry{ProblemID: "1A", Statement: "Sort the jobs."}))
+	for _, userID := range []string{"alice", "bob", ""} {
+		session, err := s.CreateSession(ctx, storage.Session{UserID: userID, ProblemID: "1A", StartedAt: base})
+		must(t, err)
+		snapshot, err := s.SaveSnapshot(ctx, storage.Snapshot{UserID: userID, SessionID: session.ID, ProblemID: "1A", Timestamp: base, Code: userID})
+		must(t, err)
+		if snapshot.Seq != 1 {
+			t.Fatalf("first snapshot of %q has seq %d, want 1", userID, snapshot.Seq)
+		}
+		must(t, s.SaveFeedback(ctx, storage.FeedbackEntry{ID: "f-" + userID, UserID: userID, ProblemID: "1A", Timestamp: base, Feedback: "jobs " + userID}))
+		must(t, s.SaveHint(ctx, storage.HintEntry{UserID: userID, ProblemID: "1A", Level: "nudge", Timestamp: base, Hint: userID}))
+		summary, err := s.SaveSummary(ctx, storage.Summary{UserID: userID, ProblemID: "1A", Timestamp: base, Feedback: userID})
+		must(t, err)
+		if summary.Version != 1 {
+			t.Fatalf("first summary of %q has version %d, want 1", userID, summary.Version)
+		}
+	}
+	// Outside any session, so not anonymous code for RedactSessionCode.
+	_, err := s.SaveSnapshot(ctx, storage.Snapshot{UserID: "alice", ProblemID: "1A", Timestamp: base, Code: "alice"})
+	must(t, err)
+
+	for _, userID := range []string{"alice", "bob", ""} {
+		latest, err := s.GetLatestSnapshot(ctx, userID, "1A")
+		must(t, err)
+		if latest.Code != userID {
+			t.Fatalf("GetLatestSnapshot(%q) returned the snapshot of %q", userID, latest.Code)
+		}
+		feedback, err := s.GetLatestFeedback(ctx, userID, "1A")
+		must(t, err)
+		if feedback.UserID != userID {
+			t.Fatalf("GetLatestFeedback(%q) returned the feedback of %q", userID, feedback.UserID)
+		}
+		for what, n := range map[string]func() (int, error){
+			"GetSessionsByProblemID": func() (int, error) {
+				got, err := s.GetSessionsByProblemID(ctx, userID, "1A")
+				return len(got), err
+			},
+			"GetAllFeedbacksByProblemID": func() (int, error) {
+				got, err := s.GetAllFeedbacksByProblemID(ctx, userID, "1A")
+				return len(got), err
+			},
+			"GetHintsByProblemID": func() (int, error) {
+				got, err := s.GetHintsByProblemID(ctx, userID, "1A")
+				return len(got), err
+			},
+			"GetSummaryHistory": func() (int, error) {
+				got, err := s.GetSummaryHistory(ctx, userID, "1A")
+				return len(got), err
+			},
+			"ListFeedback": func() (int, error) {
+				page, err := s.ListFeedback(ctx, storage.ListQuery{UserID: userID, ProblemID: "1A"})
+				return len(page.Items), err
+			},
+		} {
+			got, err := n()
+			must(t, err)
+			if got != 1 {
+				t.Fatalf("%s(%q) returned %d records, want 1", what, userID, got)
+			}
+		}
+		summary, err := s.GetSummaryByProblemID(ctx, userID, "1A")
+		must(t, err)
+		if summary.Feedback != userID {
+			t.Fatalf("GetSummaryByProblemID(%q) returned the summary of %q", userID, summary.Feedback)
+		}
+	}
+
+	_, err = s.GetLatestSnapshot(ctx, "carol", "1A")
+	wantNotFound(t, "GetLatestSnapshot of a user without snapshots", err)
+	page, err := s.ListSnapshots(ctx, storage.ListQuery{AllUsers: true, ProblemID: "1A"})
+	must(t, err)
+	if len(page.Items) != 4 {
+		t.Fatalf("ListSnapshots of all users returned %d snapshots, want 4", len(page.Items))
+	}
+
+	hits, err := s.Search(ctx, "bob", "jobs", 0)
+	must(t, err)
+	var found []string
+	for _, hit := range hits {
+		found = append(found, hit.Kind+" "+hit.ID)
+	}
+	slices.Sort(found)
+	if want := []string{"feedback f-bob", "statement 1A"}; !slices.Equal(found, want) {
+		t.Fatalf("Search as bob = %v, want %v", found, want)
+	}
+
+	n, err := s.RedactSessionCode(ctx, "", base.Add(time.Hour))
+	must(t, err)
+	if n != 0 {
+		t.Fatalf("RedactSessionCode outside sessions redacted %d records of a user", n)
+	}
+}
+
+// listAll follows the cursors of a listing to its last page and returns the
+// IDs of every record.
+func listAll[T any](t *testing.T, list func(cursor string) (storage.Page[T], error), id func(T) string) []string {
+	t.Helper()
+	var all []string
+	cursor := ""
+	for range 100 {
+		page, err := list(cursor)
+		must(t, err)
+		all = append(all, ids(page.Items, id)...)
+		if page.NextCursor == "" {
+			return all
+		}
+		cursor = page.NextCursor
+	}
+	t.Fatal("listing did not end after 100 pages")
+	return nil
+}
+
+func ids[T any](items []T, id func(T) string) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, id(item))
+	}
+	return out
+}
+
+func wantIDs(t *testing.T, listing string, got []string, want ...string) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Fatalf("%s listing = %v, want %v", listing, got, want)
+	}
+}
+
+func testSummaryVersions(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	_, err := s.GetSummaryByProblemID(ctx, "", "1A")
+	wantNotFound(t, "GetSummaryByProblemID on empty store", err)
+
+	first, err := s.SaveSummary(ctx, storage.Summary{
+		ProblemID:   "1A",
+		Timestamp:   base,
+		Feedback:    "first",
+		HintsUsed:   map[string]int{"nudge": 2},
+		FeedbackIDs: []string{"f1"},
+	})
+	must(t, err)
+	if first.Version != 1 || first.ID == "" {
+		t.Fatalf("first summary stored as version %d, id %q", first.Version, first.ID)
+	}
+	second, err := s.SaveSummary(ctx, storage.Summary{ProblemID: "1A", Timestamp: base.Add(time.Hour), Feedback: "second"})
+	must(t, err)
+	if second.Version != 2 {
+		t.Fatalf("second summary stored as version %d, want 2", second.Version)
+	}
+	_, err = s.SaveSummary(ctx, storage.Summary{ProblemID: "2B", Timestamp: base, Feedback: "other problem"})
+	must(t, err)
+
+	_, err = s.SaveSummary(ctx, storage.Summary{ProblemID: "1A", Version: 2})
+	wantDuplicate(t, "saving a summary with a duplicate version", err)
+
+	got, err := s.GetSummaryByProblemID(ctx, "", "1A")
+	must(t, err)
+	if got.Feedback != "second" || got.Version != 2 {
+		t.Fatalf("GetSummaryByProblemID = %+v, want the latest version", got)
+	}
+
+	history, err := s.GetSummaryHistory(ctx, "", "1A")
+	must(t, err)
+	if len(history) != 2 || history[0].Version != 2 || history[1].Version != 1 {
+		t.Fatalf("GetSummaryHistory = %+v, want versions 2 and 1", history)
+	}
+	old := history[1]
+	if old.HintsUsed["nudge"] != 2 || len(old.FeedbackIDs) != 1 || old.FeedbackIDs[0] != "f1" || !old.Timestamp.Equal(base) {
+		t.Fatalf("GetSummaryHistory first version = %+v, fields differ from the saved summary", old)
+	}
+}
+
+func testSummaryDuplicateID(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	first, err := s.SaveSummary(ctx, storage.Summary{ID: storage.NewID(), ProblemID: "1A", Timestamp: base, Feedback: "first"})
+	must(t, err)
+	_, err = s.SaveSummary(ctx, storage.Summary{ID: first.ID, ProblemID: "1A", Timestamp: base, Feedback: "again"})
+	wantDuplicate(t, "saving a summary with a duplicate ID", err)
+	_, err = s.SaveSummary(ctx, storage.Summary{ID: first.ID, UserID: "alice", ProblemID: "2B", Timestamp: base})
+	wantDuplicate(t, "saving a summary of another problem with a duplicate ID", err)
+
+	history, err := s.GetSummaryHistory(ctx, "", "1A")
+	must(t, err)
+	if len(history) != 1 || history[0].Feedback != "first" {
+		t.Fatalf("GetSummaryHistory = %+v, want only the first summary", history)
+	}
+}
+
+func testSnapshotSeq(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	for i := 1; i <= 3; i++ {
+		got, err := s.SaveSnapshot(ctx, storage.Snapshot{ProblemID: "1A", Timestamp: base})
+		must(t, err)
+		if got.Seq != int64(i) || got.ID == "" {
+			t.Fatalf("snapshot %d stored as seq %d, id %q", i, got.Seq, got.ID)
+		}
+	}
+	other, err := s.SaveSnapshot(ctx, storage.Snapshot{ProblemID: "2B", Timestamp: base})
+	must(t, err)
+	if other.Seq != 1 {
+		t.Fatalf("first snapshot of another problem got seq %d, want 1", other.Seq)
+	}
+
+	_, err = s.SaveSnapshot(ctx, storage.Snapshot{ProblemID: "1A", Seq: 2, Timestamp: base})
+	wantDuplicate(t, "saving a snapshot with a duplicate seq", err)
+
+	latest, err := s.GetLatestSnapshot(ctx, "", "1A")
+	must(t, err)
+	if latest == nil || latest.Seq != 3 {
+		t.Fatalf("GetLatestSnapshot = %+v, want seq 3", latest)
+	}
+
+	all, err := s.GetSnapshotsByProblemID(ctx, "", "1A")
+	must(t, err)
+	if len(all) != 3 {
+		t.Fatalf("GetSnapshotsByProblemID returned %d snapshots, want 3", len(all))
+	}
+	for i, snap := range all {
+		if snap.Seq != int64(i+1) {
+			t.Fatalf("snapshots out of order: position %d has seq %d", i, snap.Seq)
+		}
+	}
+
+	_, err = s.GetLatestSnapshot(ctx, "", "3C")
+	wantNotFound(t, "GetLatestSnapshot for unknown problem", err)
+}
+
+func testSnapshotRoundTrip(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	saved, err := s.SaveSnapshot(ctx, storage.Snapshot{
+		SessionID: "session",
+		ProblemID: "1A",
+		Timestamp: base,
+		Files: []storage.SnapshotFile{
+			{Path: "main.cpp", Language: "cpp", Content: "int main() {}"},
+			{Path: "lib.h", Content: "#pragma once"},
+		},
+		Cursor:   &storage.Cursor{Path: "main.cpp", Line: 1, Column: 5},
+		Thoughts: "greedy?",
+	})
+	must(t, err)
+
+	got, err := s.GetSnapshot(ctx, saved.ID)
+	must(t, err)
+	if got == nil {
+		t.Fatal("GetSnapshot returned nil for a saved snapshot")
+	}
+	if got.SessionID != "session" || got.Thoughts != "greedy?" || !got.Timestamp.Equal(base) {
+		t.Fatalf("GetSnapshot = %+v, fields differ from the saved snapshot", got)
+	}
+	if len(got.Files) != 2 || got.Files[0].Path != "main.cpp" || got.Files[0].Language != "cpp" {
+		t.Fatalf("GetSnapshot files = %+v", got.Files)
+	}
+	if got.Cursor == nil || got.Cursor.Line != 1 || got.Cursor.Column != 5 {
+		t.Fatalf("GetSnapshot cursor = %+v", got.Cursor)
+	}
+
+	_, err = s.GetSnapshot(ctx, storage.NewID())
+	wantNotFound(t, "GetSnapshot for unknown ID", err)
+}
+
+func testSessionLifecycle(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	created, err := s.CreateSession(ctx, storage.Session{
+		UserID:     "alice",
+		ProblemID:  "1A",
+		StartedAt:  base,
+		LastSeenAt: base,
+		Client:     storage.ClientInfo{Name: "jetbrains"},
+	})
+	must(t, err)
+	if created.ID == "" || created.Token == "" {
+		t.Fatalf("CreateSession did not assign ID and token: %+v", created)
+	}
+
+	byToken, err := s.GetSessionByToken(ctx, created.Token)
+	must(t, err)
+	if byToken == nil || byToken.ID != created.ID {
+		t.Fatalf("GetSessionByToken = %+v, want session %s", byToken, created.ID)
+	}
+
+	must(t, s.TouchSession(ctx, created.ID, base.Add(time.Minute)))
+	must(t, s.EndSession(ctx, created.ID, base.Add(2*time.Minute), storage.SessionEndExplicit))
+	// Ending twice keeps the first end.
+	must(t, s.EndSession(ctx, created.ID, base.Add(3*time.Minute), storage.SessionEndIdle))
+
+	got, err := s.GetSession(ctx, created.ID)
+	must(t, err)
+	if got == nil {
+		t.Fatal("GetSession returned nil for a created session")
+	}
+	if !got.LastSeenAt.Equal(base.Add(time.Minute)) {
+		t.Fatalf("LastSeenAt = %v, want %v", got.LastSeenAt, base.Add(time.Minute))
+	}
+	if got.EndedAt == nil || !got.EndedAt.Equal(base.Add(2*time.Minute)) || got.EndReason != storage.SessionEndExplicit {
+		t.Fatalf("session end = %v %q, want the first explicit end", got.EndedAt, got.EndReason)
+	}
+	if got.Client.Name != "jetbrains" || got.UserID != "alice" {
+		t.Fatalf("GetSession = %+v, fields differ from the created session", got)
+	}
+
+	_, err = s.CreateSession(ctx, storage.Session{Token: created.Token, ProblemID: "1A"})
+	wantDuplicate(t, "creating a session with a duplicate token", err)
+
+	_, err = s.GetSessionByToken(ctx, "nope")
+	wantNotFound(t, "GetSessionByToken for unknown token", err)
+}
+
+func testSessionsByProblem(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	for i := 0; i < 3; i++ {
+		_, err := s.CreateSession(ctx, storage.Session{ProblemID: "1A", StartedAt: base.Add(time.Duration(i) * time.Hour)})
+		must(t, err)
+	}
+	_, err := s.CreateSession(ctx, storage.Session{ProblemID: "2B", StartedAt: base})
+	must(t, err)
+
+	got, err := s.GetSessionsByProblemID(ctx, "", "1A")
+	must(t, err)
+	if len(got) != 3 {
+		t.Fatalf("GetSessionsByProblemID returned %d sessions, want 3", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].StartedAt.After(got[i-1].StartedAt) {
+			t.Fatal("sessions are not sorted newest first")
+		}
+	}
+}
+
+func testEndIdleSessions(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	idle, err := s.CreateSession(ctx, storage.Session{ProblemID: "1A", StartedAt: base, LastSeenAt: base})
+	must(t, err)
+	active, err := s.CreateSession(ctx, storage.Session{ProblemID: "1A", StartedAt: base, LastSeenAt: base.Add(time.Hour)})
+	must(t, err)
+
+	n, err := s.EndIdleSessions(ctx, base.Add(30*time.Minute), base.Add(time.Hour))
+	must(t, err)
+	if n != 1 {
+		t.Fatalf("EndIdleSessions ended %d sessions, want 1", n)
+	}
+
+	got, err := s.GetSession(ctx, idle.ID)
+	must(t, err)
+	if got.EndedAt == nil || got.EndReason != storage.SessionEndIdle {
+		t.Fatalf("idle session = %+v, want ended as idle", got)
+	}
+	got, err = s.GetSession(ctx, active.ID)
+	must(t, err)
+	if got.EndedAt != nil {
+		t.Fatalf("active session was ended: %+v", got)
+	}
+
+	n, err = s.EndIdleSessions(ctx, base.Add(30*time.Minute), base.Add(time.Hour))
+	must(t, err)
+	if n != 0 {
+		t.Fatalf("second EndIdleSessions ended %d sessions, want 0", n)
+	}
+}
+
+func testHintsByProblem(t *testing.T, s storage.Storage) {
+	ctx := t.Context()
+
+	must(t, s.SaveHint(ctx, storage.HintEntry{ProblemID: "1A", Level: "outline", Timestamp: base.Add(time.Minute), Hint: "second"}))
+	must(t, s.SaveHint(ctx, storage.HintEntry{ProblemID: "1A", Level: "nudge", Timestamp: base, Hint: "first"}))
+	must(t, s.SaveHint(ctx, storage.HintEntry{ProblemID: "2B", Level: "nudge", Timestamp: base, Hint: "other"}))
+
+	got, err := s.GetHintsByProblemID(ctx, "", "1A")
+	must(t, err)
+	if len(got) != 2 || got[0].Hint != "first" || got[1].Hint != "second" {
+		t.Fatalf("GetHintsByProblemID = %+v, want both hints of 1A oldest first", got)
+	}
+}
+
+func testCanceledContext(t *testing.T, s storage.Storage) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	err := s.SaveStatement(ctx, storage.StatementEntry{ProblemID: "1A", Statement: "a"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("SaveStatement with a canceled context returned %v, want context.Canceled", err)
+	}
+	_, err = s.GetAllStatements(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetAllStatements with a canceled context returned %v, want context.Canceled", err)
+	}
+	if _, err := s.GetStatement(t.Context(), "1A"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("statement saved despite the canceled context: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bounds single storage operations. Zero leaves the caller's
+// deadline alone.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+// WithTimeouts returns s with a deadline applied to every operation, on top
+// of whatever deadline the caller's context already carries.
+func WithTimeouts(s Storage, t Timeouts) Storage {
+	if t.Read <= 0 && t.Write <= 0 {
+		return s
+	}
+	return &timeoutStore{next: s, t: t}
+}
+
+type timeoutStore struct {
+	next Storage
+	t    Timeouts
+}
+
+func (s *timeoutStore) read(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, s.t.Read)
+}
+
+func (s *timeoutStore) write(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, s.t.Write)
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+func (s *timeoutStore) CreateSession(ctx context.Context, entry Session) (*Session, error) {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.CreateSession(ctx, entry)
+}
+
+func (s *timeoutStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetSession(ctx, id)
+}
+
+func (s *timeoutStore) GetSessionByToken(ctx context.Context, token string) (*Session, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetSessionByToken(ctx, token)
+}
+
+func (s *timeoutStore) GetSessionsByProblemID(ctx context.Context, userID, problemID string) ([]Session, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetSessionsByProblemID(ctx, userID, problemID)
+}
+
+func (s *timeoutStore) TouchSession(ctx context.Context, id string, at time.Time) error {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.TouchSession(ctx, id, at)
+}
+
+func (s *timeoutStore) EndSession(ctx context.Context, id string, at time.Time, reason string) error {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.EndSession(ctx, id, at, reason)
+}
+
+func (s *timeoutStore) EndIdleSessions(ctx context.Context, idleSince, at time.Time) (int, error) {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.EndIdleSessions(ctx, idleSince, at)
+}
+
+func (s *timeoutStore) SaveSnapshot(ctx context.Context, entry Snapshot) (*Snapshot, error) {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.SaveSnapshot(ctx, entry)
+}
+
+func (s *timeoutStore) GetSnapshot(ctx context.Context, id string) (*Snapshot, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetSnapshot(ctx, id)
+}
+
+func (s *timeoutStore) GetSnapshotsByProblemID(ctx context.Context, userID, problemID string) ([]Snapshot, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetSnapshotsByProblemID(ctx, userID, problemID)
+}
+
+func (s *timeoutStore) GetLatestSnapshot(ctx context.Context, userID, problemID string) (*Snapshot, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetLatestSnapshot(ctx, userID, problemID)
+}
+
+func (s *timeoutStore) ListSnapshots(ctx context.Context, q ListQuery) (Page[Snapshot], error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.ListSnapshots(ctx, q)
+}
+
+func (s *timeoutStore) DeleteSnapshots(ctx context.Context, ids []string) (int, error) {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.DeleteSnapshots(ctx, ids)
+}
+
+func (s *timeoutStore) SaveFeedback(ctx context.Context, entry FeedbackEntry) error {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.SaveFeedback(ctx, entry)
+}
+
+func (s *timeoutStore) GetAllFeedbacksByProblemID(ctx context.Context, userID, problemID string) ([]FeedbackEntry, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetAllFeedbacksByProblemID(ctx, userID, problemID)
+}
+
+func (s *timeoutStore) GetLatestFeedback(ctx context.Context, userID, problemID string) (*FeedbackEntry, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetLatestFeedback(ctx, userID, problemID)
+}
+
+func (s *timeoutStore) ListFeedback(ctx context.Context, q ListQuery) (Page[FeedbackEntry], error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.ListFeedback(ctx, q)
+}
+
+func (s *timeoutStore) SaveHint(ctx context.Context, entry HintEntry) error {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.SaveHint(ctx, entry)
+}
+
+func (s *timeoutStore) GetHintsByProblemID(ctx context.Context, userID, problemID string) ([]HintEntry, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetHintsByProblemID(ctx, userID, problemID)
+}
+
+func (s *timeoutStore) RedactSessionCode(ctx context.Context, sessionID string, before time.Time) (int, error) {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.RedactSessionCode(ctx, sessionID, before)
+}
+
+func (s *timeoutStore) GetStatement(ctx context.Context, problemID string) (*StatementEntry, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetStatement(ctx, problemID)
+}
+
+func (s *timeoutStore) SaveStatement(ctx context.Context, entry StatementEntry) error {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.SaveStatement(ctx, entry)
+}
+
+func (s *timeoutStore) GetAllStatements(ctx context.Context) ([]StatementEntry, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetAllStatements(ctx)
+}
+
+func (s *timeoutStore) Search(ctx context.Context, userID, query string, limit int) ([]SearchHit, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.Search(ctx, userID, query, limit)
+}
+
+func (s *timeoutStore) GetSummaryByProblemID(ctx context.Context, userID, problemID string) (*Summary, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetSummaryByProblemID(ctx, userID, problemID)
+}
+
+func (s *timeoutStore) GetSummaryHistory(ctx context.Context, userID, problemID string) ([]Summary, error) {
+	ctx, cancel := s.read(ctx)
+	defer cancel()
+	return s.next.GetSummaryHistory(ctx, userID, problemID)
+}
+
+func (s *timeoutStore) SaveSummary(ctx context.Context, summary Summary) (*Summary, error) {
+	ctx, cancel := s.write(ctx)
+	defer cancel()
+	return s.next.SaveSummary(ctx, summary)
+}
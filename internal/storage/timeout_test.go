@@ -0,0 +1,27 @@
+package storage_test
+
+import (
+	"coach_demon/internal/storage"
+	"coach_demon/internal/storage/storagetest"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithTimeouts(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.WithTimeouts(storage.NewMemoryStore(), storage.Timeouts{Read: time.Minute, Write: time.Minute})
+	})
+}
+
+func TestWithTimeoutsExpired(t *testing.T) {
+	store := storage.WithTimeouts(storage.NewMemoryStore(), storage.Timeouts{Read: time.Nanosecond})
+
+	_, err := store.GetAllStatements(t.Context())
+	if !errors.Is(err, storage.ErrTimeout) {
+		t.Fatalf("read past its deadline returned %v, want ErrTimeout", err)
+	}
+	if err := store.SaveStatement(t.Context(), storage.StatementEntry{ProblemID: "1A"}); err != nil {
+		t.Fatalf("write without a timeout returned %v", err)
+	}
+}
@@ -22,12 +22,19 @@ func ParseID(id string) (contest, index string, err error) {
 	return "", "", fmt.Errorf("cannot split %q into contest/index", id)
 }
 
-func FetchStatement(ctx context.Context, fetcherURL, id string) (string, error) {
+// ProblemURL is the problemset page of a problem.
+func ProblemURL(contest, index string) string {
+	return fmt.Sprintf("https://codeforces.com/problemset/problem/%s/%s", contest, index)
+}
+
+// FetchStatement asks the fetcher at fetcherURL for the statement page of
+// problem id. A nil client uses http.DefaultClient.
+func FetchStatement(ctx context.Context, client *http.Client, fetcherURL, id string) (string, error) {
 	contest, index, err := ParseID(id)
 	if err != nil {
 		return "", err
 	}
-	target := fmt.Sprintf("https://codeforces.com/problemset/problem/%s/%s", contest, index)
+	target := ProblemURL(contest, index)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fetcherURL, bytes.NewBufferString(target))
 	if err != nil {
@@ -35,7 +42,10 @@ func FetchStatement(ctx context.Context, fetcherURL, id string) (string, error)
 	}
 	req.Header.Set("Content-Type", "text/plain")
 
-	res, err := http.DefaultClient.Do(req)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,373 @@
+package codeforces
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// StatementMarkdown condenses the statement page HTML returned by the
+// fetcher to Markdown: the header becomes a title with the limits, sections
+// become headings and samples fenced blocks. Formulas stay LaTeX, written as
+// $...$ and $$...$$ whether the page has Codeforces' $$$ delimiters or
+// MathJax output. A statement that is not HTML, e.g. one imported as text,
+// is returned as it is.
+func StatementMarkdown(statement string) (string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(statement), "<") {
+		return statement, nil
+	}
+	doc, err := html.Parse(strings.NewReader(statement))
+	if err != nil {
+		return "", err
+	}
+	root := findClass(doc, "problem-statement")
+	if root == nil {
+		root = doc
+	}
+	var w markdownWriter
+	w.children(root)
+	return strings.TrimSpace(w.b.String()), nil
+}
+
+// markdownWriter renders HTML nodes as Markdown, collapsing whitespace
+// outside <pre> as a browser would.
+type markdownWriter struct {
+	b     strings.Builder
+	space bool // a whitespace run is pending before the next text
+	glue  bool // the next text follows without a space, e.g. after "**"
+}
+
+func (w *markdownWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+func (w *markdownWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(latex(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+		return
+	}
+	if skipped(n) {
+		return
+	}
+
+	switch {
+	case n.DataAtom == atom.Script:
+		if typ := attr(n, "type"); strings.HasPrefix(typ, "math/tex") {
+			delim := "$"
+			if strings.Contains(typ, "mode=display") {
+				delim = "$$"
+			}
+			w.inline(delim, func() { w.text(strings.TrimSpace(textContent(n))) })
+		}
+	case hasClass(n, "header"):
+		w.header(n)
+	case hasClass(n, "section-title"):
+		w.block("## ", n)
+	case hasClass(n, "title"):
+		w.block("### ", n)
+	case n.DataAtom == atom.Pre:
+		w.pre(n)
+	case n.DataAtom == atom.Br:
+		w.newline()
+	case n.DataAtom == atom.Ul || n.DataAtom == atom.Ol:
+		w.list(n)
+	case n.DataAtom == atom.Table:
+		w.table(n)
+	case n.DataAtom == atom.Img:
+		w.text("![" + attr(n, "alt") + "](" + attr(n, "src") + ")")
+	case n.DataAtom == atom.B || n.DataAtom == atom.Strong || hasClass(n, "tex-font-style-bf"):
+		w.inline("**", func() { w.children(n) })
+	case n.DataAtom == atom.I || n.DataAtom == atom.Em || hasClass(n, "tex-font-style-it"):
+		w.inline("*", func() { w.children(n) })
+	case n.DataAtom == atom.Tt || n.DataAtom == atom.Code || hasClass(n, "tex-font-style-tt"):
+		w.inline("`", func() { w.children(n) })
+	case isBlock(n):
+		w.paragraph()
+		w.children(n)
+		w.paragraph()
+	default:
+		w.children(n)
+	}
+}
+
+// header renders the title and one line per limit, e.g.
+// "time limit per test: 1 second".
+func (w *markdownWriter) header(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if hasClass(c, "title") {
+			w.block("# ", c)
+			continue
+		}
+		w.newline()
+		for p := c.FirstChild; p != nil; p = p.NextSibling {
+			if hasClass(p, "property-title") {
+				w.children(p)
+				w.b.WriteString(":")
+				w.space = true
+				continue
+			}
+			w.node(p)
+		}
+	}
+	w.paragraph()
+}
+
+// block writes n on its own line after prefix, e.g. a heading.
+func (w *markdownWriter) block(prefix string, n *html.Node) {
+	w.paragraph()
+	w.b.WriteString(prefix)
+	w.glue = true
+	w.children(n)
+	w.paragraph()
+}
+
+// pre writes a fenced block. Newer statements put each sample line in its
+// own <div>.
+func (w *markdownWriter) pre(n *html.Node) {
+	var text strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				text.WriteString(c.Data)
+			case c.DataAtom == atom.Br:
+				text.WriteString("\n")
+			case c.DataAtom == atom.Div:
+				walk(c)
+				if !strings.HasSuffix(text.String(), "\n") {
+					text.WriteString("\n")
+				}
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	content := strings.Trim(text.String(), "\n")
+
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	w.paragraph()
+	w.b.WriteString(fence + "\n" + content + "\n" + fence)
+	w.paragraph()
+}
+
+func (w *markdownWriter) list(n *html.Node) {
+	w.paragraph()
+	i := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Li {
+			continue
+		}
+		i++
+		w.newline()
+		if n.DataAtom == atom.Ol {
+			w.b.WriteString(strconv.Itoa(i) + ". ")
+		} else {
+			w.b.WriteString("- ")
+		}
+		w.inlineChildren(c)
+	}
+	w.paragraph()
+}
+
+func (w *markdownWriter) table(n *html.Node) {
+	w.paragraph()
+	rows := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom != atom.Tr {
+				walk(c)
+				continue
+			}
+			w.newline()
+			cells := 0
+			w.b.WriteString("|")
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.DataAtom != atom.Td && cell.DataAtom != atom.Th {
+					continue
+				}
+				cells++
+				w.b.WriteString(" ")
+				w.inlineChildren(cell)
+				w.b.WriteString(" |")
+			}
+			if rows++; rows == 1 {
+				w.newline()
+				w.b.WriteString("|" + strings.Repeat(" --- |", cells))
+			}
+		}
+	}
+	walk(n)
+	w.paragraph()
+}
+
+// inlineChildren renders n on the current line, flattening its blocks.
+func (w *markdownWriter) inlineChildren(n *html.Node) {
+	var inner markdownWriter
+	inner.children(n)
+	w.space = false
+	w.b.WriteString(strings.Join(strings.Fields(inner.b.String()), " "))
+}
+
+// inline wraps what render writes in delim, keeping pending whitespace
+// outside the delimiters.
+func (w *markdownWriter) inline(delim string, render func()) {
+	w.flushSpace()
+	w.b.WriteString(delim)
+	w.glue = true
+	render()
+	w.glue = false
+	space := w.space
+	w.space = false
+	w.b.WriteString(delim)
+	w.space = space
+}
+
+func (w *markdownWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		w.space = true
+		return
+	}
+	if isSpace(s[0]) {
+		w.space = true
+	}
+	if punctuation(words[0]) {
+		w.space = false
+	}
+	w.flushSpace()
+	w.glue = false
+	for i, word := range words {
+		if i > 0 && !punctuation(word) {
+			w.b.WriteString(" ")
+		}
+		w.b.WriteString(word)
+	}
+	w.space = isSpace(s[len(s)-1])
+}
+
+// punctuation reports whether word closes the text before it, so that the
+// line breaks prettify puts before it are not turned into spaces.
+func punctuation(word string) bool {
+	return strings.ContainsAny(word[:1], ",.;:!?)")
+}
+
+func (w *markdownWriter) flushSpace() {
+	if w.space && !w.glue && w.b.Len() > 0 && !strings.HasSuffix(w.b.String(), "\n") {
+		w.b.WriteString(" ")
+	}
+	w.space = false
+}
+
+// newline ends the current line unless it is empty.
+func (w *markdownWriter) newline() {
+	w.space = false
+	if w.b.Len() > 0 && !strings.HasSuffix(w.b.String(), "\n") {
+		w.b.WriteString("\n")
+	}
+}
+
+// paragraph ends the current block with a blank line.
+func (w *markdownWriter) paragraph() {
+	w.newline()
+	if w.b.Len() > 0 && !strings.HasSuffix(w.b.String(), "\n\n") {
+		w.b.WriteString("\n")
+	}
+}
+
+// latex rewrites Codeforces' formula delimiters, $$$$$$ for display and $$$
+// for inline formulas, to the usual ones.
+func latex(s string) string {
+	s = strings.ReplaceAll(s, "$$$$$$", "$$")
+	return strings.ReplaceAll(s, "$$$", "$")
+}
+
+// mathJaxOutput lists the classes of MathJax' rendered formulas, which
+// duplicate the TeX source kept in <script type="math/tex">.
+var mathJaxOutput = []string{"MathJax", "MathJax_Preview", "MathJax_Display", "MathJax_SVG", "MathJax_CHTML", "MJX_Assistive_MathML"}
+
+func skipped(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Style, atom.Noscript, atom.Head:
+		return true
+	}
+	for _, class := range mathJaxOutput {
+		if hasClass(n, class) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlock(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Div, atom.P, atom.Center, atom.Blockquote, atom.Section, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return true
+	}
+	return false
+}
+
+func findClass(n *html.Node, class string) *html.Node {
+	if hasClass(n, class) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findClass(c, class); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func hasClass(n *html.Node, class string) bool {
+	return n.Type == html.ElementNode && slices.Contains(strings.Fields(attr(n, "class")), class)
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
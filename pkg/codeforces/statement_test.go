@@ -0,0 +1,125 @@
+package codeforces
+
+import "testing"
+
+// theatreSquare is shaped like the fetcher's output: BeautifulSoup's
+// prettify puts every tag and text on its own indented line, except in <pre>.
+const theatreSquare = `<div class="problem-statement">
+ <div class="header">
+  <div class="title">
+   A. Theatre Square
+  </div>
+  <div class="time-limit">
+   <div class="property-title">
+    time limit per test
+   </div>
+   1 second
+  </div>
+  <div class="memory-limit">
+   <div class="property-title">
+    memory limit per test
+   </div>
+   256 megabytes
+  </div>
+ </div>
+ <div>
+  <p>
+   Theatre Square has a rectangular shape of size
+   $$$n \times m$$$
+   meters, paved with
+   <span class="tex-font-style-bf">
+    square
+   </span>
+   granite flagstones of size
+   $$$a &lt; n$$$
+   .
+  </p>
+  <p>
+   $$$$$$\left\lceil \frac{n}{a} \right\rceil$$$$$$
+  </p>
+ </div>
+ <div class="input-specification">
+  <div class="section-title">
+   Input
+  </div>
+  <p>
+   Three integers:
+  </p>
+  <ul>
+   <li>
+    <span class="tex-font-style-tt">
+     n
+    </span>
+    and
+    $$$m$$$
+   </li>
+   <li>
+    $$$a$$$
+   </li>
+  </ul>
+ </div>
+ <div class="sample-tests">
+  <div class="section-title">
+   Example
+  </div>
+  <div class="sample-test">
+   <div class="input">
+    <div class="title">
+     Input
+    </div>
+    <pre><div class="test-example-line test-example-line-even test-example-line-0">6 6 4</div><div class="test-example-line test-example-line-odd test-example-line-1">1 1</div></pre>
+   </div>
+   <div class="output">
+    <div class="title">
+     Output
+    </div>
+    <pre>4
+</pre>
+   </div>
+  </div>
+ </div>
+ <div class="note">
+  <div class="section-title">
+   Note
+  </div>
+  <p>
+   One formula rendered by MathJax:
+   <span class="MathJax_Preview">x</span><span class="MathJax" id="MathJax-Element-1-Frame"><span class="math">x</span></span><script type="math/tex" id="MathJax-Element-1">x_1</script>
+   and one displayed:
+   <script type="math/tex; mode=display">\sum a_i</script>
+  </p>
+ </div>
+</div>
+`
+
+const theatreSquareMarkdown = "# A. Theatre Square\n\n" +
+	"time limit per test: 1 second\n" +
+	"memory limit per test: 256 megabytes\n\n" +
+	"Theatre Square has a rectangular shape of size $n \\times m$ meters, paved with **square** granite flagstones of size $a < n$.\n\n" +
+	"$$\\left\\lceil \\frac{n}{a} \\right\\rceil$$\n\n" +
+	"## Input\n\n" +
+	"Three integers:\n\n" +
+	"- `n` and $m$\n" +
+	"- $a$\n\n" +
+	"## Example\n\n" +
+	"### Input\n\n" +
+	"```\n6 6 4\n1 1\n```\n\n" +
+	"### Output\n\n" +
+	"```\n4\n```\n\n" +
+	"## Note\n\n" +
+	"One formula rendered by MathJax: $x_1$ and one displayed: $$\\sum a_i$$"
+
+func TestStatementMarkdown(t *testing.T) {
+	got, err := StatementMarkdown(theatreSquare)
+	if err != nil {
+		t.Fatalf("StatementMarkdown: %v", err)
+	}
+	if got != theatreSquareMarkdown {
+		t.Errorf("StatementMarkdown =\n%s\nwant\n%s", got, theatreSquareMarkdown)
+	}
+
+	plain := "Print the sum of\n  two numbers."
+	if got, err := StatementMarkdown(plain); err != nil || got != plain {
+		t.Errorf("StatementMarkdown of plain text = %q, %v; want it unchanged", got, err)
+	}
+}
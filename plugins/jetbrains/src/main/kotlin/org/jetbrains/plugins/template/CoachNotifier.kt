@@ -1,5 +1,8 @@
 package org.jetbrains.plugins.template
 
+import com.intellij.codeInsight.hint.HintManager
+import com.intellij.openapi.application.ApplicationManager
+import com.intellij.openapi.editor.Editor
 import com.intellij.openapi.editor.event.*
 import com.intellij.openapi.fileEditor.FileEditorManagerListener
 import com.intellij.openapi.util.Key
@@ -22,6 +25,10 @@ class CoachNotifier : FileEditorManagerListener {
     private var ws: WebSocket? = null
     private val scope = CoroutineScope(Dispatchers.IO)
 
+    // Editor that sent the most recent snapshot; feedback is shown there.
+    @Volatile
+    private var lastEditor: Editor? = null
+
     override fun fileOpened(manager: com.intellij.openapi.fileEditor.FileEditorManager, file: com.intellij.openapi.vfs.VirtualFile) {
         val editor = manager.getSelectedTextEditor() ?: return
         val debounceMs = 2000L
@@ -62,18 +69,44 @@ class CoachNotifier : FileEditorManagerListener {
                     if (ws == null) {
                         ws = HttpClient.newHttpClient()
                             .newWebSocketBuilder()
-                            .buildAsync(
-                                URI("ws://localhost:12345/ws"),
-                                object : WebSocket.Listener {
-                                    override fun onText(
-                                        webSocket: WebSocket?, data: CharSequence?, last: Boolean
-                                    ): CompletionStage<*>? = null
-                                }
-                            ).join()
+                            .buildAsync(URI("ws://localhost:12345/ws"), FeedbackListener())
+                            .join()
                     }
+                    lastEditor = editor
                     ws?.sendText(msg.toString(), true)
                 }
             }
         })
     }
+
+    // Receives frames pushed by the server and shows feedback inline in the editor.
+    private inner class FeedbackListener : WebSocket.Listener {
+        private val buffer = StringBuilder()
+
+        override fun onText(webSocket: WebSocket, data: CharSequence, last: Boolean): CompletionStage<*>? {
+            buffer.append(data)
+            if (last) {
+                val frame = buffer.toString()
+                buffer.setLength(0)
+                handleFrame(frame)
+            }
+            webSocket.request(1)
+            return null
+        }
+
+        private fun handleFrame(frame: String) {
+            val json = runCatching { JSONObject(frame) }.getOrNull() ?: return
+            if (json.optString("type") != "feedback") return
+            val payload = json.optJSONObject("payload") ?: return
+            val feedback = payload.optString("feedback")
+            if (feedback.isBlank()) return
+
+            val editor = lastEditor ?: return
+            ApplicationManager.getApplication().invokeLater {
+                if (!editor.isDisposed) {
+                    HintManager.getInstance().showInformationHint(editor, feedback)
+                }
+            }
+        }
+    }
 }
@@ -0,0 +1,219 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// CassetteEnv selects what cassettes do: "record" sends requests to the live
+// services and saves the interactions, anything else replays them offline.
+const CassetteEnv = "COACH_CASSETTES"
+
+// secretParams are query parameters left out of recorded URLs.
+var secretParams = []string{"token", "key", "api_key", "apikey"}
+
+// Cassette is an http.RoundTripper that records interactions to a fixture
+// file and replays them, so tests against live services run without network
+// or API keys. The fixture is testdata/cassettes/<test name>.json.
+//
+// Requests match by method, path, query and body. Hosts are ignored, as the
+// services live at different addresses on every machine, and JSON bodies are
+// compared by content. Identical requests replay in recorded order.
+type Cassette struct {
+	path   string
+	next   http.RoundTripper
+	record bool
+
+	mu           sync.Mutex
+	interactions []interaction
+	played       []bool
+}
+
+type interaction struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+type recordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type recordedResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body"`
+}
+
+// NewCassette loads the cassette of t, or in record mode starts a new one
+// that is sent through next and saved when t passes.
+func NewCassette(t *testing.T, next http.RoundTripper) *Cassette {
+	t.Helper()
+	c := &Cassette{
+		path:   filepath.Join("testdata", "cassettes", strings.ReplaceAll(t.Name(), "/", "_")+".json"),
+		next:   next,
+		record: os.Getenv(CassetteEnv) == "record",
+	}
+	if c.record {
+		t.Cleanup(func() {
+			if t.Failed() {
+				t.Logf("not saving cassette %s of a failed test", c.path)
+				return
+			}
+			if err := c.save(); err != nil {
+				t.Errorf("saving cassette: %v", err)
+			}
+		})
+		return c
+	}
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("no cassette %s; record one with %s=record", c.path, CassetteEnv)
+	}
+	if err != nil {
+		t.Fatalf("reading cassette: %v", err)
+	}
+	if err := json.Unmarshal(data, &c.interactions); err != nil {
+		t.Fatalf("parsing cassette %s: %v", c.path, err)
+	}
+	c.played = make([]bool, len(c.interactions))
+	return c
+}
+
+// Recording reports whether requests reach the live services.
+func (c *Cassette) Recording() bool {
+	return c.record
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := recordedRequest{Method: req.Method, URL: normalizeURL(req.URL), Body: normalizeBody(body)}
+
+	if c.record {
+		return c.recordTrip(req, recorded)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, in := range c.interactions {
+		if !c.played[i] && in.Request == recorded {
+			c.played[i] = true
+			return in.Response.toHTTP(req), nil
+		}
+	}
+	return nil, fmt.Errorf("cassette %s has no unplayed %s %s with this body; rerun with %s=record", c.path, recorded.Method, recorded.URL, CassetteEnv)
+}
+
+func (c *Cassette) recordTrip(req *http.Request, recorded recordedRequest) (*http.Response, error) {
+	res, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, interaction{
+		Request: recorded,
+		Response: recordedResponse{
+			Status:      res.StatusCode,
+			ContentType: res.Header.Get("Content-Type"),
+			Body:        string(body),
+		},
+	})
+	c.mu.Unlock()
+	return res, nil
+}
+
+func (c *Cassette) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c.interactions); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data.Bytes(), 0o644)
+}
+
+func (r recordedResponse) toHTTP(req *http.Request) *http.Response {
+	header := make(http.Header)
+	if r.ContentType != "" {
+		header.Set("Content-Type", r.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// normalizeURL drops the host and secret query parameters; Encode sorts the
+// rest.
+func normalizeURL(u *url.URL) string {
+	query := u.Query()
+	for _, name := range secretParams {
+		query.Del(name)
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
+
+// normalizeBody re-encodes JSON bodies with sorted keys and no insignificant
+// whitespace; other bodies are kept as they are.
+func normalizeBody(body []byte) string {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	var normalized bytes.Buffer
+	enc := json.NewEncoder(&normalized)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return string(body)
+	}
+	return strings.TrimSuffix(normalized.String(), "\n")
+}
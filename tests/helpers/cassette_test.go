@@ -0,0 +1,77 @@
+package helpers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassette(t *testing.T) {
+	t.Chdir(t.TempDir())
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, r.URL.Path+" "+string(body))
+	}))
+	defer srv.Close()
+
+	do := func(t *testing.T, client *http.Client, method, url, body string) (string, error) {
+		t.Helper()
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		data, err := io.ReadAll(res.Body)
+		return string(data), err
+	}
+
+	t.Run("record", func(t *testing.T) {
+		t.Setenv(CassetteEnv, "record")
+		client := &http.Client{Transport: NewCassette(t, http.DefaultTransport)}
+		for _, body := range []string{`{"b": 1, "a": [1, 2]}`, "second"} {
+			if _, err := do(t, client, http.MethodPost, srv.URL+"/v1/x?token=secret&q=1", body); err != nil {
+				t.Fatalf("recording: %v", err)
+			}
+		}
+	})
+	data, err := os.ReadFile(filepath.Join("testdata", "cassettes", "TestCassette_record.json"))
+	if err != nil {
+		t.Fatalf("reading recorded cassette: %v", err)
+	}
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "127.0.0.1") {
+		t.Errorf("cassette keeps the token or host:\n%s", data)
+	}
+	if err := os.WriteFile(filepath.Join("testdata", "cassettes", "TestCassette_replay.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Close()
+	t.Run("replay", func(t *testing.T) {
+		client := &http.Client{Transport: NewCassette(t, http.DefaultTransport)}
+		// Another host, other parameter order and JSON formatting still match.
+		got, err := do(t, client, http.MethodPost, "http://fetcher:3001/v1/x?q=1", `{"a":[1,2],"b":1}`)
+		if err != nil || got != `/v1/x {"b": 1, "a": [1, 2]}` {
+			t.Fatalf("replayed %q, %v", got, err)
+		}
+		if got, err := do(t, client, http.MethodPost, srv.URL+"/v1/x?q=1", "second"); err != nil || got != "/v1/x second" {
+			t.Fatalf("replayed %q, %v", got, err)
+		}
+		if _, err := do(t, client, http.MethodPost, srv.URL+"/v1/x?q=1", "second"); err == nil {
+			t.Fatal("replayed an interaction twice")
+		}
+	})
+	if hits != 2 {
+		t.Errorf("server saw %d requests, want 2", hits)
+	}
+}
@@ -2,6 +2,9 @@ package helpers
 
 import (
 	"bytes"
+	"coach_demon/internal/openai"
+	"coach_demon/internal/prompts"
+	"coach_demon/pkg/codeforces"
 	"context"
 	"github.com/spf13/viper"
 	"html/template"
@@ -22,6 +25,57 @@ func LoadConfig(t *testing.T) {
 	_ = viper.ReadInConfig()
 }
 
+// OpenAIConfig is the client configuration of the tests talking to OpenAI.
+// Model and prompt are fixed rather than read from config.yaml, as they are
+// part of the requests matched against cassettes; the key is only needed
+// when recording.
+func OpenAIConfig(c *Cassette) openai.Config {
+	apiKey := viper.GetString("OPENAI_API_KEY")
+	if !c.Recording() {
+		apiKey = "replayed"
+	}
+	return openai.Config{
+		APIKey:       apiKey,
+		Model:        "o4-mini",
+		SystemPrompt: "You are a Codeforces competitive programming and math coach.",
+		Timeout:      30 * time.Second,
+	}
+}
+
+// FeedbackPrompt renders the built-in feedback prompt the way the server
+// does, with the statement condensed to Markdown.
+func FeedbackPrompt(t *testing.T, problemID string, code openai.Code, thoughts, statement string) openai.Prompt {
+	t.Helper()
+	set, err := prompts.Load("")
+	if err != nil {
+		t.Fatalf("loading prompts: %v", err)
+	}
+	markdown, err := codeforces.StatementMarkdown(statement)
+	if err != nil {
+		t.Fatalf("condensing statement: %v", err)
+	}
+	data := prompts.Data{
+		Problem:   prompts.NewProblem(problemID),
+		Statement: markdown,
+		Thoughts:  thoughts,
+	}
+	data.SetCode(code)
+	prompt, err := set.Feedback(prompts.DefaultMode, data)
+	if err != nil {
+		t.Fatalf("rendering feedback prompt: %v", err)
+	}
+	return prompt
+}
+
+// FetcherEndpoint is the fetcher of config.yaml, or the one docker compose
+// starts. Replayed requests ignore it.
+func FetcherEndpoint() string {
+	if endpoint := viper.GetString("FETCHER_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return "http://localhost:3001/"
+}
+
 type span struct {
 	Time     string
 	Method   string
@@ -16,12 +16,13 @@ import (
 func TestLiveFetcher(t *testing.T) {
 	helpers.LoadConfig(t)
 
-	tracer := helpers.New(http.DefaultTransport)
+	tracer := helpers.New(helpers.NewCassette(t, http.DefaultTransport))
 
 	service := fetcher.NewBrowserless(
-		viper.GetString("FETCHER_ENDPOINT"),
+		helpers.FetcherEndpoint(),
 		viper.GetString("FETCHER_TOKEN"),
 	)
+	service.HTTPClient = &http.Client{Transport: tracer, Timeout: 30 * time.Second}
 
 	ctx, cancel := helpers.TimeoutContext(t, 360*time.Second)
 	defer cancel()
@@ -5,7 +5,7 @@ package integration
 import (
 	"coach_demon/internal/openai"
 	"coach_demon/tests/helpers"
-	"github.com/spf13/viper"
+	"context"
 	"net/http" //  ← missing import
 	"os"
 	"path/filepath"
@@ -16,20 +16,16 @@ import (
 func TestLiveOpenAI(t *testing.T) {
 	helpers.LoadConfig(t)
 
-	tracer := helpers.New(http.DefaultTransport) // use ctor
+	cassette := helpers.NewCassette(t, http.DefaultTransport)
+	tracer := helpers.New(cassette)
 	httpClient := &http.Client{Transport: tracer, Timeout: 20 * time.Second}
 
-	cli, err := openai.NewClient(openai.Config{
-		APIKey:       viper.GetString("OPENAI_API_KEY"),
-		Model:        viper.GetString("OPENAI_MODEL"),
-		SystemPrompt: viper.GetString("OPENAI_SYSTEM_PROMPT"),
-		Timeout:      20 * time.Second,
-	}, httpClient)
+	cli, err := openai.NewClient(helpers.OpenAIConfig(cassette), httpClient)
 	if err != nil {
 		t.Fatalf("cannot init client: %v", err)
 	}
 
-	_, err = cli.GetFeedback("int a;", "stub", "A+B")
+	_, err = cli.GetFeedback(context.Background(), helpers.FeedbackPrompt(t, "1A", openai.PlainCode("int a;"), "stub", "A+B"))
 	if err != nil {
 		t.Fatalf("GetFeedback: %v", err)
 	}
@@ -0,0 +1,106 @@
+//go:build integration
+
+package integration
+
+import (
+	"coach_demon/internal/storage"
+	"coach_demon/internal/storage/storagetest"
+	"coach_demon/tests/helpers"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"testing"
+	"time"
+)
+
+func TestMongoStorageConformance(t *testing.T) {
+	helpers.LoadConfig(t)
+	uri := viper.GetString("test.MONGODB_URI")
+	if uri == "" {
+		t.Skip("test.MONGODB_URI not configured")
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	logger := zerolog.Nop()
+	n := 0
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		n++
+		database := fmt.Sprintf("coach_demon_test_%d_%d", time.Now().UnixNano(), n)
+		t.Cleanup(func() { _ = client.Database(database).Drop(context.Background()) })
+
+		store, err := storage.NewMongoManager(t.Context(), uri, database, &logger)
+		if err != nil {
+			t.Fatalf("NewMongoManager: %v", err)
+		}
+		if _, err := store.Migrate(t.Context()); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		return store
+	})
+}
+
+func TestMongoMigrations(t *testing.T) {
+	helpers.LoadConfig(t)
+	uri := viper.GetString("test.MONGODB_URI")
+	if uri == "" {
+		t.Skip("test.MONGODB_URI not configured")
+	}
+
+	ctx := t.Context()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	database := fmt.Sprintf("coach_demon_test_migrations_%d", time.Now().UnixNano())
+	db := client.Database(database)
+	t.Cleanup(func() { _ = db.Drop(context.Background()) })
+
+	// A legacy document written under the lower-case field name.
+	if _, err := db.Collection("feedbacks").InsertOne(ctx, bson.M{"problemid": "1A", "feedback": "legacy", "timestamp": time.Now()}); err != nil {
+		t.Fatalf("insert legacy feedback: %v", err)
+	}
+
+	logger := zerolog.Nop()
+	store, err := storage.NewMongoManager(ctx, uri, database, &logger)
+	if err != nil {
+		t.Fatalf("NewMongoManager: %v", err)
+	}
+	if err := store.CheckSchema(ctx); !errors.Is(err, storage.ErrSchemaOutdated) {
+		t.Fatalf("CheckSchema before migrating = %v, want ErrSchemaOutdated", err)
+	}
+	if _, err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := store.CheckSchema(ctx); err != nil {
+		t.Fatalf("CheckSchema after migrating: %v", err)
+	}
+
+	latest, err := store.GetLatestFeedback(ctx, "", "1A")
+	if err != nil || latest.Feedback != "legacy" {
+		t.Fatalf("GetLatestFeedback after migrating = %+v, %v", latest, err)
+	}
+
+	applied, err := store.Migrate(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("second Migrate applied %v, %v; want nothing", applied, err)
+	}
+
+	if _, err := db.Collection("meta").UpdateByID(ctx, "schema", bson.M{"$set": bson.M{"version": storage.SchemaVersion() + 1}}); err != nil {
+		t.Fatalf("bump schema version: %v", err)
+	}
+	if _, err := store.Migrate(ctx); !errors.Is(err, storage.ErrSchemaTooNew) {
+		t.Fatalf("Migrate on a newer schema = %v, want ErrSchemaTooNew", err)
+	}
+}
@@ -15,20 +15,17 @@ import (
 func TestJourney_FetcherAndOpenAI(t *testing.T) {
 	helpers.LoadConfig(t)
 
-	tracer := helpers.New(http.DefaultTransport)
+	cassette := helpers.NewCassette(t, http.DefaultTransport)
+	tracer := helpers.New(cassette)
 	httpClient := &http.Client{Transport: tracer, Timeout: 30 * time.Second}
 
 	fetcherSvc := fetcher.NewBrowserless(
-		viper.GetString("FETCHER_ENDPOINT"),
+		helpers.FetcherEndpoint(),
 		viper.GetString("FETCHER_TOKEN"),
 	)
+	fetcherSvc.HTTPClient = httpClient
 
-	aiClient, err := openai.NewClient(openai.Config{
-		APIKey:       viper.GetString("OPENAI_API_KEY"),
-		Model:        viper.GetString("OPENAI_MODEL"),
-		SystemPrompt: viper.GetString("OPENAI_SYSTEM_PROMPT"),
-		Timeout:      30 * time.Second,
-	}, httpClient)
+	aiClient, err := openai.NewClient(helpers.OpenAIConfig(cassette), httpClient)
 	if err != nil {
 		t.Fatalf("openai: %v", err)
 	}
@@ -44,7 +41,7 @@ func TestJourney_FetcherAndOpenAI(t *testing.T) {
 		t.Fatal("fetched empty problem statement")
 	}
 
-	feedback, err := aiClient.GetFeedback("int a;", "thinking hard...", problemHTML)
+	feedback, err := aiClient.GetFeedback(ctx, helpers.FeedbackPrompt(t, "2A", openai.PlainCode("int a;"), "thinking hard...", problemHTML))
 	if err != nil {
 		t.Fatalf("openai feedback: %v", err)
 	}